@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// addressPairsLabel declares address pairs on a container, like the
+// ovn.allowed_address_pairs endpoint option. The label suffixed with
+// ".<network name>" applies to that network only and takes precedence.
+const addressPairsLabel = addressPairsOption
+
+// mergeAddressPairs appends the pairs missing from existing
+func mergeAddressPairs(existing []string, added []string) []string {
+	merged := append([]string{}, existing...)
+	for _, pair := range added {
+		if !slices.Contains(merged, pair) {
+			merged = append(merged, pair)
+		}
+	}
+	return merged
+}
+
+// addLabelAddressPairs adds the address pairs of a container label to its
+// joined endpoint's port, next to those of the endpoint option
+func (d *OVNDriver) addLabelAddressPairs(portName string, value string) error {
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil {
+		return err
+	}
+	if !found || lsp.ExternalIDs["docker:mac"] == "" {
+		// Removed in the meantime
+		return nil
+	}
+	macAddr, ipAddr := lsp.ExternalIDs["docker:mac"], lsp.ExternalIDs["docker:ip"]
+
+	added, err := parseAddressPairs(value, macAddr)
+	if err != nil {
+		return fmt.Errorf("invalid %s label: %w", addressPairsLabel, err)
+	}
+	existing := splitAddressPairs(lsp.ExternalIDs["docker:address_pairs"])
+	pairs := mergeAddressPairs(existing, added)
+	if len(pairs) == len(existing) {
+		return nil
+	}
+
+	addresses, portSecurity := portAddresses(macAddr, ipAddr, pairs)
+	ops, err := d.ovn.UpdateLogicalSwitchPortAddressesOp(lsp, addresses, portSecurity)
+	if err != nil {
+		return err
+	}
+	metadataOps, err := d.ovn.UpdateLogicalSwitchPortExternalIDsOp(lsp, endpointMetadata(macAddr, ipAddr, pairs))
+	if err != nil {
+		return err
+	}
+	results, err := d.ovn.Transact(append(ops, metadataOps...)...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to add address pairs to %s: %w", portName, err)
+	}
+	d.logf("Added address pairs %v to %s", pairs[len(existing):], portName)
+	return nil
+}
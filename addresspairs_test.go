@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAddressPairsLabel(t *testing.T) {
+	labels := map[string]string{
+		"ovn.allowed_address_pairs":      "172.16.0.100",
+		"ovn.allowed_address_pairs.ovn1": "00:00:5e:00:01:01 172.17.0.100",
+	}
+	if value, key := networkLabel(labels, addressPairsLabel, "ovn1"); value != "00:00:5e:00:01:01 172.17.0.100" || key != "ovn.allowed_address_pairs.ovn1" {
+		t.Errorf("ovn1 reads %s=%q, want the network label", key, value)
+	}
+	if value, _ := networkLabel(labels, addressPairsLabel, "ovn0"); value != "172.16.0.100" {
+		t.Errorf("ovn0 reads %q, want the plain label", value)
+	}
+	if value, _ := networkLabel(nil, addressPairsLabel, "ovn0"); value != "" {
+		t.Errorf("no labels read %q", value)
+	}
+}
+
+func TestMergeAddressPairs(t *testing.T) {
+	// Pairs of the endpoint option come first and are never repeated
+	existing := []string{"02:00:00:00:00:01 172.16.0.100", "02:00:00:00:00:01 172.16.0.50"}
+	label, err := parseAddressPairs("172.16.0.100, 00:00:5e:00:01:01 172.16.0.101", "02:00:00:00:00:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := mergeAddressPairs(existing, label)
+	want := []string{"02:00:00:00:00:01 172.16.0.100", "02:00:00:00:00:01 172.16.0.50", "00:00:5e:00:01:01 172.16.0.101"}
+	if !slices.Equal(merged, want) {
+		t.Errorf("merged %q, want %q", merged, want)
+	}
+	if again := mergeAddressPairs(merged, label); len(again) != len(merged) {
+		t.Errorf("merging the label twice gave %q", again)
+	}
+}
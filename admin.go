@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// AdminServer serves the operator API of the plugin on a local unix socket,
+// e.g. curl --unix-socket /run/docker-network-ovn/admin.sock http://admin/drain
+type AdminServer struct {
+	driver *OVNDriver
+	tracer *Tracer
+	mux    *http.ServeMux
+}
+
+func NewAdminServer(d *OVNDriver, tracer *Tracer) *AdminServer {
+	s := &AdminServer{driver: d, tracer: tracer, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/drain", s.handleDrain)
+	s.mux.HandleFunc("/endpoints/stats", s.handleEndpointStats)
+	s.mux.HandleFunc("/trace", s.handleTrace)
+	s.mux.HandleFunc("/errors", s.handleErrors)
+	s.mux.HandleFunc("/uplink", s.handleUplink)
+	return s
+}
+
+// Serve listens on socketPath, readable by root only, until the listener fails
+func (s *AdminServer) Serve(socketPath string) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0o755); err != nil {
+		log.Printf("Warning: admin API disabled: %v", err)
+		return
+	}
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		log.Printf("Warning: admin API disabled: %v", err)
+		return
+	}
+	if err := os.Chmod(socketPath, 0o600); err != nil {
+		log.Printf("Warning: failed to restrict admin socket: %v", err)
+	}
+
+	log.Printf("Serving admin API on %s", socketPath)
+	if err := http.Serve(listener, s.mux); err != nil {
+		log.Printf("Warning: admin API stopped: %v", err)
+	}
+}
+
+// writeJSON answers with value encoded as JSON
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// checkNotDraining refuses work that would create resources while draining;
+// Docker reports the error and the operator retries after the upgrade
+func (d *OVNDriver) checkNotDraining() error {
+	if d.draining.Load() {
+		return codedErrorf(ErrDraining, "plugin is draining for an upgrade, retry once it is back")
+	}
+	return nil
+}
+
+type drainStatus struct {
+	Draining bool `json:"draining"`
+}
+
+// handleDrain reports the drain mode on GET, enters it on POST and leaves it
+// on DELETE
+func (s *AdminServer) handleDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !s.driver.draining.Swap(true) {
+			log.Println("Draining: new networks and endpoints are rejected until the drain is cancelled")
+		}
+	case http.MethodDelete:
+		if s.driver.draining.Swap(false) {
+			log.Println("Drain cancelled: accepting new networks and endpoints")
+		}
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET, POST or DELETE"})
+		return
+	}
+	writeJSON(w, http.StatusOK, drainStatus{Draining: s.driver.draining.Load()})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// PortSecurityAuditor compares the MAC programmed in each endpoint LSP with the
+// MAC actually configured on the container interface
+type PortSecurityAuditor struct {
+	ovs    *OVSAPI
+	ovn    *OVNAPI
+	repair bool
+}
+
+// NewPortSecurityAuditor creates an auditor; with repair set, drifted container
+// interfaces are reset to the MAC recorded in OVN
+func NewPortSecurityAuditor(ovsAPI *OVSAPI, ovnAPI *OVNAPI, repair bool) *PortSecurityAuditor {
+	return &PortSecurityAuditor{ovs: ovsAPI, ovn: ovnAPI, repair: repair}
+}
+
+// Run audits every interval until ctx is cancelled
+func (a *PortSecurityAuditor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.auditOnce()
+		}
+	}
+}
+
+func (a *PortSecurityAuditor) auditOnce() {
+	lsps, err := a.ovn.ListDockerLogicalSwitchPorts()
+	if err != nil {
+		log.Printf("Warning: port-security audit failed: %v", err)
+		portSecurityAuditErrors.Inc()
+		return
+	}
+
+	drifted := 0
+	for _, lsp := range lsps {
+		sandboxKey := lsp.ExternalIDs["docker:sandbox"]
+		if sandboxKey == "" || len(lsp.Addresses) == 0 {
+			continue
+		}
+
+		// Ports joined on other hosts have no local interface
+		iface, found, err := a.ovs.GetInterfaceByIfaceID(lsp.Name)
+		if err != nil || !found {
+			continue
+		}
+
+		expectedMAC := strings.Fields(lsp.Addresses[0])[0]
+		ifName, actualMAC, err := containerInterface(iface.Name, sandboxKey)
+		if err != nil {
+			log.Printf("Warning: port-security audit could not inspect %s: %v", lsp.Name, err)
+			portSecurityAuditErrors.Inc()
+			continue
+		}
+		if strings.EqualFold(expectedMAC, actualMAC) {
+			continue
+		}
+
+		drifted++
+		log.Printf("Warning: port-security drift on %s: container interface %s has MAC %s, LSP expects %s",
+			lsp.Name, ifName, actualMAC, expectedMAC)
+
+		if !a.repair {
+			continue
+		}
+		if _, err := runCommand("nsenter", "--net="+sandboxKey, "ip", "link", "set", "dev", ifName, "address", expectedMAC); err != nil {
+			log.Printf("Warning: failed to restore MAC %s on %s: %v", expectedMAC, lsp.Name, err)
+			portSecurityRepairs.WithLabelValues("failed").Inc()
+			continue
+		}
+		log.Printf("Restored MAC %s on container interface %s of %s", expectedMAC, ifName, lsp.Name)
+		portSecurityRepairs.WithLabelValues("repaired").Inc()
+	}
+
+	portSecurityDriftPorts.Set(float64(drifted))
+	portSecurityAuditRuns.Inc()
+}
+
+// containerInterface finds the peer of a host veth inside the sandbox netns and
+// returns its name and MAC address
+func containerInterface(hostVeth string, sandboxKey string) (string, string, error) {
+	out, err := runCommand("ip", "-o", "link", "show", "dev", hostVeth)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read %s: %w", hostVeth, err)
+	}
+	_, peerName, _ := parseIPLinkLine(out)
+	_, peerIndex, found := strings.Cut(peerName, "@if")
+	if !found {
+		return "", "", fmt.Errorf("%s has no veth peer", hostVeth)
+	}
+
+	out, err = runCommand("nsenter", "--net="+sandboxKey, "ip", "-o", "link", "show")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list links in %s: %w", sandboxKey, err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		index, name, mac := parseIPLinkLine(line)
+		if index == peerIndex {
+			name, _, _ = strings.Cut(name, "@")
+			return name, mac, nil
+		}
+	}
+	return "", "", fmt.Errorf("peer of %s not found in %s", hostVeth, sandboxKey)
+}
+
+// parseIPLinkLine extracts index, name and MAC from one line of `ip -o link`
+func parseIPLinkLine(line string) (string, string, string) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", "", ""
+	}
+
+	index := strings.TrimSuffix(fields[0], ":")
+	name := strings.TrimSuffix(fields[1], ":")
+	mac := ""
+	for i, field := range fields {
+		if field == "link/ether" && i+1 < len(fields) {
+			mac = fields[i+1]
+		}
+	}
+	return index, name, mac
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/model"
+)
+
+// bgpAdvertiseOption makes the subnet of a network advertised over BGP by
+// the hosts running a BGP speaker
+const bgpAdvertiseOption = "ovn.bgp_advertise"
+
+// bgpRouteMap marks the network statements the plugin manages in FRR, so
+// prefixes configured by the operator are never withdrawn
+const bgpRouteMap = "docker-network-ovn"
+
+// bgpResyncInterval bounds how long FRR may drift, e.g. after it restarted
+// without saved configuration
+const bgpResyncInterval = time.Minute
+
+// BGPSpeaker keeps the network statements of a local FRR in sync with the
+// subnets of networks created with ovn.bgp_advertise=true
+type BGPSpeaker struct {
+	asn     int
+	vtysh   string
+	trigger chan struct{}
+	// missing holds the subnets already reported as not announced
+	missing map[string]bool
+}
+
+func NewBGPSpeaker(asn int, vtysh string) *BGPSpeaker {
+	return &BGPSpeaker{asn: asn, vtysh: vtysh, trigger: make(chan struct{}, 1), missing: map[string]bool{}}
+}
+
+// EventHandler returns the OVN NB cache handler scheduling a sync when a
+// logical switch changes
+func (b *BGPSpeaker) EventHandler() cache.EventHandler {
+	schedule := func(table string, m model.Model) {
+		if _, ok := m.(*LogicalSwitch); ok {
+			b.schedule()
+		}
+	}
+	return &cache.EventHandlerFuncs{
+		AddFunc:    schedule,
+		UpdateFunc: func(table string, old model.Model, new model.Model) { schedule(table, new) },
+		DeleteFunc: schedule,
+	}
+}
+
+func (b *BGPSpeaker) schedule() {
+	select {
+	case b.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run syncs once at startup, then on switch changes and every
+// bgpResyncInterval until ctx is cancelled
+func (b *BGPSpeaker) Run(ctx context.Context, d *OVNDriver) {
+	ticker := time.NewTicker(bgpResyncInterval)
+	defer ticker.Stop()
+	b.schedule()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.trigger:
+		case <-ticker.C:
+		}
+		if err := b.sync(d); err != nil {
+			log.Printf("Warning: BGP advertisement sync failed: %v", err)
+		}
+	}
+}
+
+// advertisedSubnets returns the subnets of the networks to advertise
+func advertisedSubnets(d *OVNDriver) ([]string, error) {
+	switches, err := d.ovn.ListDockerLogicalSwitches()
+	if err != nil {
+		return nil, err
+	}
+	subnets := []string{}
+	for _, ls := range switches {
+		if ls.OtherConfig["docker:bgp_advertise"] == "true" && ls.OtherConfig["docker:subnet"] != "" {
+			subnets = append(subnets, ls.OtherConfig["docker:subnet"])
+		}
+	}
+	sort.Strings(subnets)
+	return subnets, nil
+}
+
+// sync announces missing subnets and withdraws those of deleted networks
+func (b *BGPSpeaker) sync(d *OVNDriver) error {
+	desired, err := advertisedSubnets(d)
+	if err != nil {
+		return err
+	}
+	current, err := b.announced()
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	changes := []string{}
+	for _, subnet := range desired {
+		wanted[subnet] = true
+		if !current[subnet] {
+			changes = append(changes, "network "+subnet+" route-map "+bgpRouteMap)
+			log.Printf("Advertising %s over BGP", subnet)
+		}
+	}
+	for subnet := range current {
+		if !wanted[subnet] {
+			changes = append(changes, "no network "+subnet+" route-map "+bgpRouteMap)
+			log.Printf("Withdrawing %s from BGP", subnet)
+		}
+	}
+	bgpAdvertisedPrefixes.Set(float64(len(desired)))
+	if len(changes) > 0 {
+		if err := b.configure(changes); err != nil {
+			return err
+		}
+	}
+	return b.checkAnnounced(desired)
+}
+
+// configure applies network statements to the BGP instance
+func (b *BGPSpeaker) configure(changes []string) error {
+	args := []string{
+		"-c", "configure terminal",
+		"-c", "route-map " + bgpRouteMap + " permit 10",
+		"-c", "exit",
+		"-c", "router bgp " + strconv.Itoa(b.asn),
+		"-c", "address-family ipv4 unicast",
+	}
+	for _, change := range changes {
+		args = append(args, "-c", change)
+	}
+	args = append(args, "-c", "end")
+	if _, err := runCommand(b.vtysh, args...); err != nil {
+		return fmt.Errorf("failed to update FRR: %w", err)
+	}
+	return nil
+}
+
+// checkAnnounced warns about subnets FRR does not announce. With bgp network
+// import-check, the FRR default, a network statement is only announced while
+// the host has a route to its prefix, and FRR reports nothing otherwise.
+func (b *BGPSpeaker) checkAnnounced(desired []string) error {
+	out, err := runCommand(b.vtysh, "-c", "show bgp ipv4 unicast json")
+	if err != nil {
+		return fmt.Errorf("failed to read the FRR BGP table: %w", err)
+	}
+	var table struct {
+		Routes map[string]json.RawMessage `json:"routes"`
+	}
+	if err := json.Unmarshal([]byte(out), &table); err != nil {
+		return fmt.Errorf("failed to parse the FRR BGP table: %w", err)
+	}
+	for _, subnet := range desired {
+		_, found := table.Routes[subnet]
+		switch {
+		case !found && !b.missing[subnet]:
+			log.Printf("Warning: FRR does not announce %s: the host has no route to it, see bgp network import-check", subnet)
+			b.missing[subnet] = true
+		case found && b.missing[subnet]:
+			log.Printf("FRR now announces %s", subnet)
+			delete(b.missing, subnet)
+		}
+	}
+	for subnet := range b.missing {
+		if !slices.Contains(desired, subnet) {
+			delete(b.missing, subnet)
+		}
+	}
+	return nil
+}
+
+// announced returns the prefixes FRR announces for the plugin, read from its
+// running configuration
+func (b *BGPSpeaker) announced() (map[string]bool, error) {
+	out, err := runCommand(b.vtysh, "-c", "show running-config bgpd")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FRR configuration: %w", err)
+	}
+	prefixes := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 4 && fields[0] == "network" && fields[2] == "route-map" && fields[3] == bgpRouteMap {
+			prefixes[fields[1]] = true
+		}
+	}
+	return prefixes, nil
+}
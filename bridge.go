@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+)
+
+// bridgeOption plugs the endpoints of a network into another integration
+// bridge than OVN_BRIDGE, for hosts that keep traffic classes on separate
+// bridges and NICs
+const bridgeOption = "ovn.bridge"
+
+// bridgeFor returns the integration bridge of a network's endpoints on this
+// host, the global bridge unless the network has ovn.bridge
+func (d *OVNDriver) bridgeFor(networkID string) string {
+	if config, err := d.networkConfig(networkID); err == nil && config.Options.Bridge != "" {
+		return config.Options.Bridge
+	}
+	return d.bridge
+}
+
+// checkBridgeExists rejects an ovn.bridge missing on this host, which would
+// only fail at the first Join
+func (d *OVNDriver) checkBridgeExists(name string) error {
+	if d.ovs == nil {
+		// Nested, endpoints are not plugged into a local bridge
+		return nil
+	}
+	if _, found, err := d.ovs.findBridge(name); err != nil {
+		return err
+	} else if !found {
+		return codedErrorf(ErrInvalidOption, "network option %s: bridge %s does not exist on this host", bridgeOption, name)
+	}
+	return nil
+}
+
+// bridgeOfPort returns the bridge holding a port, whatever its name
+func (o *OVSAPI) bridgeOfPort(portUUID string) (*Bridge, bool, error) {
+	bridgeList := []Bridge{}
+	if err := o.client.List(o.ctx, &bridgeList); err != nil {
+		return nil, false, fmt.Errorf("failed to list bridges: %w", err)
+	}
+	for i := range bridgeList {
+		for _, uuid := range bridgeList[i].Ports {
+			if uuid == portUUID {
+				return &bridgeList[i], true, nil
+			}
+		}
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+// Tunnel encapsulations ovn-controller supports in external_ids:ovn-encap-type
+var encapTypes = []string{"geneve", "vxlan", "stt"}
+
+// parseEncapType validates a comma separated list of encapsulation types,
+// most preferred first
+func parseEncapType(value string) (string, error) {
+	types := []string{}
+	for _, encap := range strings.Split(value, ",") {
+		encap = strings.ToLower(strings.TrimSpace(encap))
+		known := false
+		for _, encapType := range encapTypes {
+			known = known || encap == encapType
+		}
+		if !known {
+			return "", fmt.Errorf("unknown encapsulation %q: expected %s", encap, strings.Join(encapTypes, ", "))
+		}
+		types = append(types, encap)
+	}
+	return strings.Join(types, ","), nil
+}
+
+// SetChassisExternalIDs sets keys of the Open_vSwitch external_ids that
+// configure ovn-controller, and returns those whose value changed
+func (o *OVSAPI) SetChassisExternalIDs(values map[string]string) ([]string, error) {
+	ovsList := []OpenvSwitch{}
+	if err := o.client.List(o.ctx, &ovsList); err != nil {
+		return nil, fmt.Errorf("failed to list Open_vSwitch table: %w", err)
+	}
+	if len(ovsList) == 0 {
+		return nil, fmt.Errorf("no Open_vSwitch row")
+	}
+
+	// Cached rows share their maps with the cache, so never modify them in place
+	updated := ovsList[0]
+	updated.ExternalIDs = map[string]string{}
+	for k, v := range ovsList[0].ExternalIDs {
+		updated.ExternalIDs[k] = v
+	}
+	changed := []string{}
+	for k, v := range values {
+		if updated.ExternalIDs[k] != v {
+			updated.ExternalIDs[k] = v
+			changed = append(changed, k)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	ops, err := o.client.Where(&updated).Update(&updated, &updated.ExternalIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create update operation for Open_vSwitch: %w", err)
+	}
+	results, err := o.transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return nil, fmt.Errorf("failed to set chassis configuration: %w", err)
+	}
+	return changed, nil
+}
+
+// configureChassis writes the tunnel settings of this chassis; ovn-controller
+// then updates its Encap rows in the southbound database
+func configureChassis(ovs *OVSAPI, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if ovs == nil {
+		return fmt.Errorf("chassis settings need a local OVS, it is not available in nested mode")
+	}
+	changed, err := ovs.SetChassisExternalIDs(values)
+	if err != nil {
+		return err
+	}
+	for _, key := range changed {
+		log.Printf("Set chassis %s to %s", key, values[key])
+	}
+	return nil
+}
+
+// resolveEncapIP picks the tunnel endpoint address of this chassis from an
+// IPv4 address, which must be configured locally, an interface name, or a
+// subnet containing exactly one local address
+func resolveEncapIP(value string) (string, error) {
+	addrs, err := localIPv4Addresses()
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		for _, addrsOfIface := range addrs {
+			for _, addr := range addrsOfIface {
+				if addr.Equal(ip) {
+					return ip.String(), nil
+				}
+			}
+		}
+		return "", fmt.Errorf("%s is not configured on any interface", ip)
+	}
+	if _, subnet, err := net.ParseCIDR(value); err == nil {
+		matches := []string{}
+		for iface, addrsOfIface := range addrs {
+			for _, addr := range addrsOfIface {
+				if subnet.Contains(addr) {
+					matches = append(matches, addr.String()+" ("+iface+")")
+				}
+			}
+		}
+		if len(matches) != 1 {
+			return "", fmt.Errorf("expected one local address in %s, found %d: %s", subnet, len(matches), strings.Join(matches, ", "))
+		}
+		ip, _, _ := strings.Cut(matches[0], " ")
+		return ip, nil
+	}
+	addrsOfIface, found := addrs[value]
+	if !found {
+		return "", fmt.Errorf("%q is neither an address, a subnet nor an interface", value)
+	}
+	if len(addrsOfIface) == 0 {
+		return "", fmt.Errorf("interface %s has no IPv4 address", value)
+	}
+	return addrsOfIface[0].String(), nil
+}
+
+// localIPv4Addresses returns the IPv4 addresses of the local interfaces
+func localIPv4Addresses() (map[string][]net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	addrs := map[string][]net.IP{}
+	for _, iface := range ifaces {
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list addresses of %s: %w", iface.Name, err)
+		}
+		addrs[iface.Name] = []net.IP{}
+		for _, addr := range ifaceAddrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				addrs[iface.Name] = append(addrs[iface.Name], ipNet.IP.To4())
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// checkEncapIP warns when the configured tunnel endpoint address is missing
+// from this host, in which case tunnels to the other chassis never come up
+func checkEncapIP(ovs *OVSAPI) {
+	if ovs == nil {
+		return
+	}
+	encapIP, err := ovs.GetChassisExternalID("ovn-encap-ip")
+	if err != nil || encapIP == "" {
+		return
+	}
+	if _, err := resolveEncapIP(encapIP); err != nil {
+		log.Printf("Warning: external_ids:ovn-encap-ip: %v; cross-host traffic will fail, set OVN_ENCAP_IP", err)
+	}
+}
+
+// GetChassisExternalID returns a key of the Open_vSwitch external_ids
+func (o *OVSAPI) GetChassisExternalID(key string) (string, error) {
+	ovsList := []OpenvSwitch{}
+	if err := o.client.List(o.ctx, &ovsList); err != nil {
+		return "", fmt.Errorf("failed to list Open_vSwitch table: %w", err)
+	}
+	if len(ovsList) == 0 {
+		return "", nil
+	}
+	return ovsList[0].ExternalIDs[key], nil
+}
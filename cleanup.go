@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// orphanSwitches returns the driver-owned switches none of whose Docker
+// networks exist anymore. Only networks this host attached can be checked
+// against the local Docker; switches also used by other hosts are left to them.
+func (d *OVNDriver) orphanSwitches(systemID string, known map[string]bool) ([]LogicalSwitch, error) {
+	switches, err := d.ovn.ListDockerLogicalSwitches()
+	if err != nil {
+		return nil, err
+	}
+	orphans := []LogicalSwitch{}
+	for _, ls := range switches {
+		orphan := true
+		for _, networkID := range switchNetworkIDs(&ls) {
+			if known[networkID] || ls.OtherConfig[networkOtherConfigKey(networkID)] != systemID {
+				orphan = false
+				break
+			}
+		}
+		if orphan {
+			orphans = append(orphans, ls)
+		}
+	}
+	return orphans, nil
+}
+
+// cleanupOrphans lists the switches of networks deleted while the plugin was
+// down and deletes them, along with their ports and DHCP options, once
+// confirmed on in (or right away with force)
+func (d *OVNDriver) cleanupOrphans(driverNames []string, force bool, in io.Reader, out io.Writer) error {
+	systemID, err := d.systemID()
+	if err != nil {
+		return err
+	}
+	if systemID == "" {
+		return fmt.Errorf("no chassis system-id to tell this host's networks apart")
+	}
+
+	dockerNetworks, err := d.docker.ListNetworks(d.ovn.ctx, driverNames...)
+	if err != nil {
+		return fmt.Errorf("failed to list Docker networks of drivers %s: %w", strings.Join(driverNames, ", "), err)
+	}
+	known := make(map[string]bool, len(dockerNetworks))
+	for _, dockerNetwork := range dockerNetworks {
+		known[dockerNetwork.ID] = true
+	}
+
+	orphans, err := d.orphanSwitches(systemID, known)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		fmt.Fprintln(out, "No orphaned logical switches found")
+		return nil
+	}
+	fmt.Fprintf(out, "Logical switches without a Docker network of drivers %s:\n", strings.Join(driverNames, ", "))
+	for _, ls := range orphans {
+		fmt.Fprintf(out, "  %s\tsubnet %s\tnetworks %s\tports %d\n", ls.Name, ls.OtherConfig["docker:subnet"],
+			strings.Join(switchNetworkIDs(&ls), ","), len(ls.Ports))
+	}
+
+	if !force {
+		fmt.Fprintf(out, "Delete %d logical switches and their ports? [y/N] ", len(orphans))
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Fprintln(out, "Nothing deleted")
+			return nil
+		}
+	}
+
+	failed := 0
+	for _, ls := range orphans {
+		if err := d.ovn.DeleteLogicalSwitch(ls.Name); err != nil {
+			log.Printf("Warning: failed to delete orphaned logical switch %s: %v", ls.Name, err)
+			failed++
+			continue
+		}
+		if err := d.ovn.DeleteDHCPOptions(&ls); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d orphaned logical switches", failed, len(orphans))
+	}
+	fmt.Fprintf(out, "Deleted %d orphaned logical switches\n", len(orphans))
+	return nil
+}
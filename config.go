@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every plugin setting, read from the defaults, the YAML file,
+// the environment and the command line, in increasing order of precedence
+type Config struct {
+	Bridge            string        `yaml:"ovn_bridge" usage:"OVS integration bridge"`
+	OVSSocket         string        `yaml:"ovs_socket" usage:"OVSDB endpoint"`
+	PluginSocket      string        `yaml:"plugin_socket" usage:"Docker plugin socket path"`
+	PluginSocketGroup string        `yaml:"plugin_socket_group" usage:"group name or gid owning the plugin socket"`
+	PluginSocketMode  string        `yaml:"plugin_socket_mode" usage:"permissions of the plugin socket"`
+	PluginDirMode     string        `yaml:"plugin_dir_mode" usage:"permissions of the plugin socket directory"`
+	DBConnectTimeout  time.Duration `yaml:"db_connect_timeout" usage:"timeout of each OVSDB connection attempt and initial monitor"`
+	DBConnectRetries  int           `yaml:"db_connect_retries" usage:"connection retries before startup fails"`
+	JoinWorkers       int           `yaml:"join_workers" usage:"maximum number of endpoint Joins processed in parallel"`
+	VethPoolSize      int           `yaml:"veth_pool_size" usage:"veth pairs kept plugged into the integration bridge ahead of Join, 0 disables"`
+	JournalDir        string        `yaml:"journal_dir" usage:"directory journaling Joins in progress so a crash is rolled back on restart, empty disables"`
+	DeferredCleanup   bool          `yaml:"deferred_cleanup" usage:"run the OVS and OVN cleanup of Leave and DeleteEndpoint in the background, retried on failure"`
+	InstanceLock      string        `yaml:"instance_lock" usage:"lock file electing the active instance among plugin processes of a host, empty disables"`
+	FlavorsDir        string        `yaml:"flavors_dir" usage:"directory of <driver>.yaml network option profiles, each served as an additional driver, empty disables"`
+
+	OVSSSLCA             string        `yaml:"ovs_ssl_ca" usage:"CA certificate for an ssl: OVSDB endpoint"`
+	OVSSSLCert           string        `yaml:"ovs_ssl_cert" usage:"client certificate for an ssl: OVSDB endpoint"`
+	OVSSSLKey            string        `yaml:"ovs_ssl_key" usage:"client key for an ssl: OVSDB endpoint"`
+	OVNNBSSLCA           string        `yaml:"ovn_nb_ssl_ca" usage:"CA certificate for an ssl: OVN NB endpoint"`
+	OVNNBSSLCert         string        `yaml:"ovn_nb_ssl_cert" usage:"client certificate for an ssl: OVN NB endpoint"`
+	OVNNBSSLKey          string        `yaml:"ovn_nb_ssl_key" usage:"client key for an ssl: OVN NB endpoint"`
+	OVNSBSSLCA           string        `yaml:"ovn_sb_ssl_ca" usage:"CA certificate for an ssl: OVN SB endpoint"`
+	OVNSBSSLCert         string        `yaml:"ovn_sb_ssl_cert" usage:"client certificate for an ssl: OVN SB endpoint"`
+	OVNSBSSLKey          string        `yaml:"ovn_sb_ssl_key" usage:"client key for an ssl: OVN SB endpoint"`
+	TLSReloadInterval    time.Duration `yaml:"tls_reload_interval" usage:"how often TLS files are checked for rotation, 0 disables"`
+	OVNNBAddr            string        `yaml:"ovn_nb_addr" usage:"OVN NB endpoint(s), overriding external_ids:ovn-nb of the local Open_vSwitch"`
+	OVNNBRelays          string        `yaml:"ovn_nb_relays" usage:"comma separated ovsdb relay endpoints preferred for OVN NB"`
+	OVNNBLeaderOnly      bool          `yaml:"ovn_nb_leader_only" usage:"only use the RAFT leader of a clustered OVN NB"`
+	OVNNBTxnRetryTimeout time.Duration `yaml:"ovn_nb_txn_retry_timeout" usage:"how long interrupted OVN NB transactions are retried, 0 disables"`
+	OVNNBTxnTimeout      time.Duration `yaml:"ovn_nb_txn_timeout" usage:"how long one OVN NB transaction attempt waits for an answer, 0 waits forever"`
+	OVNSB                string        `yaml:"ovn_sb" usage:"OVN SB endpoint(s) used to report port bindings"`
+	OVNSBRelays          string        `yaml:"ovn_sb_relays" usage:"comma separated ovsdb relay endpoints preferred for OVN SB"`
+
+	OVNEncapType string `yaml:"ovn_encap_type" usage:"comma separated tunnel encapsulations of this chassis (geneve, vxlan, stt), written to external_ids:ovn-encap-type"`
+	OVNEncapIP   string `yaml:"ovn_encap_ip" usage:"tunnel endpoint of this chassis, written to external_ids:ovn-encap-ip: a local IPv4 address, an interface or a subnet with one local address"`
+
+	ProviderUplink   string `yaml:"provider_uplink" usage:"provider bridge and its uplink NICs, <bridge>:<nic>[,<nic>...], created or checked at startup"`
+	ProviderBondMode string `yaml:"provider_bond_mode" usage:"bond mode of an uplink with several NICs (balance-tcp, balance-slb, active-backup)"`
+	ProviderLACP     string `yaml:"provider_lacp" usage:"LACP mode of an uplink with several NICs (active, passive, off)"`
+	ProviderTrunks   string `yaml:"provider_trunks" usage:"comma separated VLAN IDs and ranges carried by the uplink, all when empty"`
+
+	KubeOVNCompat      bool   `yaml:"kube_ovn_compat" usage:"share the NB database with a kube-ovn cluster"`
+	ResourcePrefix     string `yaml:"resource_prefix" usage:"prefix of created switch names"`
+	SwitchNaming       string `yaml:"switch_naming" usage:"name switches after the Docker network id or name"`
+	SwitchNameTemplate string `yaml:"switch_name_template" usage:"template of switch names, with {name}"`
+	PortNameTemplate   string `yaml:"port_name_template" usage:"template of logical switch port names, with {endpoint} and {network}"`
+	VethNameTemplate   string `yaml:"veth_name_template" usage:"template of host veth names, with {endpoint:N}; at most 13 characters"`
+	Tenant             string `yaml:"tenant" usage:"tenant tag of created rows; only rows of this tenant are managed"`
+
+	NestedParentPort string `yaml:"nested_parent_port" usage:"logical switch port of this VM or container; endpoints become its VLAN tagged child ports and no local OVS is used"`
+	NestedInterface  string `yaml:"nested_interface" usage:"interface bound to nested_parent_port"`
+
+	DNSExportEtcd   string `yaml:"dns_export_etcd" usage:"etcd endpoint receiving container DNS records"`
+	DNSExportZone   string `yaml:"dns_export_zone" usage:"zone of exported DNS records"`
+	DNSExportPrefix string `yaml:"dns_export_prefix" usage:"etcd key prefix of exported DNS records"`
+	DNSExportTTL    int    `yaml:"dns_export_ttl" usage:"TTL of exported DNS records"`
+	DockerSocket    string `yaml:"docker_socket" usage:"Docker API socket"`
+	PropagateLabels string `yaml:"propagate_labels" usage:"comma separated network and container label keys (or prefixes ending in *) copied into external_ids"`
+	ValidateDocker  bool   `yaml:"validate_docker" usage:"cross-check OVN with the Docker networks of the driver at startup"`
+	DockerEvents    bool   `yaml:"docker_events" usage:"follow Docker container events to refresh ports of renamed, updated or health-changed containers"`
+
+	CleanupOrphans      bool `yaml:"cleanup_orphans" usage:"list the switches of Docker networks that no longer exist, delete them after confirmation and exit"`
+	CleanupOrphansForce bool `yaml:"cleanup_orphans_force" usage:"delete orphaned switches without asking for confirmation"`
+
+	IPAMHookURL           string        `yaml:"ipam_hook_url" usage:"webhook notified of endpoint allocations"`
+	IPAMHookCommand       string        `yaml:"ipam_hook_command" usage:"command notified of endpoint allocations"`
+	IPAMHookFailurePolicy string        `yaml:"ipam_hook_failure_policy" usage:"warn or fail when the IPAM hook fails"`
+	IPAMHookTimeout       time.Duration `yaml:"ipam_hook_timeout" usage:"timeout of each IPAM hook call"`
+
+	WebhookURLs    string        `yaml:"webhook_urls" usage:"comma separated URLs receiving network and endpoint lifecycle events"`
+	WebhookEvents  string        `yaml:"webhook_events" usage:"comma separated lifecycle events sent to webhooks, empty for all"`
+	WebhookSecret  string        `yaml:"webhook_secret" usage:"secret signing webhook payloads with HMAC-SHA256"`
+	WebhookTimeout time.Duration `yaml:"webhook_timeout" usage:"timeout of each webhook delivery attempt"`
+
+	MetricsAddr               string        `yaml:"metrics_addr" usage:"address serving Prometheus metrics on /metrics"`
+	InventoryAddr             string        `yaml:"inventory_addr" usage:"address serving the read-only network inventory API on /v1/networks"`
+	AdminSocket               string        `yaml:"admin_socket" usage:"unix socket serving the admin API, empty disables"`
+	PortSecurityAuditInterval time.Duration `yaml:"port_security_audit_interval" usage:"how often container MACs are audited, 0 disables"`
+	PortSecurityAuditRepair   bool          `yaml:"port_security_audit_repair" usage:"reset drifted container MACs"`
+	OVSReconcileInterval      time.Duration `yaml:"ovs_reconcile_interval" usage:"how often logical switch ports and OVS interfaces are reconciled, 0 disables"`
+	OVSReconcileRepair        bool          `yaml:"ovs_reconcile_repair" usage:"repair drift between logical switch ports and OVS interfaces"`
+
+	BGPASN   int    `yaml:"bgp_asn" usage:"AS number of the local FRR BGP instance advertising network subnets, 0 disables"`
+	BGPVtysh string `yaml:"bgp_vtysh" usage:"vtysh command configuring the local FRR"`
+
+	LogFile string `yaml:"log_file" usage:"append logs to this file instead of stderr"`
+	Debug   bool   `yaml:"debug" usage:"log OVSDB client activity"`
+}
+
+// DefaultConfig returns the settings used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		Bridge:                    "br-int",
+		OVSSocket:                 "unix:/var/run/openvswitch/db.sock",
+		PluginSocket:              "/run/docker/plugins/ovn.sock",
+		PluginSocketMode:          "0660",
+		PluginDirMode:             "0755",
+		DBConnectTimeout:          10 * time.Second,
+		DBConnectRetries:          5,
+		JoinWorkers:               4,
+		JournalDir:                "/var/lib/docker-network-ovn/journal",
+		DeferredCleanup:           true,
+		SwitchNaming:              switchNamingID,
+		SwitchNameTemplate:        DefaultNameTemplates().Switch,
+		PortNameTemplate:          DefaultNameTemplates().Port,
+		VethNameTemplate:          DefaultNameTemplates().Veth,
+		NestedInterface:           "eth0",
+		TLSReloadInterval:         30 * time.Second,
+		OVNNBTxnRetryTimeout:      30 * time.Second,
+		OVNNBTxnTimeout:           10 * time.Second,
+		DNSExportZone:             "docker.local",
+		DNSExportPrefix:           "/skydns",
+		DNSExportTTL:              30,
+		DockerSocket:              "/var/run/docker.sock",
+		PropagateLabels:           "",
+		IPAMHookTimeout:           10 * time.Second,
+		WebhookTimeout:            10 * time.Second,
+		BGPVtysh:                  "vtysh",
+		ProviderBondMode:          "balance-tcp",
+		ProviderLACP:              "active",
+		PortSecurityAuditInterval: 5 * time.Minute,
+		AdminSocket:               "/run/docker-network-ovn/admin.sock",
+		OVSReconcileInterval:      5 * time.Minute,
+	}
+}
+
+// OVSTLS returns the TLS files of the OVSDB connection
+func (c Config) OVSTLS() TLSFiles {
+	return TLSFiles{CACert: c.OVSSSLCA, Cert: c.OVSSSLCert, Key: c.OVSSSLKey}
+}
+
+// OVNNBTLS returns the TLS files of the OVN NB connection
+func (c Config) OVNNBTLS() TLSFiles {
+	return TLSFiles{CACert: c.OVNNBSSLCA, Cert: c.OVNNBSSLCert, Key: c.OVNNBSSLKey}
+}
+
+// OVNSBTLS returns the TLS files of the OVN SB connection
+func (c Config) OVNSBTLS() TLSFiles {
+	return TLSFiles{CACert: c.OVNSBSSLCA, Cert: c.OVNSBSSLCert, Key: c.OVNSBSSLKey}
+}
+
+// defaultConfigFile is read when present and no other file is given
+const defaultConfigFile = "/etc/docker-network-ovn/config.yaml"
+
+// LoadConfig builds the configuration from defaults, the config file, the
+// environment and the command line arguments
+func LoadConfig(args []string) (Config, error) {
+	cfg := DefaultConfig()
+	fields := configFields(&cfg)
+
+	fs := flag.NewFlagSet("docker-network-ovn", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file (default "+defaultConfigFile+" if present)")
+	flagValues := make([]*configFlag, len(fields))
+	for i, field := range fields {
+		flagValues[i] = &configFlag{value: formatConfigValue(field.value), isBool: field.value.Kind() == reflect.Bool}
+		fs.Var(flagValues[i], strings.ReplaceAll(field.key, "_", "-"), field.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	path := *configPath
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			path = defaultConfigFile
+		}
+	}
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		defer file.Close()
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	for _, field := range fields {
+		env := strings.ToUpper(field.key)
+		if value := os.Getenv(env); value != "" {
+			if err := setConfigValue(field.value, value); err != nil {
+				return cfg, fmt.Errorf("invalid %s: %w", env, err)
+			}
+		}
+	}
+
+	for i, field := range fields {
+		if !flagValues[i].set {
+			continue
+		}
+		if err := setConfigValue(field.value, flagValues[i].value); err != nil {
+			return cfg, fmt.Errorf("invalid --%s: %w", strings.ReplaceAll(field.key, "_", "-"), err)
+		}
+	}
+	return cfg, nil
+}
+
+// configFlag records a command line value so it can be applied after the
+// config file and the environment
+type configFlag struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *configFlag) Set(value string) error {
+	f.value = value
+	f.set = true
+	return nil
+}
+
+func (f *configFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+type configField struct {
+	key   string
+	usage string
+	value reflect.Value
+}
+
+func configFields(cfg *Config) []configField {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	fields := make([]configField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		fields = append(fields, configField{
+			key:   t.Field(i).Tag.Get("yaml"),
+			usage: t.Field(i).Tag.Get("usage"),
+			value: v.Field(i),
+		})
+	}
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func formatConfigValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func setConfigValue(v reflect.Value, value string) error {
+	switch {
+	case v.Type() == durationType:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(duration))
+	case v.Kind() == reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(parsed))
+	case v.Kind() == reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(parsed)
+	default:
+		v.SetString(value)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// connLimitOption caps the concurrent connections of endpoints
+const connLimitOption = "ovn.conn_limit"
+
+// ctZoneLimitRelease is the first OVN release applying options:ct-zone-limit;
+// older ones ignore it
+const ctZoneLimitRelease = "24.09"
+
+// validateConnLimit accepts a positive number of connections
+func validateConnLimit(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("expected a positive number of connections")
+	}
+	return nil
+}
+
+// ovnRelease returns the year.month release of an OVN version such as
+// 24.03.2-20.33.0-72.8, empty when the version does not parse
+func ovnRelease(version string) string {
+	var year, month int
+	if _, err := fmt.Sscanf(version, "%d.%d", &year, &month); err != nil || month < 1 || month > 12 {
+		return ""
+	}
+	return fmt.Sprintf("%02d.%02d", year, month)
+}
+
+// NorthdRelease returns the OVN release of ovn-northd, read from the version
+// it records in NB_Global options; empty when it recorded none
+func (o *OVNAPI) NorthdRelease() (string, error) {
+	results, err := o.Transact(ovsdb.Operation{
+		Op:      ovsdb.OperationSelect,
+		Table:   "NB_Global",
+		Columns: []string{"options"},
+	})
+	if err := transactError(err, results); err != nil {
+		return "", fmt.Errorf("failed to read NB_Global options: %w", err)
+	}
+	for _, row := range results[0].Rows {
+		options, _ := row["options"].(ovsdb.OvsMap)
+		version, _ := options.GoMap["northd_internal_version"].(string)
+		return ovnRelease(version), nil
+	}
+	return "", nil
+}
+
+// connLimitIgnored reports whether ovn-northd is known to predate
+// ct-zone-limit support
+func (d *OVNDriver) connLimitIgnored() bool {
+	return d.northdRelease != "" && d.northdRelease < ctZoneLimitRelease
+}
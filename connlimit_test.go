@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/network"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+func TestConnLimitRejectedBeforeThePortIsWritten(t *testing.T) {
+	nb := &fakeNB{replies: []fakeReply{committed}}
+	d := NewOVNDriver("br-int", "", nil, NewOVNAPI(nb, context.Background()), NewNetworkCache(), 1, false, "", nil)
+
+	for _, limit := range []string{"-1", "0", "many", "1e3"} {
+		_, err := d.CreateEndpoint(&network.CreateEndpointRequest{
+			NetworkID:  strings.Repeat("a", 64),
+			EndpointID: strings.Repeat("b", 64),
+			Options:    map[string]interface{}{connLimitOption: limit},
+		})
+		var driverErr *DriverError
+		if !errors.As(err, &driverErr) || driverErr.Code != ErrInvalidOption {
+			t.Errorf("CreateEndpoint with %s=%s: error %v, want %s", connLimitOption, limit, err, ErrInvalidOption)
+		}
+		if _, err := parseNetworkOptions(genericOptions(map[string]interface{}{connLimitOption: limit})); err == nil {
+			t.Errorf("parseNetworkOptions accepted %s=%s", connLimitOption, limit)
+		}
+	}
+	if len(nb.sent) != 0 {
+		t.Errorf("CreateEndpoint sent %d transactions for invalid limits", len(nb.sent))
+	}
+}
+
+func TestNorthdRelease(t *testing.T) {
+	for version, want := range map[string]string{
+		"24.03.2-20.33.0-72.8": "24.03",
+		"24.09.0-20.37.0-73.6": "24.09",
+		"":                     "",
+		"unknown":              "",
+	} {
+		if got := ovnRelease(version); got != want {
+			t.Errorf("ovnRelease(%q) = %q, want %q", version, got, want)
+		}
+	}
+
+	nb := &fakeNB{replies: []fakeReply{{results: []ovsdb.OperationResult{{Rows: []ovsdb.Row{{
+		"options": ovsdb.OvsMap{GoMap: map[interface{}]interface{}{"northd_internal_version": "24.03.2-20.33.0-72.8"}},
+	}}}}}}}
+	if release, err := NewOVNAPI(nb, context.Background()).NorthdRelease(); err != nil || release != "24.03" {
+		t.Errorf("NorthdRelease() = %q, %v, want 24.03", release, err)
+	}
+
+	d := &OVNDriver{northdRelease: "24.03"}
+	if !d.connLimitIgnored() {
+		t.Error("ovn-northd 24.03 was taken to apply connection limits")
+	}
+	for _, release := range []string{"24.09", "25.03", ""} {
+		if d := (&OVNDriver{northdRelease: release}); d.connLimitIgnored() {
+			t.Errorf("connection limits were taken as ignored by ovn-northd %q", release)
+		}
+	}
+}
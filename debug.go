@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// dumpTransaction logs the operations of a transaction as sent on the wire
+// and the result of each
+func dumpTransaction(ctx context.Context, db string, ops []ovsdb.Operation, results []ovsdb.OperationResult, err error) {
+	if id := requestIDFrom(ctx); id != "" {
+		db = db + " [" + id + "]"
+	}
+	for i, op := range ops {
+		sent, marshalErr := json.Marshal(op)
+		if marshalErr != nil {
+			log.Printf("OVSDB %s transaction op %d: %s on %s (not encodable: %v)", db, i, op.Op, op.Table, marshalErr)
+			continue
+		}
+		if i < len(results) {
+			answer, _ := json.Marshal(results[i])
+			log.Printf("OVSDB %s transaction op %d: %s -> %s", db, i, sent, answer)
+			continue
+		}
+		log.Printf("OVSDB %s transaction op %d: %s -> no result", db, i, sent)
+	}
+	if err := transactError(err, results); err != nil {
+		log.Printf("OVSDB %s transaction failed: %v", db, err)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Kinds of deferred cleanup
+const (
+	cleanupLeave  = "leave"
+	cleanupDelete = "delete"
+)
+
+// cleanupIntent describes the cleanup of an endpoint Docker already saw
+// succeed: the OVS port and veth of a Leave, or the logical switch port of a
+// DeleteEndpoint
+type cleanupIntent struct {
+	Kind       string
+	NetworkID  string
+	EndpointID string
+	Port       string
+	Veth       string
+	Bridge     string `json:",omitempty"`
+	// DNSName is the exported DNS record removed by a Leave
+	DNSName string `json:",omitempty"`
+	Queued  time.Time
+	// RequestID is the ID of the request that queued the cleanup
+	RequestID string `json:",omitempty"`
+}
+
+func (c cleanupIntent) key() string {
+	return c.Kind + "-" + c.EndpointID
+}
+
+// cleanupTask is a queued cleanup. Its mutex serializes the worker with a
+// caller running the cleanup ahead of its turn.
+type cleanupTask struct {
+	intent cleanupIntent
+	driver *OVNDriver
+	retry  backoff.BackOff
+	mu     sync.Mutex
+	done   bool
+}
+
+// CleanupQueue runs the cleanup of Leave and DeleteEndpoint in the background,
+// retrying failures with backoff
+type CleanupQueue struct {
+	driver  *OVNDriver
+	tasks   chan *cleanupTask
+	mu      sync.Mutex
+	pending map[string]*cleanupTask
+}
+
+// NewCleanupQueue starts the worker of a cleanup queue
+func NewCleanupQueue(d *OVNDriver) *CleanupQueue {
+	q := &CleanupQueue{
+		driver:  d,
+		tasks:   make(chan *cleanupTask, 1024),
+		pending: map[string]*cleanupTask{},
+	}
+	go q.worker()
+	return q
+}
+
+// Add queues a cleanup on behalf of the request d is bound to
+func (q *CleanupQueue) Add(d *OVNDriver, intent cleanupIntent) {
+	intent.Queued = time.Now()
+	intent.RequestID = requestIDFrom(d.context())
+	if d.journal != nil {
+		if err := d.journal.recordCleanup(intent); err != nil {
+			d.logf("Warning: %v", err)
+		}
+	}
+	q.add(d.background(), intent)
+}
+
+func (q *CleanupQueue) add(d *OVNDriver, intent cleanupIntent) {
+	retry := backoff.NewExponentialBackOff()
+	retry.MaxElapsedTime = 10 * time.Minute
+	task := &cleanupTask{intent: intent, driver: d, retry: retry}
+	q.mu.Lock()
+	q.pending[intent.key()] = task
+	q.mu.Unlock()
+	q.tasks <- task
+}
+
+// Resume queues the cleanups a previous run did not finish
+func (q *CleanupQueue) Resume() {
+	if q.driver.journal == nil {
+		return
+	}
+	intents, err := q.driver.journal.pendingCleanups()
+	if err != nil {
+		log.Printf("Warning: failed to resume queued cleanups: %v", err)
+		return
+	}
+	for _, intent := range intents {
+		log.Printf("Resuming %s cleanup of endpoint %s queued at %s%s", intent.Kind, intent.EndpointID[:12],
+			intent.Queued.Format(time.RFC3339), requestSuffix(intent.RequestID))
+		q.add(q.driver, intent)
+	}
+}
+
+func (q *CleanupQueue) worker() {
+	for task := range q.tasks {
+		err := q.run(task)
+		if err == nil {
+			continue
+		}
+		wait := task.retry.NextBackOff()
+		if wait == backoff.Stop {
+			// The journal entry stays, so the next start tries again
+			task.driver.logf("Warning: giving up %s cleanup of endpoint %s: %v", task.intent.Kind, task.intent.EndpointID[:12], err)
+			q.forget(task)
+			continue
+		}
+		task.driver.logf("Warning: %s cleanup of endpoint %s failed, retrying in %s: %v", task.intent.Kind, task.intent.EndpointID[:12], wait.Round(time.Second), err)
+		time.AfterFunc(wait, func() { q.tasks <- task })
+	}
+}
+
+// run runs a task unless it already succeeded
+func (q *CleanupQueue) run(task *cleanupTask) error {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	if task.done {
+		return nil
+	}
+	if err := task.driver.runCleanup(task.intent); err != nil {
+		return err
+	}
+	task.done = true
+	q.forget(task)
+	if task.driver.journal != nil {
+		task.driver.journal.clearCleanup(task.intent.key())
+	}
+	return nil
+}
+
+func (q *CleanupQueue) forget(task *cleanupTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[task.intent.key()] == task {
+		delete(q.pending, task.intent.key())
+	}
+}
+
+// Flush runs the queued cleanups matching match now, returning whether there
+// were any. Failed ones stay queued.
+func (q *CleanupQueue) Flush(match func(cleanupIntent) bool) bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	tasks := []*cleanupTask{}
+	for _, task := range q.pending {
+		if match(task.intent) {
+			tasks = append(tasks, task)
+		}
+	}
+	q.mu.Unlock()
+	for _, task := range tasks {
+		if err := q.run(task); err != nil {
+			task.driver.logf("Warning: %s cleanup of endpoint %s failed: %v", task.intent.Kind, task.intent.EndpointID[:12], err)
+		}
+	}
+	return len(tasks) > 0
+}
+
+// Queued reports whether a cleanup of an endpoint is waiting
+func (q *CleanupQueue) Queued(endpointID string) bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, task := range q.pending {
+		if task.intent.EndpointID == endpointID {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of queued cleanups
+func (q *CleanupQueue) Len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// cleanup runs a cleanup in the background when the queue is enabled, and
+// right away otherwise
+func (d *OVNDriver) cleanup(intent cleanupIntent) {
+	if d.cleanups != nil {
+		d.cleanups.Add(d, intent)
+		return
+	}
+	if err := d.runCleanup(intent); err != nil {
+		d.logf("Warning: %s cleanup of endpoint %s: %v", intent.Kind, intent.EndpointID[:12], err)
+	}
+}
+
+func (d *OVNDriver) runCleanup(intent cleanupIntent) error {
+	switch intent.Kind {
+	case cleanupLeave:
+		return d.leaveCleanup(intent)
+	case cleanupDelete:
+		return d.deleteEndpointCleanup(intent)
+	}
+	return fmt.Errorf("unknown cleanup %q", intent.Kind)
+}
+
+// leaveCleanup removes the exported DNS record, the OVS port and the veth of
+// a left endpoint. Each step is idempotent, so a retry redoes all of them.
+func (d *OVNDriver) leaveCleanup(intent cleanupIntent) error {
+	if d.dns != nil && intent.DNSName != "" {
+		d.dns.Unregister(intent.DNSName)
+	}
+
+	var errs []error
+	if d.ovs != nil {
+		if err := d.ovs.RemovePort(intent.Bridge, intent.Veth); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove OVS port %s: %w", intent.Veth, err))
+		}
+	}
+	if _, err := net.InterfaceByName(intent.Veth); err == nil {
+		if _, err := runCommand("ip", "link", "del", intent.Veth); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete veth pair: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteEndpointCleanup removes the logical switch port of a deleted
+// endpoint along with its metadata, virtual IPs and QoS rules
+func (d *OVNDriver) deleteEndpointCleanup(intent cleanupIntent) error {
+	ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(intent.NetworkID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// Deleted with its network
+		return nil
+	}
+
+	ops, err := d.deleteLegacyEndpointMetadataOps(ls, intent.EndpointID)
+	if err != nil {
+		return fmt.Errorf("failed to create mutate operation for endpoint metadata delete: %w", err)
+	}
+
+	portOps, err := d.deleteLogicalSwitchPortOps(ls, intent.Port)
+	if err != nil {
+		return fmt.Errorf("failed to create delete operation for LSP %s: %w", intent.Port, err)
+	}
+	ops = append(ops, portOps...)
+
+	virtualOps, err := d.removeVirtualParentOps(ls, intent.Port)
+	if err != nil {
+		return fmt.Errorf("failed to create operations to release virtual IPs of %s: %w", intent.Port, err)
+	}
+	ops = append(ops, virtualOps...)
+
+	qosOps, err := d.ovn.deleteDSCPOps(ls, intent.Port)
+	if err != nil {
+		return fmt.Errorf("failed to create operations to remove QoS rules of %s: %w", intent.Port, err)
+	}
+	ops = append(ops, qosOps...)
+	if len(ops) == 0 {
+		return nil
+	}
+
+	results, err := d.ovn.Transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to delete logical switch port %s: %w", intent.Port, err)
+	}
+	d.logf("Deleted endpoint %s and logical switch port %s", intent.EndpointID[:12], intent.Port)
+	return nil
+}
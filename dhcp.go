@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// DHCPOptions is the OVN Northbound DHCP_Options table; ovn-controller answers
+// DHCP requests of ports referencing a row with its options
+type DHCPOptions struct {
+	UUID        string            `ovsdb:"_uuid"`
+	CIDR        string            `ovsdb:"cidr"`
+	Options     map[string]string `ovsdb:"options"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+}
+
+const (
+	dnsServersOption = "ovn.dns_servers"
+	dnsSearchOption  = "ovn.dns_search"
+
+	dhcpLeaseTime = "3600"
+
+	// dhcpNetworkOtherConfigKey records on a switch the network its
+	// DHCP_Options were created with; docker:network goes away when that
+	// network leaves a shared switch
+	dhcpNetworkOtherConfigKey = "docker:dhcp_network"
+)
+
+// parseDNSServers parses comma separated IPv4 name server addresses
+func parseDNSServers(value string) ([]string, error) {
+	servers := []string{}
+	for _, server := range splitOptionList(value) {
+		if ip := net.ParseIP(server).To4(); ip == nil {
+			return nil, fmt.Errorf("invalid IPv4 address %q", server)
+		}
+		servers = append(servers, server)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no name servers given")
+	}
+	return servers, nil
+}
+
+// parseDNSSearch parses comma separated search domains
+func parseDNSSearch(value string) ([]string, error) {
+	domains := []string{}
+	for _, domain := range splitOptionList(value) {
+		domain = strings.TrimSuffix(domain, ".")
+		for _, label := range strings.Split(domain, ".") {
+			if label == "" || len(label) > 63 || dnsLabel(label) != strings.ToLower(label) {
+				return nil, fmt.Errorf("invalid domain %q", domain)
+			}
+		}
+		domains = append(domains, domain)
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains given")
+	}
+	return domains, nil
+}
+
+// networkDNS holds the DNS settings of a network, recorded in the switch
+// other_config so Join can read them back
+type networkDNS struct {
+	Servers []string
+	Search  []string
+}
+
+func (n networkDNS) Enabled() bool {
+	return len(n.Servers) > 0 || len(n.Search) > 0
+}
+
+func (n networkDNS) otherConfig() map[string]string {
+	values := map[string]string{}
+	if len(n.Servers) > 0 {
+		values["docker:dns_servers"] = strings.Join(n.Servers, ",")
+	}
+	if len(n.Search) > 0 {
+		values["docker:dns_search"] = strings.Join(n.Search, ",")
+	}
+	return values
+}
+
+func networkDNSFromSwitch(ls *LogicalSwitch) networkDNS {
+	dns := networkDNS{}
+	if servers := ls.OtherConfig["docker:dns_servers"]; servers != "" {
+		dns.Servers = strings.Split(servers, ",")
+	}
+	if search := ls.OtherConfig["docker:dns_search"]; search != "" {
+		dns.Search = strings.Split(search, ",")
+	}
+	return dns
+}
+
+// dhcpOptions returns the DHCP_Options row handing out a network's DNS and
+// boot settings; server_mac only has to be stable and unique per network
+func dhcpOptions(networkID string, subnet string, gateway string, dns networkDNS, boot networkBoot) *DHCPOptions {
+	options := map[string]string{
+		"lease_time": dhcpLeaseTime,
+		"server_mac": generateMAC("d" + networkID),
+	}
+	if gateway != "" {
+		options["server_id"] = gateway
+		options["router"] = gateway
+	} else if _, ipNet, err := net.ParseCIDR(subnet); err == nil {
+		options["server_id"] = ipNet.IP.String()
+	}
+	if len(dns.Servers) > 0 {
+		options["dns_server"] = "{" + strings.Join(dns.Servers, ", ") + "}"
+	}
+	if len(dns.Search) > 0 {
+		options["domain_search_list"] = `"` + strings.Join(dns.Search, ",") + `"`
+	}
+	for k, v := range boot.dhcpValues() {
+		options[k] = v
+	}
+	return &DHCPOptions{
+		CIDR:        subnet,
+		Options:     options,
+		ExternalIDs: map[string]string{"docker:network": networkID},
+	}
+}
+
+// CreateDHCPOptionsOp builds an operation to create a DHCP_Options row
+func (o *OVNAPI) CreateDHCPOptionsOp(row *DHCPOptions) ([]ovsdb.Operation, error) {
+	row.ExternalIDs = o.tagExternalIDs(row.ExternalIDs)
+	return o.client.Create(row)
+}
+
+// GetDHCPOptions returns the driver-owned DHCP_Options of a switch; the
+// subnet alone is ambiguous with ovn.allow_overlap
+func (o *OVNAPI) GetDHCPOptions(ls *LogicalSwitch) (*DHCPOptions, bool, error) {
+	list := []DHCPOptions{}
+	err := o.client.WhereCache(func(row *DHCPOptions) bool {
+		if row.CIDR != ls.OtherConfig["docker:subnet"] || !isOwned(row.ExternalIDs) {
+			return false
+		}
+		// Switches created before the key was recorded predate overlapping
+		// subnets, so their subnet is unique
+		networkID, ok := ls.OtherConfig[dhcpNetworkOtherConfigKey]
+		return !ok || row.ExternalIDs["docker:network"] == networkID
+	}).List(o.ctx, &list)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list DHCP options: %w", err)
+	}
+	if len(list) == 0 {
+		return nil, false, nil
+	}
+	return &list[0], true, nil
+}
+
+// UpdateDHCPOptionsExternalIDsOp merges values into a DHCP_Options row's
+// external_ids
+func (o *OVNAPI) UpdateDHCPOptionsExternalIDsOp(row *DHCPOptions, values map[string]string) ([]ovsdb.Operation, error) {
+	// Cached rows share their maps with the cache, so never modify them in place
+	updated := *row
+	updated.ExternalIDs = withOwnerTag(row.ExternalIDs)
+	for k, v := range values {
+		updated.ExternalIDs[k] = v
+	}
+	return o.client.Where(&updated).Update(&updated, &updated.ExternalIDs)
+}
+
+// DeleteDHCPOptions removes the driver-owned DHCP_Options of a switch
+func (o *OVNAPI) DeleteDHCPOptions(ls *LogicalSwitch) error {
+	row, found, err := o.GetDHCPOptions(ls)
+	if err != nil || !found {
+		return err
+	}
+	ops, err := o.client.Where(row).Delete()
+	if err != nil {
+		return fmt.Errorf("failed to create delete operation for DHCP options: %w", err)
+	}
+	results, err := o.Transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to delete DHCP options of %s: %w", ls.Name, err)
+	}
+	return nil
+}
+
+// dhcpMonitorOption monitors the driver-owned DHCP_Options rows
+func dhcpMonitorOption(ownerTag map[string]string) client.MonitorOption {
+	row := &DHCPOptions{}
+	return client.WithConditionalTable(row, []model.Condition{{
+		Field:    &row.ExternalIDs,
+		Function: ovsdb.ConditionIncludes,
+		Value:    ownerTag,
+	}}, &row.CIDR, &row.ExternalIDs)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// DNSBackend stores container address records outside of OVN
+type DNSBackend interface {
+	Put(fqdn string, ip string) error
+	Delete(fqdn string) error
+}
+
+// EtcdDNSBackend writes records in the SkyDNS layout read by the CoreDNS etcd
+// plugin, through the etcd v3 JSON gateway so no etcd client is needed
+type EtcdDNSBackend struct {
+	endpoint string
+	prefix   string
+	ttl      int
+	http     *http.Client
+}
+
+func NewEtcdDNSBackend(endpoint string, prefix string, ttl int) *EtcdDNSBackend {
+	return &EtcdDNSBackend{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		prefix:   "/" + strings.Trim(prefix, "/"),
+		ttl:      ttl,
+		http:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// key maps web.ovn0.docker.local to <prefix>/local/docker/ovn0/web
+func (b *EtcdDNSBackend) key(fqdn string) string {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return b.prefix + "/" + strings.Join(labels, "/")
+}
+
+func (b *EtcdDNSBackend) call(path string, body map[string]string) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := b.http.Post(b.endpoint+path, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("etcd %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd %s: %s", path, resp.Status)
+	}
+	return nil
+}
+
+func (b *EtcdDNSBackend) Put(fqdn string, ip string) error {
+	record, err := json.Marshal(map[string]interface{}{"host": ip, "ttl": b.ttl})
+	if err != nil {
+		return err
+	}
+	return b.call("/v3/kv/put", map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(b.key(fqdn))),
+		"value": base64.StdEncoding.EncodeToString(record),
+	})
+}
+
+func (b *EtcdDNSBackend) Delete(fqdn string) error {
+	return b.call("/v3/kv/deleterange", map[string]string{
+		"key": base64.StdEncoding.EncodeToString([]byte(b.key(fqdn))),
+	})
+}
+
+// DNSExporter publishes <container>.<network>.<zone> records for joined
+// endpoints. Names are looked up through the Docker API after Join returns,
+// since the plugin protocol does not carry them.
+type DNSExporter struct {
+	backend DNSBackend
+	docker  *DockerClient
+	zone    string
+	ctx     context.Context
+}
+
+func NewDNSExporter(ctx context.Context, backend DNSBackend, docker *DockerClient, zone string) *DNSExporter {
+	return &DNSExporter{
+		backend: backend,
+		docker:  docker,
+		zone:    strings.Trim(zone, "."),
+		ctx:     ctx,
+	}
+}
+
+// Register publishes the record of a joined endpoint in the background and
+// hands the record name to exported so it survives plugin restarts
+func (e *DNSExporter) Register(networkID string, endpointID string, ip string, exported func(fqdn string)) {
+	go func() {
+		retry := backoff.NewExponentialBackOff()
+		retry.MaxElapsedTime = time.Minute
+
+		// The endpoint shows up in the network inspect once Docker finished
+		// the join, shortly after the driver call returned
+		err := backoff.Retry(func() error {
+			container, networkName, found, err := e.docker.EndpointContainer(e.ctx, networkID, endpointID)
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("endpoint %s not attached yet", endpointID[:12])
+			}
+
+			fqdn := e.Name(container.Name, networkName)
+			if err := e.backend.Put(fqdn, ip); err != nil {
+				return err
+			}
+			log.Printf("Exported DNS record %s -> %s", fqdn, ip)
+			exported(fqdn)
+			return nil
+		}, backoff.WithContext(retry, e.ctx))
+		if err != nil {
+			log.Printf("Warning: failed to export DNS record for endpoint %s: %v", endpointID[:12], err)
+		}
+	}()
+}
+
+// Unregister removes the record of an endpoint leaving its container
+func (e *DNSExporter) Unregister(fqdn string) {
+	if err := e.backend.Delete(fqdn); err != nil {
+		log.Printf("Warning: failed to remove DNS record %s: %v", fqdn, err)
+		return
+	}
+	log.Printf("Removed DNS record %s", fqdn)
+}
+
+// Name returns the record name of a container on a network
+func (e *DNSExporter) Name(containerName string, networkName string) string {
+	return dnsLabel(containerName) + "." + dnsLabel(networkName) + "." + e.zone
+}
+
+// Rename moves the record of an endpoint whose container was renamed
+func (e *DNSExporter) Rename(oldFQDN string, fqdn string, ip string) error {
+	if err := e.backend.Put(fqdn, ip); err != nil {
+		return err
+	}
+	log.Printf("Exported DNS record %s -> %s", fqdn, ip)
+	e.Unregister(oldFQDN)
+	return nil
+}
+
+// dnsLabel turns a container or network name into a DNS label
+func dnsLabel(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	label := strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' {
+			return c
+		}
+		return '-'
+	}, name)
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return strings.Trim(label, "-")
+}
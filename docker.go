@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DockerClient is a minimal Docker Engine API client over the daemon's unix
+// socket. The daemon waits on the plugin during driver calls, so it must only
+// be used outside of them.
+type DockerClient struct {
+	http *http.Client
+	// stream has no timeout, for long-lived responses
+	stream *http.Client
+}
+
+func NewDockerClient(socketPath string) *DockerClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &DockerClient{
+		http:   &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		stream: &http.Client{Transport: transport},
+	}
+}
+
+// DockerNetwork is the subset of GET /networks/{id} the plugin reads
+type DockerNetwork struct {
+	ID         string
+	Name       string
+	Labels     map[string]string
+	Containers map[string]DockerNetworkContainer
+}
+
+// DockerNetworkContainer is an endpoint listed in a network inspect
+type DockerNetworkContainer struct {
+	// ID is the key of the container in the Containers map
+	ID          string `json:"-"`
+	Name        string
+	EndpointID  string
+	IPv4Address string
+}
+
+func (c *DockerClient) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker API %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("docker API %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// InspectNetwork returns a Docker network and its attached containers
+func (c *DockerClient) InspectNetwork(ctx context.Context, networkID string) (*DockerNetwork, error) {
+	dockerNetwork := &DockerNetwork{}
+	if err := c.get(ctx, "/networks/"+url.PathEscape(networkID), dockerNetwork); err != nil {
+		return nil, err
+	}
+	return dockerNetwork, nil
+}
+
+// ListNetworks returns the networks of the given network drivers. Listed
+// networks do not carry their containers.
+func (c *DockerClient) ListNetworks(ctx context.Context, drivers ...string) ([]DockerNetwork, error) {
+	filters, err := json.Marshal(map[string][]string{"driver": drivers})
+	if err != nil {
+		return nil, err
+	}
+	networks := []DockerNetwork{}
+	if err := c.get(ctx, "/networks?filters="+url.QueryEscape(string(filters)), &networks); err != nil {
+		return nil, err
+	}
+	return networks, nil
+}
+
+// EndpointContainer returns the container of an endpoint and its network name
+func (c *DockerClient) EndpointContainer(ctx context.Context, networkID string, endpointID string) (DockerNetworkContainer, string, bool, error) {
+	dockerNetwork, err := c.InspectNetwork(ctx, networkID)
+	if err != nil {
+		return DockerNetworkContainer{}, "", false, err
+	}
+	for id, container := range dockerNetwork.Containers {
+		if container.EndpointID == endpointID {
+			container.ID = id
+			return container, dockerNetwork.Name, true, nil
+		}
+	}
+	return DockerNetworkContainer{}, dockerNetwork.Name, false, nil
+}
+
+// DockerContainer is the subset of GET /containers/{id}/json the plugin reads
+type DockerContainer struct {
+	ID     string
+	Name   string
+	Config struct {
+		Labels map[string]string
+	}
+	State struct {
+		// Health is nil for containers without a health check
+		Health *struct {
+			Status string
+		}
+	}
+	NetworkSettings struct {
+		// Networks is keyed by network name
+		Networks map[string]DockerEndpointSettings
+	}
+}
+
+// DockerEndpointSettings is an endpoint of a container
+type DockerEndpointSettings struct {
+	NetworkID  string
+	EndpointID string
+}
+
+// InspectContainer returns a container's details
+func (c *DockerClient) InspectContainer(ctx context.Context, containerID string) (*DockerContainer, error) {
+	container := &DockerContainer{}
+	if err := c.get(ctx, "/containers/"+url.PathEscape(containerID)+"/json", container); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
+
+// DockerEvent is a message of the Docker events stream
+type DockerEvent struct {
+	Type   string
+	Action string
+	Actor  struct {
+		ID         string
+		Attributes map[string]string
+	}
+	Time int64 `json:"time"`
+}
+
+// Events streams the container events of the given actions since a unix
+// time (0 for new events only) to handle until ctx is cancelled or the
+// stream breaks
+func (c *DockerClient) Events(ctx context.Context, since int64, actions []string, handle func(DockerEvent)) error {
+	filters, err := json.Marshal(map[string][]string{"type": {"container"}, "event": actions})
+	if err != nil {
+		return err
+	}
+	path := "/events?filters=" + url.QueryEscape(string(filters))
+	if since > 0 {
+		path += fmt.Sprintf("&since=%d", since)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker API /events: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("docker API /events: %s", resp.Status)
+	}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event DockerEvent
+		if err := decoder.Decode(&event); err != nil {
+			return fmt.Errorf("docker API /events: %w", err)
+		}
+		handle(event)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// dockerEventActions are the container events changing what Join recorded
+var dockerEventActions = []string{"rename", "update", "health_status"}
+
+// DockerEventWatcher follows the Docker events stream and refreshes the
+// logical switch ports of containers changed after they joined
+type DockerEventWatcher struct {
+	driver *OVNDriver
+	// since is the time of the last event handled, to resume after the
+	// stream broke without missing events
+	since int64
+}
+
+// NewDockerEventWatcher creates a watcher of the driver's Docker client
+func NewDockerEventWatcher(d *OVNDriver) *DockerEventWatcher {
+	return &DockerEventWatcher{driver: d.background()}
+}
+
+// Run follows the events stream until ctx is cancelled, reconnecting with
+// backoff while the Docker daemon is unavailable
+func (w *DockerEventWatcher) Run(ctx context.Context) {
+	retry := backoff.NewExponentialBackOff()
+	retry.MaxElapsedTime = 0
+	retry.MaxInterval = time.Minute
+
+	for {
+		connected := time.Now()
+		err := w.driver.docker.Events(ctx, w.since, dockerEventActions, w.handle)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(connected) > retry.MaxInterval {
+			retry.Reset()
+		}
+		wait := retry.NextBackOff()
+		log.Printf("Warning: Docker events stream interrupted, reconnecting in %s: %v", wait.Round(time.Second), err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (w *DockerEventWatcher) handle(event DockerEvent) {
+	w.since = event.Time
+	action, _, _ := strings.Cut(event.Action, ":")
+	if err := w.driver.refreshContainer(event.Actor.ID, action); err != nil {
+		log.Printf("Warning: failed to refresh container %s after %s: %v", event.Actor.ID[:12], action, err)
+	}
+}
+
+// refreshContainer updates the ports of a container's endpoints on networks
+// of this driver after a Docker event
+func (d *OVNDriver) refreshContainer(containerID string, action string) error {
+	container, err := d.docker.InspectContainer(d.ovn.ctx, containerID)
+	if err != nil {
+		return err
+	}
+	for networkName, settings := range container.NetworkSettings.Networks {
+		portName := d.portName(settings.EndpointID, settings.NetworkID)
+		lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
+		if err != nil {
+			return err
+		}
+		if !found || lsp.ExternalIDs["docker:endpoint"] != settings.EndpointID {
+			// Not an endpoint of this driver
+			continue
+		}
+
+		if err := d.labelPort(settings.NetworkID, portName, container); err != nil {
+			return err
+		}
+		if action == "update" && d.ovs != nil {
+			vethName := d.endpointVeth(lsp)
+			if err := d.applyIngressPolicing(vethName, container.Config.Labels); err != nil {
+				log.Printf("Warning: failed to apply ingress policing to %s: %v", vethName, err)
+			}
+		}
+		if oldFQDN := lsp.ExternalIDs["docker:dns_name"]; d.dns != nil && oldFQDN != "" && len(lsp.Addresses) > 0 {
+			fqdn := d.dns.Name(container.Name, networkName)
+			fields := strings.Fields(lsp.Addresses[0])
+			if fqdn == oldFQDN || len(fields) < 2 {
+				continue
+			}
+			if err := d.dns.Rename(oldFQDN, fqdn, fields[1]); err != nil {
+				log.Printf("Warning: failed to rename DNS record %s: %v", oldFQDN, err)
+				continue
+			}
+			d.recordDNSName(portName, fqdn)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/docker/go-plugins-helpers/network"
+)
+
+// pluginDriverName is the driver name Docker gives a plugin found through its
+// socket, the socket file name without extension
+func pluginDriverName(socketPath string) string {
+	return strings.TrimSuffix(filepath.Base(socketPath), filepath.Ext(socketPath))
+}
+
+// validateDockerState removes the networks deleted while the plugin was down
+// and refreshes the Docker metadata of the others, in the background
+func (d *OVNDriver) validateDockerState(driverNames []string) {
+	systemID, err := d.systemID()
+	if err != nil || systemID == "" {
+		log.Printf("Warning: skipping Docker state validation, no chassis system-id to tell this host's networks apart")
+		return
+	}
+
+	retry := backoff.NewExponentialBackOff()
+	retry.MaxElapsedTime = 5 * time.Minute
+	var dockerNetworks []DockerNetwork
+	err = backoff.Retry(func() error {
+		dockerNetworks, err = d.docker.ListNetworks(d.ovn.ctx, driverNames...)
+		return err
+	}, backoff.WithContext(retry, d.ovn.ctx))
+	if err != nil {
+		log.Printf("Warning: skipping Docker state validation: %v", err)
+		return
+	}
+	known := make(map[string]*DockerNetwork, len(dockerNetworks))
+	for i := range dockerNetworks {
+		known[dockerNetworks[i].ID] = &dockerNetworks[i]
+	}
+
+	switches, err := d.ovn.ListDockerLogicalSwitches()
+	if err != nil {
+		log.Printf("Warning: skipping Docker state validation: %v", err)
+		return
+	}
+	removed, refreshed := 0, 0
+	for i := range switches {
+		ls := &switches[i]
+		for _, networkID := range switchNetworkIDs(ls) {
+			// Other hosts validate their own attachments
+			if ls.OtherConfig[networkOtherConfigKey(networkID)] != systemID {
+				continue
+			}
+			if dockerNetwork, ok := known[networkID]; ok {
+				if err := d.updateSwitchMetadata(networkID, dockerNetwork); err != nil {
+					log.Printf("Warning: failed to refresh Docker metadata of network %s: %v", networkID[:12], err)
+					continue
+				}
+				refreshed++
+				continue
+			}
+			log.Printf("Docker network %s of logical switch %s no longer exists, removing it", networkID[:12], ls.Name)
+			if err := d.DeleteNetwork(&network.DeleteNetworkRequest{NetworkID: networkID}); err != nil {
+				log.Printf("Warning: failed to remove network %s: %v", networkID[:12], err)
+				continue
+			}
+			removed++
+		}
+	}
+	log.Printf("Validated OVN state against Docker: %d networks refreshed, %d removed", refreshed, removed)
+}
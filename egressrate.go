@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// egressRateOption caps what a localnet network sends to the physical
+// network from each chassis, through the qos_max_rate of its localnet port
+const egressRateOption = "ovn.egress_rate"
+
+// rateUnits are the tc style suffixes of a rate, in bit/s
+var rateUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"gbit", 1000 * 1000 * 1000},
+	{"mbit", 1000 * 1000},
+	{"kbit", 1000},
+	{"bit", 1},
+}
+
+// parseRate parses a rate such as 1gbit, 500mbit or 64kbit into bit/s
+func parseRate(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range rateUnits {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, multiplier = number, unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("expected a positive rate")
+	}
+	return n * multiplier, nil
+}
+
+func validateRate(value string) error {
+	_, err := parseRate(value)
+	return err
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	for value, want := range map[string]int64{
+		"1gbit":    1000000000,
+		" 500Mbit": 500000000,
+		"64kbit":   64000,
+		"1200":     1200,
+		"9bit":     9,
+	} {
+		if got, err := parseRate(value); err != nil || got != want {
+			t.Errorf("parseRate(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "0", "-5mbit", "fast", "1.5gbit", "10mb", "9223372036854775807kbit", "10000000000gbit"} {
+		if got, err := parseRate(value); err == nil {
+			t.Errorf("parseRate(%q) = %d, want an error", value, got)
+		}
+	}
+}
+
+func TestEgressRateNeedsLocalnet(t *testing.T) {
+	var driverErr *DriverError
+	_, err := parseNetworkOptions(genericOptions(map[string]interface{}{egressRateOption: "10mbit"}))
+	if !errors.As(err, &driverErr) || driverErr.Code != ErrInvalidOption {
+		t.Errorf("egress rate without localnet: error %v, want %s", err, ErrInvalidOption)
+	}
+
+	opts, err := parseNetworkOptions(genericOptions(map[string]interface{}{egressRateOption: "10mbit", localnetOption: "physnet1"}))
+	if err != nil || opts.EgressRate != 10000000 {
+		t.Errorf("parseNetworkOptions() = %d bit/s, %v, want 10000000", opts.EgressRate, err)
+	}
+}
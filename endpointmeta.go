@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// legacyEndpointKeyPrefix prefixes the endpoint metadata older releases kept
+// in the switch other_config
+const legacyEndpointKeyPrefix = "docker:endpoint:"
+
+// endpointMetadata returns the port external_ids recording an endpoint's
+// addresses
+func endpointMetadata(macAddr string, ipAddr string, addressPairs []string) map[string]string {
+	values := map[string]string{
+		"docker:mac": macAddr,
+		"docker:ip":  ipAddr,
+	}
+	if len(addressPairs) > 0 {
+		values["docker:address_pairs"] = strings.Join(addressPairs, ",")
+	}
+	return values
+}
+
+// legacyEndpointKeys returns the other_config keys an older release stored on
+// a switch, by endpoint ID
+func legacyEndpointKeys(ls *LogicalSwitch) map[string]map[string]string {
+	endpoints := map[string]map[string]string{}
+	for key, value := range ls.OtherConfig {
+		rest, ok := strings.CutPrefix(key, legacyEndpointKeyPrefix)
+		if !ok {
+			continue
+		}
+		endpointID, suffix, ok := strings.Cut(rest, ":")
+		if !ok {
+			continue
+		}
+		if endpoints[endpointID] == nil {
+			endpoints[endpointID] = map[string]string{}
+		}
+		endpoints[endpointID][suffix] = value
+	}
+	return endpoints
+}
+
+// endpointAddresses returns the MAC and IP recorded for an endpoint, falling
+// back to the switch other_config of a release that has not been migrated
+func (d *OVNDriver) endpointAddresses(ls *LogicalSwitch, endpointID string, portName string) (string, string, error) {
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil {
+		return "", "", err
+	}
+	if found && lsp.ExternalIDs["docker:mac"] != "" {
+		return lsp.ExternalIDs["docker:mac"], lsp.ExternalIDs["docker:ip"], nil
+	}
+	legacy := legacyEndpointKeys(ls)[endpointID]
+	return legacy["mac"], legacy["ip"], nil
+}
+
+// deleteLegacyEndpointMetadataOps removes the other_config keys of an endpoint
+// left by an older release, if any
+func (d *OVNDriver) deleteLegacyEndpointMetadataOps(ls *LogicalSwitch, endpointID string) ([]ovsdb.Operation, error) {
+	keys := []string{}
+	for suffix := range legacyEndpointKeys(ls)[endpointID] {
+		keys = append(keys, legacyEndpointKeyPrefix+endpointID+":"+suffix)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return d.ovn.DeleteLogicalSwitchOtherConfigKeysOp(ls, keys)
+}
+
+// migrateEndpointMetadata copies the endpoint metadata older releases kept in
+// switch other_config to the endpoint ports and removes it from the switches.
+// Keys of endpoints without a port were leaked by a crash and are dropped.
+func (d *OVNDriver) migrateEndpointMetadata() {
+	switches, err := d.ovn.ListDockerLogicalSwitches()
+	if err != nil {
+		log.Printf("Warning: failed to list switches for endpoint metadata migration: %v", err)
+		return
+	}
+	for i := range switches {
+		ls := &switches[i]
+		endpoints := legacyEndpointKeys(ls)
+		if len(endpoints) == 0 {
+			continue
+		}
+		if err := d.migrateSwitchEndpointMetadata(ls, endpoints); err != nil {
+			log.Printf("Warning: failed to migrate endpoint metadata of switch %s: %v", ls.Name, err)
+			continue
+		}
+		log.Printf("Migrated metadata of %d endpoints of switch %s to their ports", len(endpoints), ls.Name)
+	}
+}
+
+func (d *OVNDriver) migrateSwitchEndpointMetadata(ls *LogicalSwitch, endpoints map[string]map[string]string) error {
+	ports, err := d.ovn.ListLogicalSwitchPorts(ls)
+	if err != nil {
+		return err
+	}
+
+	ops := []ovsdb.Operation{}
+	keys := []string{}
+	for endpointID, values := range endpoints {
+		for suffix := range values {
+			keys = append(keys, legacyEndpointKeyPrefix+endpointID+":"+suffix)
+		}
+		for i := range ports {
+			lsp := &ports[i]
+			if lsp.ExternalIDs["docker:endpoint"] != endpointID || lsp.ExternalIDs["docker:mac"] != "" {
+				continue
+			}
+			metadata := map[string]string{}
+			for suffix, value := range values {
+				metadata["docker:"+suffix] = value
+			}
+			portOps, err := d.ovn.UpdateLogicalSwitchPortExternalIDsOp(lsp, metadata)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, portOps...)
+		}
+	}
+
+	deleteOps, err := d.ovn.DeleteLogicalSwitchOtherConfigKeysOp(ls, keys)
+	if err != nil {
+		return err
+	}
+	results, err := d.ovn.Transact(append(ops, deleteOps...)...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to move endpoint metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLegacyEndpointKeys(t *testing.T) {
+	ls := &LogicalSwitch{OtherConfig: map[string]string{
+		"subnet":                            "172.16.0.0/16",
+		"docker:network":                    "0123456789ab",
+		"docker:endpoint:ep1:mac":           "02:00:00:00:00:01",
+		"docker:endpoint:ep1:ip":            "172.16.0.2",
+		"docker:endpoint:ep1:address_pairs": "00:00:5e:00:01:01 172.16.0.100",
+		"docker:endpoint:ep2:mac":           "02:00:00:00:00:02",
+		"docker:endpoint:ep3":               "truncated",
+	}}
+	want := map[string]map[string]string{
+		"ep1": {"mac": "02:00:00:00:00:01", "ip": "172.16.0.2", "address_pairs": "00:00:5e:00:01:01 172.16.0.100"},
+		"ep2": {"mac": "02:00:00:00:00:02"},
+	}
+	if got := legacyEndpointKeys(ls); !reflect.DeepEqual(got, want) {
+		t.Errorf("legacyEndpointKeys() = %v, want %v", got, want)
+	}
+}
+
+// The port external_ids written for a new endpoint use the suffixes of the
+// legacy switch keys, which is what lets migrateEndpointMetadata copy them
+func TestEndpointMetadataMatchesLegacyLayout(t *testing.T) {
+	pairs := []string{"00:00:5e:00:01:01 172.16.0.100"}
+	metadata := endpointMetadata("02:00:00:00:00:01", "172.16.0.2", pairs)
+
+	legacy := map[string]string{}
+	for key, value := range metadata {
+		legacy[legacyEndpointKeyPrefix+"ep1:"+strings.TrimPrefix(key, "docker:")] = value
+	}
+	migrated := map[string]string{}
+	for suffix, value := range legacyEndpointKeys(&LogicalSwitch{OtherConfig: legacy})["ep1"] {
+		migrated["docker:"+suffix] = value
+	}
+	if !reflect.DeepEqual(migrated, metadata) {
+		t.Errorf("migrated metadata = %v, want %v", migrated, metadata)
+	}
+
+	if _, ok := endpointMetadata("02:00:00:00:00:01", "172.16.0.2", nil)["docker:address_pairs"]; ok {
+		t.Error("endpointMetadata() recorded empty address pairs")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ovn-org/libovsdb/client"
+)
+
+// ErrorCode classifies driver errors for tooling above Docker. Docker only
+// passes the message on, so the code is appended to it as " [ovn:<code>]";
+// errors wrapping a coded error keep it at the end of the message.
+type ErrorCode string
+
+const (
+	// ErrInvalidOption: a driver option or label is unknown, malformed or
+	// conflicts with another one
+	ErrInvalidOption ErrorCode = "INVALID_OPTION"
+	// ErrSubnetConflict: the subnet or shared network is already in use
+	ErrSubnetConflict ErrorCode = "SUBNET_CONFLICT"
+	// ErrNetworkNotFound: the logical switch of a network is missing
+	ErrNetworkNotFound ErrorCode = "NETWORK_NOT_FOUND"
+	// ErrIPInUse: an address is used by another port of the switch
+	ErrIPInUse ErrorCode = "IP_IN_USE"
+	// ErrOVSDBUnavailable: the OVN NB database could not be reached
+	ErrOVSDBUnavailable ErrorCode = "OVSDB_UNAVAILABLE"
+	// ErrBindingTimeout: OVN did not complete a port binding, such as the
+	// assignment of a dynamic address, in time
+	ErrBindingTimeout ErrorCode = "BINDING_TIMEOUT"
+	// ErrDraining: the plugin is draining ahead of an upgrade and does not
+	// create networks or endpoints; retryable once it is back
+	ErrDraining ErrorCode = "DRAINING"
+	// ErrTunnelKeyConflict: the requested tunnel key is used by another
+	// logical switch
+	ErrTunnelKeyConflict ErrorCode = "TUNNEL_KEY_CONFLICT"
+	// ErrUplinkDown: no NIC of the provider uplink of a localnet network
+	// has link
+	ErrUplinkDown ErrorCode = "UPLINK_DOWN"
+)
+
+// DriverError is an error with a stable code
+type DriverError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *DriverError) Error() string {
+	return fmt.Sprintf("%v [ovn:%s]", e.Err, e.Code)
+}
+
+func (e *DriverError) Unwrap() error {
+	return e.Err
+}
+
+// codedErrorf formats a new error with a code
+func codedErrorf(code ErrorCode, format string, args ...interface{}) error {
+	return &DriverError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// unavailableError codes the errors of a database that cannot be reached
+func unavailableError(err error) error {
+	if errors.Is(err, client.ErrNotConnected) || errors.Is(err, context.DeadlineExceeded) {
+		return &DriverError{Code: ErrOVSDBUnavailable, Err: err}
+	}
+	return err
+}
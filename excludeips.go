@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// excludeIPsOtherConfigKey is the switch other_config key OVN's native IPAM
+// reads reserved addresses from, in the same "ip ip..ip" format
+const excludeIPsOtherConfigKey = "exclude_ips"
+
+// ipRange is an inclusive range of IPv4 addresses
+type ipRange struct {
+	first net.IP
+	last  net.IP
+}
+
+func (r ipRange) contains(ip net.IP) bool {
+	return bytes.Compare(ip, r.first) >= 0 && bytes.Compare(ip, r.last) <= 0
+}
+
+func (r ipRange) String() string {
+	if r.first.Equal(r.last) {
+		return r.first.String()
+	}
+	return r.first.String() + ".." + r.last.String()
+}
+
+// parseExcludeIPs parses space or comma separated addresses and first..last
+// ranges
+func parseExcludeIPs(value string) ([]ipRange, error) {
+	ranges := []ipRange{}
+	for _, entry := range splitOptionList(value) {
+		firstStr, lastStr, isRange := strings.Cut(entry, "..")
+		if !isRange {
+			lastStr = firstStr
+		}
+		first := net.ParseIP(firstStr).To4()
+		last := net.ParseIP(lastStr).To4()
+		if first == nil || last == nil {
+			return nil, fmt.Errorf("invalid IPv4 address or range %q", entry)
+		}
+		if bytes.Compare(first, last) > 0 {
+			return nil, fmt.Errorf("invalid range %q: %s is after %s", entry, firstStr, lastStr)
+		}
+		ranges = append(ranges, ipRange{first: first, last: last})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no addresses given")
+	}
+	return ranges, nil
+}
+
+// formatExcludeIPs returns ranges in the space separated form OVN uses
+func formatExcludeIPs(ranges []ipRange) string {
+	entries := make([]string, len(ranges))
+	for i, r := range ranges {
+		entries[i] = r.String()
+	}
+	return strings.Join(entries, " ")
+}
+
+// checkExcludeIPsInSubnet makes sure every reserved address is part of subnet
+func checkExcludeIPsInSubnet(ranges []ipRange, subnet string) error {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet %s: %w", subnet, err)
+	}
+	for _, r := range ranges {
+		if !ipNet.Contains(r.first) || !ipNet.Contains(r.last) {
+			return codedErrorf(ErrInvalidOption, "excluded addresses %s are not in subnet %s", r, subnet)
+		}
+	}
+	return nil
+}
+
+// checkIPNotExcluded rejects an endpoint address reserved on its switch
+func checkIPNotExcluded(ls *LogicalSwitch, ipAddr string) error {
+	value := ls.OtherConfig[excludeIPsOtherConfigKey]
+	if value == "" {
+		return nil
+	}
+	ranges, err := parseExcludeIPs(value)
+	if err != nil {
+		return fmt.Errorf("logical switch %s has invalid %s: %w", ls.Name, excludeIPsOtherConfigKey, err)
+	}
+	ip := net.ParseIP(ipAddr).To4()
+	if ip == nil {
+		return nil
+	}
+	for _, r := range ranges {
+		if r.contains(ip) {
+			return codedErrorf(ErrIPInUse, "IP address %s is reserved by %s %s on logical switch %s", ipAddr, excludeIPsOption, r, ls.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+)
+
+// commandError is the failure of an external command together with what it
+// printed, usually the reason the kernel rejected the change
+type commandError struct {
+	command string
+	err     error
+	output  string
+}
+
+func (e *commandError) Error() string {
+	if e.output == "" {
+		return fmt.Sprintf("%s: %v", e.command, e.err)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.command, e.err, e.output)
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// runCommand runs an external command and returns its stdout. A failure
+// names the command and carries its stderr, or its stdout if stderr is empty.
+func runCommand(name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(stderr.String())
+		if output == "" {
+			output = strings.TrimSpace(stdout.String())
+		}
+		return "", &commandError{command: strings.Join(cmd.Args, " "), err: err, output: output}
+	}
+	return stdout.String(), nil
+}
+
+// cleanupCommand runs a best-effort external command, such as removing an
+// interface that may already be gone, and only logs its failure
+func cleanupCommand(name string, args ...string) {
+	if _, err := runCommand(name, args...); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
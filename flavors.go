@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/network"
+	"gopkg.in/yaml.v3"
+)
+
+// Flavor is an additional driver name applying the network options of
+// <flavors_dir>/<name>.yaml
+type Flavor struct {
+	Name    string
+	Options map[string]string
+}
+
+// loadFlavors reads and validates the flavors of dir, none when dir is empty
+func loadFlavors(dir string, driverName string) ([]Flavor, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	flavors := []Flavor{}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".yaml")
+		if validateName(name) != nil || name == driverName {
+			return nil, fmt.Errorf("invalid flavor name %q: it must differ from %s and be a valid driver name", name, driverName)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read flavor %s: %w", name, err)
+		}
+		options := map[string]string{}
+		if err := yaml.Unmarshal(data, &options); err != nil {
+			return nil, fmt.Errorf("failed to parse flavor %s: %w", name, err)
+		}
+		generic := make(map[string]interface{}, len(options))
+		for key, value := range options {
+			if !strings.HasPrefix(key, driverOptionPrefix) {
+				return nil, fmt.Errorf("flavor %s: %s is not a network option of the plugin", name, key)
+			}
+			generic[key] = value
+		}
+		if err := validateOptions("network option", generic, networkOptionSpecs); err != nil {
+			return nil, fmt.Errorf("flavor %s: %w", name, err)
+		}
+		flavors = append(flavors, Flavor{Name: name, Options: options})
+	}
+	return flavors, nil
+}
+
+// driverNames returns the main driver name followed by those of the flavors
+func driverNames(driverName string, flavors []Flavor) []string {
+	names := []string{driverName}
+	for _, flavor := range flavors {
+		names = append(names, flavor.Name)
+	}
+	return names
+}
+
+// withOptions returns a create request with the flavor's options added;
+// options given with -o take precedence
+func (f *Flavor) withOptions(r *network.CreateNetworkRequest) *network.CreateNetworkRequest {
+	if f == nil || len(f.Options) == 0 {
+		return r
+	}
+	options := make(map[string]interface{}, len(r.Options)+1)
+	for key, value := range r.Options {
+		options[key] = value
+	}
+	given, _ := r.Options["com.docker.network.generic"].(map[string]interface{})
+	generic := make(map[string]interface{}, len(given)+len(f.Options))
+	for key, value := range f.Options {
+		generic[key] = value
+	}
+	for key, value := range given {
+		generic[key] = value
+	}
+	options["com.docker.network.generic"] = generic
+	flavored := *r
+	flavored.Options = options
+	return &flavored
+}
+
+// serveFlavors serves each flavor on its own socket next to the main one
+func serveFlavors(driver *OVNDriver, flavors []Flavor, cfg SocketConfig) {
+	for i := range flavors {
+		flavor := &flavors[i]
+		socket := cfg
+		socket.Path = filepath.Join(filepath.Dir(cfg.Path), flavor.Name+".sock")
+		listener, err := listenPluginSocket(socket)
+		if err != nil {
+			log.Fatalf("Failed to create socket of flavor %s: %v", flavor.Name, err)
+		}
+		log.Printf("Starting OVN plugin flavor %s on %s", flavor.Name, socket.Path)
+		go func() {
+			if err := newPluginHandler(driver, flavor).Serve(listener); err != nil {
+				log.Fatalf("Failed to serve flavor %s: %v", flavor.Name, err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+// floodOtherConfig maps the flood control options of a network to the
+// logical switch other_config keys ovn-northd reads
+var floodOtherConfig = map[string]string{
+	// IGMP/MLD snooping: multicast only goes to ports that joined the group
+	"ovn.mcast_snoop": "mcast_snoop",
+	// With snooping, whether unregistered multicast is still flooded
+	"ovn.mcast_flood_unregistered": "mcast_flood_unregistered",
+	// Whether ARP requests for router IPs are broadcast to every router port
+	"ovn.broadcast_arps_to_all_routers": "broadcast-arps-to-all-routers",
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/network"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// hostAccessOption gives every host of a network a management port: an OVS
+// internal interface on the network's switch with an address of its subnet,
+// so the host reaches containers without external routing
+const hostAccessOption = "ovn.host_access"
+
+// hostAccessAuxPrefix names the --aux-address entries reserved for the
+// management ports; Docker IPAM never hands them to containers
+const hostAccessAuxPrefix = "ovn-host"
+
+// managementPortName returns the logical switch port of a host's management
+// port on a switch
+func managementPortName(switchName string, node string) string {
+	return "mp-" + shortHash(node) + "-" + switchName
+}
+
+// managementIfaceName returns the host interface of the management port of a
+// switch, within the 15 characters of a Linux interface name
+func managementIfaceName(switchName string) string {
+	return "ovnmp" + shortHash(switchName)
+}
+
+func shortHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// hostAccessAddresses returns the aux addresses reserved for management
+// ports, ordered by name
+func hostAccessAddresses(ipamData []*network.IPAMData) []string {
+	names := []string{}
+	addrs := map[string]string{}
+	for _, ipam := range ipamData {
+		for name, value := range ipam.AuxAddresses {
+			addr, ok := value.(string)
+			if !ok || !strings.HasPrefix(name, hostAccessAuxPrefix) {
+				continue
+			}
+			if ip, _, err := net.ParseCIDR(addr); err == nil {
+				addr = ip.String()
+			}
+			names = append(names, name)
+			addrs[name] = addr
+		}
+	}
+	sort.Strings(names)
+	ordered := make([]string, len(names))
+	for i, name := range names {
+		ordered[i] = addrs[name]
+	}
+	return ordered
+}
+
+// ensureManagementPort creates this host's management port on the switch of
+// a network, with the first free reserved address or, on null IPAM networks,
+// one assigned by ovn-northd. A port left by a previous run keeps its address.
+func (d *OVNDriver) ensureManagementPort(networkID string, candidates []string) error {
+	ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(networkID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return codedErrorf(ErrNetworkNotFound, "logical switch for network %s not found", networkID)
+	}
+	node, err := d.nodeName()
+	if err != nil {
+		return err
+	}
+	portName := managementPortName(ls.Name, node)
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil {
+		return err
+	}
+	if !found {
+		if lsp, err = d.createManagementPort(ls, networkID, node, portName, candidates); err != nil {
+			return err
+		}
+	}
+	return d.plugManagementPort(ls, lsp, networkID)
+}
+
+func (d *OVNDriver) createManagementPort(ls *LogicalSwitch, networkID string, node string, portName string, candidates []string) (*LogicalSwitchPort, error) {
+	macAddr := generateMAC(shortHash(portName))
+	dynamic := ls.OtherConfig[subnetOtherConfigKey] != ""
+	address := macAddr + " dynamic"
+	if !dynamic {
+		ipAddr := ""
+		for _, candidate := range candidates {
+			if _, used := d.networks.PortByIP(ls.Name, candidate); !used {
+				ipAddr = candidate
+				break
+			}
+		}
+		if ipAddr == "" {
+			return nil, codedErrorf(ErrIPInUse, "no free address for the management port of %s: reserve one per host with --aux-address %s<n>=<ip>", ls.Name, hostAccessAuxPrefix)
+		}
+		address = macAddr + " " + ipAddr
+	}
+
+	systemID, err := d.systemID()
+	if err != nil {
+		return nil, err
+	}
+	enabled := true
+	lsp := &LogicalSwitchPort{
+		UUID:      newNamedUUID("lsp"),
+		Name:      portName,
+		Addresses: []string{address},
+		Enabled:   &enabled,
+		Options:   map[string]string{"requested-chassis": systemID},
+		ExternalIDs: map[string]string{
+			"docker:host_access": node,
+			"docker:network":     networkID,
+			"docker:switch":      ls.Name,
+		},
+	}
+	ops, err := d.ovn.CreateLogicalSwitchPortOp(lsp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create logical switch port operation: %w", err)
+	}
+	mutateOps, err := d.ovn.MutateLogicalSwitchPortsOp(ls, ovsdb.MutateOperationInsert, []string{lsp.UUID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mutate operation: %w", err)
+	}
+	results, err := d.ovn.Transact(append(ops, mutateOps...)...)
+	if err := transactError(err, results); err != nil {
+		return nil, fmt.Errorf("failed to create management port %s: %w", portName, err)
+	}
+
+	if dynamic {
+		created, ipAddr, err := d.ovn.waitDynamicAddress(portName)
+		if err != nil {
+			return nil, err
+		}
+		// Pinned like endpoint addresses, so ovn-northd keeps it reserved
+		ops, err := d.ovn.UpdateLogicalSwitchPortAddressesOp(created, []string{macAddr + " " + ipAddr}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create update operation for logical switch port: %w", err)
+		}
+		results, err := d.ovn.Transact(ops...)
+		if err := transactError(err, results); err != nil {
+			return nil, fmt.Errorf("failed to pin address %s of %s: %w", ipAddr, portName, err)
+		}
+	}
+
+	created, found, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("management port %s disappeared", portName)
+	}
+	return created, nil
+}
+
+// plugManagementPort creates the internal interface of a management port and
+// gives it the port's MAC and address. It is idempotent, so it also restores
+// the interface after a reboot.
+func (d *OVNDriver) plugManagementPort(ls *LogicalSwitch, lsp *LogicalSwitchPort, networkID string) error {
+	fields := strings.Fields(lsp.Addresses[0])
+	if len(fields) < 2 {
+		return fmt.Errorf("management port %s has no address", lsp.Name)
+	}
+	_, subnet, err := net.ParseCIDR(ls.OtherConfig["docker:subnet"])
+	if err != nil {
+		return fmt.Errorf("invalid subnet of %s: %w", ls.Name, err)
+	}
+	prefixLen, _ := subnet.Mask.Size()
+
+	ifaceName := managementIfaceName(ls.Name)
+	if _, found, err := d.ovs.GetInterface(ifaceName); err != nil {
+		return err
+	} else if !found {
+		if err := d.ovs.AddInternalPort(d.bridgeFor(networkID), ifaceName, lsp.Name); err != nil {
+			return err
+		}
+	}
+	if _, err := runCommand("ip", "link", "set", "dev", ifaceName, "address", fields[0]); err != nil {
+		return fmt.Errorf("failed to set MAC address of %s: %w", ifaceName, err)
+	}
+	if _, err := runCommand("ip", "addr", "replace", fmt.Sprintf("%s/%d", fields[1], prefixLen), "dev", ifaceName); err != nil {
+		return fmt.Errorf("failed to set address of %s: %w", ifaceName, err)
+	}
+	if _, err := runCommand("ip", "link", "set", "dev", ifaceName, "up"); err != nil {
+		return fmt.Errorf("failed to bring up %s: %w", ifaceName, err)
+	}
+	if ls.OtherConfig["docker:host_masquerade"] == "true" {
+		if err := ensureMasquerade(ifaceName, subnet.String(), fields[1]); err != nil {
+			return err
+		}
+	}
+	d.logf("Management port %s of %s has address %s/%d", ifaceName, ls.Name, fields[1], prefixLen)
+	return nil
+}
+
+// removeManagementPort deletes this host's management port from a switch, if
+// it has one
+func (d *OVNDriver) removeManagementPort(ls *LogicalSwitch, node string) {
+	portName := managementPortName(ls.Name, node)
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil || !found {
+		return
+	}
+	if fields := strings.Fields(lsp.Addresses[0]); len(fields) > 1 {
+		if _, subnet, err := net.ParseCIDR(ls.OtherConfig["docker:subnet"]); err == nil {
+			removeMasquerade(managementIfaceName(ls.Name), subnet.String(), fields[1])
+		}
+	}
+	ops, err := d.deleteLogicalSwitchPortOps(ls, portName)
+	if err == nil {
+		results, txnErr := d.ovn.Transact(ops...)
+		err = transactError(txnErr, results)
+	}
+	if err != nil {
+		d.logf("Warning: failed to delete management port %s: %v", portName, err)
+	}
+	if d.ovs != nil {
+		if err := d.ovs.RemovePort(d.bridge, managementIfaceName(ls.Name)); err != nil {
+			d.logf("Warning: failed to remove management interface of %s: %v", ls.Name, err)
+		}
+	}
+}
+
+// restoreManagementPorts plugs the management ports of this host back in at
+// startup; their internal interfaces and addresses do not survive a reboot
+func (d *OVNDriver) restoreManagementPorts() {
+	if d.ovs == nil {
+		return
+	}
+	node, err := d.nodeName()
+	if err != nil {
+		log.Printf("Warning: failed to restore management ports: %v", err)
+		return
+	}
+	switches, err := d.ovn.ListDockerLogicalSwitches()
+	if err != nil {
+		log.Printf("Warning: failed to restore management ports: %v", err)
+		return
+	}
+	for i := range switches {
+		ls := &switches[i]
+		lsp, found, err := d.ovn.GetLogicalSwitchPort(managementPortName(ls.Name, node))
+		if err != nil || !found {
+			continue
+		}
+		if err := d.plugManagementPort(ls, lsp, lsp.ExternalIDs["docker:network"]); err != nil {
+			log.Printf("Warning: failed to restore management port of %s: %v", ls.Name, err)
+		}
+	}
+}
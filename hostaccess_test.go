@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/network"
+)
+
+func TestHostAccessAddresses(t *testing.T) {
+	ipamData := []*network.IPAMData{
+		{Pool: "172.16.0.0/16", AuxAddresses: map[string]interface{}{
+			"ovn-host2": "172.16.0.12",
+			"router":    "172.16.0.254",
+			"ovn-host1": "172.16.0.11/16",
+			"ovn-host3": 42,
+		}},
+		{Pool: "172.17.0.0/16", AuxAddresses: map[string]interface{}{
+			"ovn-host0": "172.17.0.10",
+		}},
+	}
+	// Hosts take reserved addresses in name order, so the order must not
+	// depend on map iteration
+	want := []string{"172.17.0.10", "172.16.0.11", "172.16.0.12"}
+	for i := 0; i < 5; i++ {
+		if got := hostAccessAddresses(ipamData); !reflect.DeepEqual(got, want) {
+			t.Fatalf("hostAccessAddresses() = %q, want %q", got, want)
+		}
+	}
+
+	if got := hostAccessAddresses([]*network.IPAMData{{Pool: "172.16.0.0/16"}}); len(got) != 0 {
+		t.Errorf("hostAccessAddresses() = %q without aux addresses", got)
+	}
+}
+
+func TestManagementIfaceName(t *testing.T) {
+	a := managementIfaceName("docker-0123456789abcdef0123456789abcdef")
+	b := managementIfaceName("docker-0123456789abcdef0123456789abcdee")
+	if len(a) > 15 {
+		t.Errorf("interface name %q is longer than IFNAMSIZ allows", a)
+	}
+	if a == b {
+		t.Errorf("switches differing in their last character share interface %q", a)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// InventoryNetwork is a Docker network and the OVN objects backing it
+type InventoryNetwork struct {
+	NetworkID string              `json:"network_id"`
+	Name      string              `json:"name,omitempty"`
+	Switch    string              `json:"logical_switch"`
+	Subnet    string              `json:"subnet,omitempty"`
+	Gateway   string              `json:"gateway,omitempty"`
+	Endpoints []InventoryEndpoint `json:"endpoints"`
+}
+
+// InventoryEndpoint is a Docker endpoint, its logical switch port and, when
+// joined on this host, its OVS port
+type InventoryEndpoint struct {
+	EndpointID   string   `json:"endpoint_id"`
+	Container    string   `json:"container,omitempty"`
+	Port         string   `json:"logical_switch_port"`
+	MAC          string   `json:"mac,omitempty"`
+	IP           string   `json:"ip,omitempty"`
+	AddressPairs []string `json:"address_pairs,omitempty"`
+	Joined       bool     `json:"joined"`
+	Chassis      string   `json:"chassis,omitempty"`
+	OVSPort      string   `json:"ovs_port,omitempty"`
+}
+
+// inventory maps the Docker networks and endpoints known to OVN onto their
+// switches, ports and local OVS ports. Switches shared by several networks
+// are listed once per network.
+func (d *OVNDriver) inventory() ([]InventoryNetwork, error) {
+	switches, err := d.ovn.ListDockerLogicalSwitches()
+	if err != nil {
+		return nil, err
+	}
+	lsps, err := d.ovn.ListDockerLogicalSwitchPorts()
+	if err != nil {
+		return nil, err
+	}
+	endpoints := map[string][]InventoryEndpoint{}
+	for _, lsp := range lsps {
+		networkID := lsp.ExternalIDs["docker:network"]
+		endpoints[networkID] = append(endpoints[networkID], d.inventoryEndpoint(&lsp))
+	}
+
+	networks := []InventoryNetwork{}
+	for _, ls := range switches {
+		for _, networkID := range switchNetworkIDs(&ls) {
+			network := InventoryNetwork{
+				NetworkID: networkID,
+				Switch:    ls.Name,
+				Subnet:    ls.OtherConfig["docker:subnet"],
+				Gateway:   ls.OtherConfig["docker:gateway"],
+				Endpoints: endpoints[networkID],
+			}
+			if ls.ExternalIDs["docker:network"] == networkID {
+				network.Name = ls.ExternalIDs["docker:network_name"]
+			}
+			if network.Endpoints == nil {
+				network.Endpoints = []InventoryEndpoint{}
+			}
+			sort.Slice(network.Endpoints, func(i, j int) bool {
+				return network.Endpoints[i].EndpointID < network.Endpoints[j].EndpointID
+			})
+			networks = append(networks, network)
+		}
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].NetworkID < networks[j].NetworkID })
+	return networks, nil
+}
+
+func (d *OVNDriver) inventoryEndpoint(lsp *LogicalSwitchPort) InventoryEndpoint {
+	endpoint := InventoryEndpoint{
+		EndpointID: lsp.ExternalIDs["docker:endpoint"],
+		Container:  lsp.ExternalIDs["docker:container"],
+		Port:       lsp.Name,
+		MAC:        lsp.ExternalIDs["docker:mac"],
+		IP:         lsp.ExternalIDs["docker:ip"],
+		Joined:     lsp.ExternalIDs["docker:sandbox"] != "",
+	}
+	if pairs := lsp.ExternalIDs["docker:address_pairs"]; pairs != "" {
+		endpoint.AddressPairs = strings.Split(pairs, ",")
+	}
+	if d.sb != nil {
+		if status, err := d.sb.GetPortBindingStatus(lsp.Name); err == nil {
+			endpoint.Chassis = status.Hostname
+			if endpoint.Chassis == "" {
+				endpoint.Chassis = status.Chassis
+			}
+		}
+	}
+	if d.ovs != nil && endpoint.Joined {
+		if iface, found, err := d.ovs.GetInterfaceByIfaceID(lsp.Name); err == nil && found {
+			endpoint.OVSPort = iface.Name
+		}
+	}
+	return endpoint
+}
+
+// serveInventory serves the read-only inventory API on addr until the
+// listener fails. It only reads the local caches of the databases.
+func serveInventory(addr string, d *OVNDriver) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/networks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "read-only API"})
+			return
+		}
+		networks, err := d.inventory()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, networks)
+	})
+
+	log.Printf("Serving inventory API on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Warning: inventory API stopped: %v", err)
+	}
+}
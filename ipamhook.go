@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// IPAMHookEvent is sent to the external IPAM hook for every endpoint
+// allocation ("create") and release ("delete")
+type IPAMHookEvent struct {
+	Event      string `json:"event"`
+	NetworkID  string `json:"network_id"`
+	EndpointID string `json:"endpoint_id"`
+	Switch     string `json:"logical_switch"`
+	Port       string `json:"logical_switch_port"`
+	IPAddress  string `json:"ip_address"`
+	MACAddress string `json:"mac_address,omitempty"`
+	Subnet     string `json:"subnet,omitempty"`
+	Gateway    string `json:"gateway,omitempty"`
+}
+
+// IPAMHook registers endpoint allocations in an external IPAM system through
+// an HTTP webhook or a command reading the event on stdin
+type IPAMHook struct {
+	url     string
+	command []string
+	// failClosed makes hook failures fail the Docker request instead of
+	// only being logged
+	failClosed bool
+	timeout    time.Duration
+	http       *http.Client
+}
+
+// NewIPAMHook returns nil when neither a URL nor a command is configured
+func NewIPAMHook(url string, command string, failurePolicy string, timeout time.Duration) (*IPAMHook, error) {
+	if url == "" && command == "" {
+		return nil, nil
+	}
+	if url != "" && command != "" {
+		return nil, fmt.Errorf("configure either an IPAM hook URL or a command, not both")
+	}
+
+	hook := &IPAMHook{
+		url:     url,
+		command: strings.Fields(command),
+		timeout: timeout,
+		http:    &http.Client{Timeout: timeout},
+	}
+	switch failurePolicy {
+	case "", "warn":
+	case "fail":
+		hook.failClosed = true
+	default:
+		return nil, fmt.Errorf("invalid IPAM hook failure policy %q: expected warn or fail", failurePolicy)
+	}
+	return hook, nil
+}
+
+// Notify delivers an event and applies the failure policy to the result
+func (h *IPAMHook) Notify(event IPAMHookEvent) error {
+	err := h.deliver(event)
+	if err == nil {
+		return nil
+	}
+	if h.failClosed {
+		return fmt.Errorf("IPAM hook rejected %s of %s: %w", event.Event, event.IPAddress, err)
+	}
+	log.Printf("Warning: IPAM hook failed for %s of %s: %v", event.Event, event.IPAddress, err)
+	return nil
+}
+
+func (h *IPAMHook) deliver(event IPAMHookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if h.url != "" {
+		resp, err := h.http.Post(h.url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook returned %s", resp.Status)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.command[0], h.command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
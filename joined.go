@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// onContainerJoined runs the Join follow-ups that need the container of the
+// endpoint: labels, ingress policing, address pairs and secondary addresses.
+// Docker only lists the container once the join finished, shortly after the
+// driver call returned, so they run in the background.
+func (d *OVNDriver) onContainerJoined(networkID string, endpointID string, sandboxKey string, portName string, vethName string) {
+	d = d.background()
+	go func() {
+		retry := backoff.NewExponentialBackOff()
+		retry.MaxElapsedTime = time.Minute
+
+		var container *DockerContainer
+		var networkName string
+		err := backoff.Retry(func() error {
+			attached, name, found, err := d.docker.EndpointContainer(d.ovn.ctx, networkID, endpointID)
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("endpoint %s not attached yet", endpointID[:12])
+			}
+			networkName = name
+			container, err = d.docker.InspectContainer(d.ovn.ctx, attached.ID)
+			return err
+		}, backoff.WithContext(retry, d.ovn.ctx))
+		if err != nil {
+			d.logf("Warning: failed to look up the container of endpoint %s: %v", endpointID[:12], err)
+			return
+		}
+
+		if len(d.labels) > 0 {
+			if err := d.labelPort(networkID, portName, container); err != nil {
+				d.logf("Warning: %v", err)
+			}
+		}
+		if err := d.applyIngressPolicing(vethName, container.Config.Labels); err != nil {
+			d.logf("Warning: failed to apply ingress policing to %s: %v", vethName, err)
+		}
+		if pairs, _ := networkLabel(container.Config.Labels, addressPairsLabel, networkName); pairs != "" {
+			if err := d.addLabelAddressPairs(portName, pairs); err != nil {
+				d.logf("Warning: failed to add address pairs of endpoint %s: %v", endpointID[:12], err)
+			}
+		}
+		if addrs, err := secondaryAddresses(container.Config.Labels, networkName); err != nil {
+			d.logf("Warning: %v", err)
+		} else if len(addrs) > 0 {
+			if err := d.addSecondaryAddresses(portName, sandboxKey, addrs); err != nil {
+				d.logf("Warning: failed to add secondary addresses of endpoint %s: %v", endpointID[:12], err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/network"
+)
+
+// Journal records the intent of multi-step driver work on local disk before
+// it starts and clears it once done, so work interrupted by a crash is found
+// and rolled back on the next start
+type Journal struct {
+	dir string
+}
+
+// joinIntent describes a Join in progress and the local resources it creates
+type joinIntent struct {
+	NetworkID  string
+	EndpointID string
+	SandboxKey string
+	Port       string
+	Veth       string
+	Started    time.Time
+	// RequestID is the ID of the Join request in the plugin log
+	RequestID string `json:",omitempty"`
+}
+
+// NewJournal creates the journal directory if needed
+func NewJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	return &Journal{dir: dir}, nil
+}
+
+func (j *Journal) path(endpointID string) string {
+	return filepath.Join(j.dir, "join-"+endpointID+".json")
+}
+
+func (j *Journal) cleanupPath(key string) string {
+	return filepath.Join(j.dir, "cleanup-"+key+".json")
+}
+
+// record durably stores an intent, replacing an older one of the endpoint
+func (j *Journal) record(intent joinIntent) error {
+	if err := j.write(j.path(intent.EndpointID), intent); err != nil {
+		return fmt.Errorf("failed to journal join of %s: %w", intent.EndpointID[:12], err)
+	}
+	return nil
+}
+
+// recordCleanup durably stores a queued cleanup
+func (j *Journal) recordCleanup(intent cleanupIntent) error {
+	if err := j.write(j.cleanupPath(intent.key()), intent); err != nil {
+		return fmt.Errorf("failed to journal %s cleanup of %s: %w", intent.Kind, intent.EndpointID[:12], err)
+	}
+	return nil
+}
+
+// write replaces path with the JSON of v through a synced temporary file
+func (j *Journal) write(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// clear removes the intent of an endpoint
+func (j *Journal) clear(endpointID string) {
+	if err := os.Remove(j.path(endpointID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to clear journaled join of %s: %v", endpointID[:12], err)
+	}
+}
+
+// clearCleanup removes a cleanup that ran
+func (j *Journal) clearCleanup(key string) {
+	if err := os.Remove(j.cleanupPath(key)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to clear journaled cleanup %s: %v", key, err)
+	}
+}
+
+// pendingCleanups returns the cleanups a previous run queued but did not run
+func (j *Journal) pendingCleanups() ([]cleanupIntent, error) {
+	paths, err := filepath.Glob(filepath.Join(j.dir, "cleanup-*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	intents := []cleanupIntent{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+		intent := cleanupIntent{}
+		if err := json.Unmarshal(data, &intent); err != nil || intent.EndpointID == "" {
+			log.Printf("Warning: dropping unreadable journal entry %s", filepath.Base(path))
+			os.Remove(path)
+			continue
+		}
+		intents = append(intents, intent)
+	}
+	return intents, nil
+}
+
+// pending returns the intents left behind by an interrupted run
+func (j *Journal) pending() ([]joinIntent, error) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	intents := []joinIntent{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// Never became an intent, the work did not start
+			os.Remove(filepath.Join(j.dir, name))
+			continue
+		}
+		if !strings.HasPrefix(name, "join-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(j.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+		intent := joinIntent{}
+		if err := json.Unmarshal(data, &intent); err != nil || intent.EndpointID == "" {
+			log.Printf("Warning: dropping unreadable journal entry %s", name)
+			os.Remove(filepath.Join(j.dir, name))
+			continue
+		}
+		intents = append(intents, intent)
+	}
+	return intents, nil
+}
+
+// journaledJoin runs a Join between recording and clearing its intent. A
+// failed Join is rolled back right away; a crash leaves the intent for
+// recoverJoins.
+func (d *OVNDriver) journaledJoin(r *network.JoinRequest) (*network.JoinResponse, error) {
+	if d.journal == nil {
+		return d.join(r)
+	}
+	intent := joinIntent{
+		NetworkID:  r.NetworkID,
+		EndpointID: r.EndpointID,
+		SandboxKey: r.SandboxKey,
+		Port:       d.portName(r.EndpointID, r.NetworkID),
+		Veth:       d.vethName(r.EndpointID, r.NetworkID),
+		Started:    time.Now(),
+		RequestID:  requestIDFrom(d.context()),
+	}
+	if err := d.journal.record(intent); err != nil {
+		return nil, err
+	}
+	resp, err := d.join(r)
+	if err != nil {
+		// Also when the request was cancelled, so not on its context
+		d.background().rollbackJoin(intent)
+	}
+	d.journal.clear(r.EndpointID)
+	return resp, err
+}
+
+// recoverJoins rolls back the Joins a previous run did not finish. Docker
+// saw them fail and will delete or retry the endpoint, so completing them
+// would only leave an interface nobody uses.
+func (d *OVNDriver) recoverJoins() {
+	intents, err := d.journal.pending()
+	if err != nil {
+		d.logf("Warning: failed to recover interrupted joins: %v", err)
+		return
+	}
+	for _, intent := range intents {
+		d.logf("Rolling back join of endpoint %s interrupted at %s%s", intent.EndpointID[:12],
+			intent.Started.Format(time.RFC3339), requestSuffix(intent.RequestID))
+		d.rollbackJoin(intent)
+		d.journal.clear(intent.EndpointID)
+	}
+}
+
+// rollbackJoin removes what a Join may have created: the OVS port, the host
+// interface and the sandbox recorded on the logical switch port
+func (d *OVNDriver) rollbackJoin(intent joinIntent) {
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(intent.Port)
+	joined := err == nil && found && lsp.ExternalIDs["docker:sandbox"] == intent.SandboxKey
+	veth := intent.Veth
+	if joined {
+		// The Join may have claimed a pooled veth instead
+		veth = d.endpointVeth(lsp)
+	}
+	if d.ovs != nil {
+		if err := d.ovs.RemovePort(d.bridgeFor(intent.NetworkID), veth); err != nil {
+			d.logf("Warning: failed to remove OVS port %s: %v", veth, err)
+		}
+	}
+	cleanupCommand("ip", "link", "del", veth)
+
+	if !joined {
+		return
+	}
+	ops, err := d.ovn.DeleteLogicalSwitchPortExternalIDsOp(lsp, []string{"docker:sandbox", "docker:default_gateway", vethExternalIDKey})
+	if err == nil {
+		results, txnErr := d.ovn.Transact(ops...)
+		err = transactError(txnErr, results)
+	}
+	if err != nil {
+		d.logf("Warning: failed to clear sandbox of %s: %v", intent.Port, err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// kube-ovn marks its NB rows with external_ids:vendor=kube-ovn and garbage
+// collects only rows carrying its own vendor
+const (
+	kubeOVNVendorKey = "vendor"
+	kubeOVNVendor    = "kube-ovn"
+	driverVendor     = "docker-network-ovn"
+)
+
+// kubeOVNSwitchPrefix is the default RESOURCE_PREFIX in kube-ovn compatibility
+// mode. kube-ovn names switches after Subnet objects, and Kubernetes object
+// names never contain an underscore, so prefixed names cannot clash.
+const kubeOVNSwitchPrefix = "docker_"
+
+// kubeOVNMonitorOptions monitors the kube-ovn switches needed to keep Docker
+// subnets from overlapping with Kubernetes subnets
+func kubeOVNMonitorOptions() []client.MonitorOption {
+	ls := &LogicalSwitch{}
+	return []client.MonitorOption{
+		client.WithConditionalTable(ls, []model.Condition{{
+			Field:    &ls.ExternalIDs,
+			Function: ovsdb.ConditionIncludes,
+			Value:    map[string]string{kubeOVNVendorKey: kubeOVNVendor},
+		}}, &ls.Name, &ls.OtherConfig, &ls.ExternalIDs),
+	}
+}
+
+// ListKubeOVNLogicalSwitches returns the logical switches managed by kube-ovn
+func (o *OVNAPI) ListKubeOVNLogicalSwitches() ([]LogicalSwitch, error) {
+	list := []LogicalSwitch{}
+	err := o.client.WhereCache(func(ls *LogicalSwitch) bool {
+		return ls.ExternalIDs[kubeOVNVendorKey] == kubeOVNVendor
+	}).List(o.ctx, &list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kube-ovn logical switches: %w", err)
+	}
+	return list, nil
+}
+
+// checkKubeOVNOverlap refuses a Docker subnet overlapping any kube-ovn subnet;
+// dual-stack kube-ovn switches list their CIDRs comma separated
+func (d *OVNDriver) checkKubeOVNOverlap(subnet string) error {
+	_, dockerNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet %s: %w", subnet, err)
+	}
+
+	switches, err := d.ovn.ListKubeOVNLogicalSwitches()
+	if err != nil {
+		return err
+	}
+	for _, ls := range switches {
+		for _, cidr := range strings.Split(ls.OtherConfig["subnet"], ",") {
+			_, kubeNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				continue
+			}
+			if kubeNet.Contains(dockerNet.IP) || dockerNet.Contains(kubeNet.IP) {
+				return codedErrorf(ErrSubnetConflict, "subnet %s overlaps kube-ovn subnet %s (%s)", subnet, kubeNet, ls.Name)
+			}
+		}
+	}
+	return nil
+}
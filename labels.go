@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// labelExternalIDPrefix namespaces Docker labels copied into external_ids
+const labelExternalIDPrefix = "docker:label:"
+
+// LabelFilter selects the Docker labels copied onto OVN rows: exact label
+// keys, or key prefixes ending in '*'. An empty filter copies nothing.
+type LabelFilter []string
+
+// ParseLabelFilter parses a comma separated list of label keys and prefixes
+func ParseLabelFilter(value string) LabelFilter {
+	filter := LabelFilter{}
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			filter = append(filter, pattern)
+		}
+	}
+	return filter
+}
+
+// Match reports whether a label key is selected
+func (f LabelFilter) Match(key string) bool {
+	for _, pattern := range f {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(key, prefix) {
+			return true
+		}
+		if pattern == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ExternalIDs returns the selected labels as docker:label:<key> external_ids
+func (f LabelFilter) ExternalIDs(labels map[string]string) map[string]string {
+	values := map[string]string{}
+	for key, value := range labels {
+		if f.Match(key) {
+			values[labelExternalIDPrefix+key] = value
+		}
+	}
+	return values
+}
+
+// switchLabels returns the docker:label:* external_ids of a switch
+func switchLabels(ls *LogicalSwitch) map[string]string {
+	values := map[string]string{}
+	for key, value := range ls.ExternalIDs {
+		if strings.HasPrefix(key, labelExternalIDPrefix) {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// labelPort copies the selected labels of the network and of the container
+// of a joined endpoint onto its logical switch port; container labels win
+func (d *OVNDriver) labelPort(networkID string, portName string, container *DockerContainer) error {
+	ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(networkID)
+	if err != nil {
+		return err
+	}
+	lsp, portFound, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil {
+		return err
+	}
+	if !found || !portFound {
+		// Removed in the meantime
+		return nil
+	}
+
+	values := switchLabels(ls)
+	for key, value := range d.labels.ExternalIDs(container.Config.Labels) {
+		values[key] = value
+	}
+	values["docker:container"] = strings.TrimPrefix(container.Name, "/")
+	if container.State.Health != nil {
+		values["docker:health"] = container.State.Health.Status
+	}
+
+	ops, err := d.ovn.UpdateLogicalSwitchPortExternalIDsOp(lsp, values)
+	if err != nil {
+		return err
+	}
+	results, err := d.ovn.Transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to label logical switch port %s: %w", portName, err)
+	}
+	return nil
+}
+
+// labelDHCPOptions copies network labels onto the DHCP_Options of a switch
+func (d *OVNDriver) labelDHCPOptions(ls *LogicalSwitch, labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	dhcp, found, err := d.ovn.GetDHCPOptions(ls)
+	if err != nil || !found {
+		return err
+	}
+	ops, err := d.ovn.UpdateDHCPOptionsExternalIDsOp(dhcp, labels)
+	if err != nil {
+		return err
+	}
+	results, err := d.ovn.Transact(ops...)
+	return transactError(err, results)
+}
+
+// networkLabel returns the value of a container label, preferring its
+// ".<network name>" variant, and the key it was read from
+func networkLabel(labels map[string]string, key string, networkName string) (string, string) {
+	if value, ok := labels[key+"."+networkName]; ok {
+		return value, key + "." + networkName
+	}
+	return labels[key], key
+}
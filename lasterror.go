@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/network"
+)
+
+// LastError is the most recent failed driver call of a network or endpoint
+type LastError struct {
+	Operation string    `json:"operation"`
+	Error     string    `json:"error"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// maxLastErrors bounds the entries kept per kind; Docker never deletes the
+// networks and endpoints whose creation failed, so their entries would pile up
+const maxLastErrors = 1024
+
+// LastErrors keeps the last failure of each network and endpoint in memory
+type LastErrors struct {
+	mu        sync.Mutex
+	networks  map[string]LastError
+	endpoints map[string]LastError
+}
+
+func NewLastErrors() *LastErrors {
+	return &LastErrors{networks: map[string]LastError{}, endpoints: map[string]LastError{}}
+}
+
+// record stores the failure of operation on an endpoint, or on a network
+// when endpointID is empty
+func (l *LastErrors) record(operation string, networkID string, endpointID string, err error, requestID string) {
+	entry := LastError{Operation: operation, Error: err.Error(), Time: time.Now().UTC(), RequestID: requestID}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if endpointID != "" {
+		storeLastError(l.endpoints, endpointID, entry)
+	} else if networkID != "" {
+		storeLastError(l.networks, networkID, entry)
+	}
+}
+
+func storeLastError(entries map[string]LastError, id string, entry LastError) {
+	if _, found := entries[id]; !found && len(entries) >= maxLastErrors {
+		oldest := ""
+		for candidate, existing := range entries {
+			if oldest == "" || existing.Time.Before(entries[oldest].Time) {
+				oldest = candidate
+			}
+		}
+		delete(entries, oldest)
+	}
+	entries[id] = entry
+}
+
+// forget drops the entry of a deleted endpoint, or of a deleted network when
+// endpointID is empty
+func (l *LastErrors) forget(networkID string, endpointID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if endpointID != "" {
+		delete(l.endpoints, endpointID)
+		return
+	}
+	delete(l.networks, networkID)
+}
+
+func (l *LastErrors) network(networkID string) (LastError, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, found := l.networks[networkID]
+	return entry, found
+}
+
+func (l *LastErrors) endpoint(endpointID string) (LastError, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, found := l.endpoints[endpointID]
+	return entry, found
+}
+
+type lastErrorsResponse struct {
+	Networks  map[string]LastError `json:"networks"`
+	Endpoints map[string]LastError `json:"endpoints"`
+}
+
+func (l *LastErrors) snapshot() lastErrorsResponse {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	snapshot := lastErrorsResponse{
+		Networks:  make(map[string]LastError, len(l.networks)),
+		Endpoints: make(map[string]LastError, len(l.endpoints)),
+	}
+	for id, entry := range l.networks {
+		snapshot.Networks[id] = entry
+	}
+	for id, entry := range l.endpoints {
+		snapshot.Endpoints[id] = entry
+	}
+	return snapshot
+}
+
+// trackCall records the outcome of a driver call at path
+func (d *OVNDriver) trackCall(path string, req interface{}, err error) {
+	operation := strings.TrimPrefix(path, "/NetworkDriver.")
+	networkID, endpointID := driverRequestIDs(req)
+	// A failed inspect would hide the failure it is meant to show
+	if err != nil && operation != "EndpointOperInfo" {
+		d.lastErrors.record(operation, networkID, endpointID, err, requestIDFrom(d.context()))
+		return
+	}
+	switch operation {
+	case "DeleteEndpoint":
+		d.lastErrors.forget(networkID, endpointID)
+	case "DeleteNetwork":
+		d.lastErrors.forget(networkID, "")
+	}
+}
+
+// driverRequestIDs returns the network and endpoint IDs a driver request is
+// about; the endpoint ID is empty for network requests
+func driverRequestIDs(req interface{}) (string, string) {
+	switch r := req.(type) {
+	case *network.CreateNetworkRequest:
+		return r.NetworkID, ""
+	case *network.AllocateNetworkRequest:
+		return r.NetworkID, ""
+	case *network.DeleteNetworkRequest:
+		return r.NetworkID, ""
+	case *network.FreeNetworkRequest:
+		return r.NetworkID, ""
+	case *network.CreateEndpointRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.DeleteEndpointRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.InfoRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.JoinRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.LeaveRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.ProgramExternalConnectivityRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.RevokeExternalConnectivityRequest:
+		return r.NetworkID, r.EndpointID
+	}
+	return "", ""
+}
+
+// lastErrorValues adds the last failures of an endpoint and its network to
+// its docker inspect values
+func (d *OVNDriver) lastErrorValues(values map[string]string, networkID string, endpointID string) {
+	if entry, found := d.lastErrors.endpoint(endpointID); found {
+		values["ovn.last_error"] = entry.Operation + ": " + entry.Error
+		values["ovn.last_error_time"] = entry.Time.Format(time.RFC3339)
+	}
+	if entry, found := d.lastErrors.network(networkID); found {
+		values["ovn.network_last_error"] = entry.Operation + ": " + entry.Error
+		values["ovn.network_last_error_time"] = entry.Time.Format(time.RFC3339)
+	}
+}
+
+// handleErrors lists the last failures of networks and endpoints
+func (s *AdminServer) handleErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.driver.lastErrors.snapshot())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GetBridgeMappings returns this chassis' ovn-bridge-mappings as physical
+// network -> provider bridge
+func (o *OVSAPI) GetBridgeMappings() (map[string]string, error) {
+	ovsList := []OpenvSwitch{}
+	if err := o.client.List(o.ctx, &ovsList); err != nil {
+		return nil, fmt.Errorf("failed to list Open_vSwitch table: %w", err)
+	}
+	mappings := map[string]string{}
+	if len(ovsList) == 0 {
+		return mappings, nil
+	}
+	for _, mapping := range strings.Split(ovsList[0].ExternalIDs["ovn-bridge-mappings"], ",") {
+		physnet, bridge, found := strings.Cut(strings.TrimSpace(mapping), ":")
+		if found && physnet != "" {
+			mappings[physnet] = bridge
+		}
+	}
+	return mappings, nil
+}
+
+// checkLocalnetMapped makes sure ovn-controller on this chassis can bridge a
+// localnet port of physnet to a provider bridge
+func (d *OVNDriver) checkLocalnetMapped(physnet string) error {
+	if d.ovs == nil {
+		// Nested, the mappings live on the chassis of the parent port
+		return nil
+	}
+	mappings, err := d.ovs.GetBridgeMappings()
+	if err != nil {
+		return err
+	}
+	if bridge, ok := mappings[physnet]; ok {
+		if _, found, err := d.ovs.findBridge(bridge); err != nil {
+			return err
+		} else if !found {
+			return fmt.Errorf("physical network %s is mapped to bridge %s, which does not exist on this chassis", physnet, bridge)
+		}
+		return d.checkUplinkUp(bridge)
+	}
+	if len(mappings) == 0 {
+		return fmt.Errorf("physical network %s is not mapped on this chassis: external_ids:ovn-bridge-mappings is empty", physnet)
+	}
+
+	mapped := make([]string, 0, len(mappings))
+	for name, bridge := range mappings {
+		mapped = append(mapped, name+":"+bridge)
+	}
+	sort.Strings(mapped)
+	return fmt.Errorf("physical network %s is not mapped on this chassis; ovn-bridge-mappings has %s", physnet, strings.Join(mapped, ","))
+}
+
+// localnetPort returns the localnet port attaching a switch to a physical
+// network; a non-zero egressRate in bit/s shapes what it sends on each chassis
+func localnetPort(switchName string, physnet string, egressRate int64) *LogicalSwitchPort {
+	lsp := &LogicalSwitchPort{
+		Name: "ln-" + switchName,
+		Type: "localnet",
+		// "unknown" makes the switch send frames for MACs it does not know,
+		// such as the physical gateway, to the physical network
+		Addresses: []string{"unknown"},
+		Options:   map[string]string{"network_name": physnet},
+	}
+	if egressRate > 0 {
+		lsp.Options["qos_max_rate"] = strconv.FormatInt(egressRate, 10)
+	}
+	return lsp
+}
@@ -2,16 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/docker/go-plugins-helpers/network"
 	"github.com/go-logr/logr"
+	"github.com/go-logr/stdr"
 	"github.com/ovn-org/libovsdb/client"
 	"github.com/ovn-org/libovsdb/model"
 	"github.com/ovn-org/libovsdb/ovsdb"
@@ -23,14 +26,59 @@ type OVNDriver struct {
 	ovn       *OVNAPI
 	bridge    string
 	ovsSocket string
+	joinPool  *WorkerPool
+	networks  *NetworkCache
+	// kubeOVN enables coexistence with a kube-ovn cluster on the same NB
+	kubeOVN bool
+	// namePrefix is prepended to the names of created switches
+	namePrefix string
+	// sb is nil unless a southbound connection is configured
+	sb *SBAPI
+	// dns is nil unless DNS export is configured
+	dns *DNSExporter
+	// ipamHook is nil unless an external IPAM hook is configured
+	ipamHook *IPAMHook
+	// webhooks is nil unless lifecycle webhooks are configured
+	webhooks *Webhooks
+	// docker looks up network names and labels outside of driver calls
+	docker *DockerClient
+	// switchNaming is switchNamingID or switchNamingName
+	switchNaming string
+	// labels selects the Docker labels copied into external_ids
+	labels LabelFilter
+	// names generates switch, port and veth names
+	names NameTemplates
+	// nested is set when endpoints are child ports of this host's own port;
+	// there is no local OVS then and ovs is nil
+	nested *NestedParent
+	// journal is nil unless Join intents are journaled
+	journal *Journal
+	// vethPool is nil unless veth pairs are created ahead of Join
+	vethPool *VethPool
+	// cleanups is nil unless the cleanup of Leave and DeleteEndpoint is
+	// deferred to the background
+	cleanups *CleanupQueue
+	// root is the driver a request bound copy was made of, nil for the root
+	root *OVNDriver
+	// draining rejects new networks and endpoints ahead of an upgrade
+	draining *atomic.Bool
+	// lastErrors keeps the last failed call of each network and endpoint
+	lastErrors *LastErrors
+	// uplink is nil unless the provider uplink is configured
+	uplink *ProviderUplink
+	// northdRelease is the OVN release of ovn-northd, empty when unknown
+	northdRelease string
 }
 
 // NetworkConfig stores network metadata
 type NetworkConfig struct {
-	ID      string
-	Subnet  string
-	Gateway string
-	VLAN    int
+	ID         string
+	SwitchName string
+	SwitchUUID string
+	Subnet     string
+	Gateway    string
+	VLAN       int
+	Options    NetworkOptions
 }
 
 // EndpointInfo stores endpoint metadata
@@ -40,30 +88,126 @@ type EndpointInfo struct {
 	IPAddr      string
 	VethHost    string
 	OVSPortName string
+	Binding     PortBindingStatus
+}
+
+// Values returns the endpoint metadata in the form shown by docker inspect
+func (e EndpointInfo) Values() map[string]string {
+	values := map[string]string{
+		"ovn.logical_port": e.PortName,
+		"ovn.mac_address":  e.MacAddr,
+		"ovn.ip_address":   e.IPAddr,
+		"ovn.host_veth":    e.VethHost,
+		"ovn.ovs_port":     e.OVSPortName,
+	}
+	if e.Binding.Found {
+		values["ovn.chassis"] = e.Binding.Chassis
+		values["ovn.chassis_hostname"] = e.Binding.Hostname
+		values["ovn.bound"] = strconv.FormatBool(e.Binding.Bound())
+		values["ovn.up"] = strconv.FormatBool(e.Binding.Up)
+	}
+	return values
 }
 
 // NewOVNDriver creates a new OVN driver instance
-func NewOVNDriver(ovnBridge, ovsSocket string, ovsAPI *OVSAPI, ovnAPI *OVNAPI) *OVNDriver {
+func NewOVNDriver(ovnBridge, ovsSocket string, ovsAPI *OVSAPI, ovnAPI *OVNAPI, networks *NetworkCache, joinWorkers int, kubeOVN bool, namePrefix string, sbAPI *SBAPI) *OVNDriver {
 	return &OVNDriver{
-		ovs:       ovsAPI,
-		ovn:       ovnAPI,
-		bridge:    ovnBridge,
-		ovsSocket: ovsSocket,
+		ovs:        ovsAPI,
+		ovn:        ovnAPI,
+		bridge:     ovnBridge,
+		ovsSocket:  ovsSocket,
+		joinPool:   NewWorkerPool(joinWorkers, joinWorkers*4),
+		networks:   networks,
+		kubeOVN:    kubeOVN,
+		namePrefix: namePrefix,
+		sb:         sbAPI,
+		names:      DefaultNameTemplates(),
+		draining:   &atomic.Bool{},
+		lastErrors: NewLastErrors(),
+	}
+}
+
+// switchName returns the logical switch name for a Docker network or shared
+// network name
+func (d *OVNDriver) switchName(name string) string {
+	return d.namePrefix + expandNameTemplate(d.names.Switch, "", "", name)
+}
+
+// systemID returns this chassis' system-id; nested child ports are bound on
+// the chassis of their parent, so there is none without a local OVS
+func (d *OVNDriver) systemID() (string, error) {
+	if d.ovs == nil {
+		return "", nil
+	}
+	return d.ovs.GetSystemID()
+}
+
+// validResourcePrefix checks a switch name prefix; Neutron names its switches
+// neutron-<uuid>, so that prefix is reserved
+func validResourcePrefix(prefix string) error {
+	if !validSharedNetworkName(prefix) {
+		return fmt.Errorf("invalid prefix %q: only letters, digits, '.', '_' and '-' are allowed", prefix)
+	}
+	if strings.HasPrefix(prefix, "neutron-") {
+		return fmt.Errorf("invalid prefix %q: neutron- is reserved for Neutron switches", prefix)
+	}
+	return nil
+}
+
+// networkConfig returns a network's configuration from the monitor-fed cache,
+// falling back to the NB cache for switches whose events are still in flight
+func (d *OVNDriver) networkConfig(networkID string) (NetworkConfig, error) {
+	if config, ok := d.networks.Get(networkID); ok {
+		return config, nil
+	}
+
+	ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(networkID)
+	if err != nil {
+		return NetworkConfig{}, err
 	}
+	if !found {
+		return NetworkConfig{}, codedErrorf(ErrNetworkNotFound, "logical switch for network %s not found", networkID)
+	}
+	config, ok := networkConfigFromSwitch(ls, networkID)
+	if !ok {
+		return NetworkConfig{}, fmt.Errorf("logical switch %s is not a docker network", ls.Name)
+	}
+	return config, nil
 }
 
 // GetCapabilities returns the driver's capabilities
 func (d *OVNDriver) GetCapabilities() (*network.CapabilitiesResponse, error) {
 	log.Println("GetCapabilities called")
+	// Swarm scoped networks get no addresses from swarmkit with local data
+	// scope; they rely on OVN's native IPAM instead (see swarm.go)
 	return &network.CapabilitiesResponse{
 		Scope:             network.LocalScope,
 		ConnectivityScope: network.GlobalScope,
 	}, nil
 }
 
-// CreateNetwork creates a new OVN logical switch
+// CreateNetwork creates a new OVN logical switch, plus the management port of
+// this host with ovn.host_access
 func (d *OVNDriver) CreateNetwork(r *network.CreateNetworkRequest) error {
-	log.Printf("CreateNetwork: %s", r.NetworkID)
+	if err := d.createNetwork(r); err != nil {
+		return err
+	}
+	if opts, _ := parseNetworkOptions(r.Options); opts.HostAccess {
+		if err := d.ensureManagementPort(r.NetworkID, hostAccessAddresses(r.IPv4Data)); err != nil {
+			// Docker does not create the network, so neither does the driver
+			d.background().DeleteNetwork(&network.DeleteNetworkRequest{NetworkID: r.NetworkID})
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *OVNDriver) createNetwork(r *network.CreateNetworkRequest) error {
+	d.logf("CreateNetwork: %s", r.NetworkID)
+
+	if err := d.checkNotDraining(); err != nil {
+		return err
+	}
 
 	subnet := ""
 	gateway := ""
@@ -72,14 +216,25 @@ func (d *OVNDriver) CreateNetwork(r *network.CreateNetworkRequest) error {
 		gateway = ipam.Gateway
 	}
 
-	if subnet == "" {
-		return fmt.Errorf("subnet not specified")
+	opts, err := parseNetworkOptions(r.Options)
+	if err != nil {
+		return err
 	}
 
-	if existingLS, found, err := d.ovn.GetLogicalSwitchBySubnet(subnet); err != nil {
-		return err
-	} else if found {
-		return fmt.Errorf("subnet %s already in use by logical switch %s", subnet, existingLS.Name)
+	// With the null IPAM driver OVN assigns the endpoint addresses
+	nativeIPAM := subnet == nullIPAMPool
+	if nativeIPAM {
+		subnet = opts.Subnet
+		gateway = opts.Gateway
+	} else if opts.Subnet != "" {
+		return codedErrorf(ErrInvalidOption, "network option %s only applies with --ipam-driver=null", subnetOption)
+	}
+
+	if subnet == "" {
+		if nativeIPAM {
+			return codedErrorf(ErrInvalidOption, "subnet not specified: set %s on networks with --ipam-driver=null", subnetOption)
+		}
+		return fmt.Errorf("subnet not specified")
 	}
 
 	if gateway != "" && strings.Contains(gateway, "/") {
@@ -88,41 +243,290 @@ func (d *OVNDriver) CreateNetwork(r *network.CreateNetworkRequest) error {
 			return fmt.Errorf("invalid gateway address: %w", err)
 		}
 		gateway = ip.String()
-		log.Printf("Cleaned gateway from CIDR to IP: %s", gateway)
+		d.logf("Cleaned gateway from CIDR to IP: %s", gateway)
 	}
 
-	switchName := fmt.Sprintf("ls-%s", r.NetworkID[:12])
+	dryRun := opts.DryRun
+
+	excludeIPs := opts.ExcludeIPs
+	if err := checkExcludeIPsInSubnet(excludeIPs, subnet); err != nil {
+		return err
+	}
+	if nativeIPAM && gateway != "" {
+		// ovn-northd only knows router port addresses, keep it off the gateway
+		gw := net.ParseIP(gateway).To4()
+		excludeIPs = append(excludeIPs, ipRange{first: gw, last: gw})
+	}
+
+	switchName := d.switchName(r.NetworkID[:12])
+	sharedName := opts.SharedNetwork
+	if sharedName != "" {
+		switchName = d.switchName(sharedName)
+	}
+
+	if d.kubeOVN {
+		if err := d.checkKubeOVNOverlap(subnet); err != nil {
+			return err
+		}
+	}
+
+	localnet := opts.Localnet
+	if localnet != "" {
+		if err := d.checkLocalnetMapped(localnet); err != nil {
+			return err
+		}
+	}
+	if opts.Bridge != "" {
+		if err := d.checkBridgeExists(opts.Bridge); err != nil {
+			return err
+		}
+	}
+	if opts.HostAccess && d.ovs == nil {
+		return codedErrorf(ErrInvalidOption, "network option %s needs a local OVS, it is not available in nested mode", hostAccessOption)
+	}
+
+	systemID, err := d.systemID()
+	if err != nil {
+		return err
+	}
+
+	// Swarm scoped networks are created on every node with the same ID
+	if existingLS, found, err := d.ovn.GetLogicalSwitchByNetworkID(r.NetworkID); err != nil {
+		return err
+	} else if found {
+		if dryRun {
+			return dryRunError("attach this node to logical switch %s", existingLS.Name)
+		}
+		return d.attachNode(existingLS, r.NetworkID, subnet, gateway)
+	}
+
+	node, err := d.nodeName()
+	if err != nil {
+		return err
+	}
+
+	sameSubnet, err := d.ovn.ListLogicalSwitchesBySubnet(subnet)
+	if err != nil {
+		return err
+	}
+	if existingLS, err := subnetSwitch(sameSubnet, subnet, switchName, sharedName, opts.AllowOverlap); err != nil {
+		return err
+	} else if existingLS != nil {
+		if existingOverlap := existingLS.OtherConfig["docker:allow_overlap"] == "true"; existingOverlap != opts.AllowOverlap {
+			return codedErrorf(ErrSubnetConflict, "shared network %s has %s=%t, not %t", sharedName, allowOverlapOption, existingOverlap, opts.AllowOverlap)
+		}
+		if existingLocalnet := existingLS.OtherConfig["docker:localnet"]; existingLocalnet != localnet {
+			return codedErrorf(ErrSubnetConflict, "shared network %s uses localnet %q, not %q", sharedName, existingLocalnet, localnet)
+		}
+		if existingExcludeIPs := existingLS.OtherConfig[excludeIPsOtherConfigKey]; existingExcludeIPs != formatExcludeIPs(excludeIPs) {
+			return codedErrorf(ErrSubnetConflict, "shared network %s excludes %q, not %q", sharedName, existingExcludeIPs, formatExcludeIPs(excludeIPs))
+		}
+		if existingBridge := existingLS.OtherConfig["docker:bridge"]; existingBridge != opts.Bridge {
+			return codedErrorf(ErrSubnetConflict, "shared network %s uses bridge %q, not %q", sharedName, existingBridge, opts.Bridge)
+		}
+		if existingKey := existingLS.OtherConfig[requestedTunnelKeyOtherConfigKey]; opts.TunnelKey != "" && existingKey != opts.TunnelKey {
+			return codedErrorf(ErrTunnelKeyConflict, "shared network %s has tunnel key %q, not %s", sharedName, existingKey, opts.TunnelKey)
+		}
+		if dryRun {
+			return dryRunError("adopt shared logical switch %s", existingLS.Name)
+		}
+		return d.adoptSharedNetwork(existingLS, r.NetworkID, gateway, systemID, node)
+	}
+
+	if opts.TunnelKey != "" {
+		if err := d.checkTunnelKeyFree(opts.TunnelKey); err != nil {
+			return err
+		}
+	}
+
+	if sharedName != "" {
+		if existingLS, found, err := d.ovn.GetLogicalSwitch(switchName); err != nil {
+			return err
+		} else if found && existingLS.Name == switchName {
+			return codedErrorf(ErrSubnetConflict, "shared network %s already exists with subnet %s", sharedName, existingLS.OtherConfig["docker:subnet"])
+		}
+	}
 
 	otherConfig := map[string]string{
-		"docker:network": r.NetworkID,
-		"docker:subnet":  subnet,
-		"docker:gateway": gateway,
+		"docker:network":                   r.NetworkID,
+		networkOtherConfigKey(r.NetworkID): systemID,
+		nodeOtherConfigKey(node):           r.NetworkID,
+		"docker:subnet":                    subnet,
+		"docker:gateway":                   gateway,
+	}
+
+	for k, v := range opts.otherConfig() {
+		otherConfig[k] = v
+	}
+	if len(excludeIPs) > 0 {
+		otherConfig[excludeIPsOtherConfigKey] = formatExcludeIPs(excludeIPs)
+	}
+	if nativeIPAM {
+		otherConfig[subnetOtherConfigKey] = subnet
 	}
 
-	if err := d.ovn.CreateLogicalSwitch(switchName, otherConfig); err != nil {
+	// DNS and boot settings are handed out over OVN's native DHCP
+	extraOps := []ovsdb.Operation{}
+	dns, boot := opts.DNS, opts.Boot
+	if dns.Enabled() || boot.Enabled() {
+		otherConfig[dhcpNetworkOtherConfigKey] = r.NetworkID
+		dhcpOps, err := d.ovn.CreateDHCPOptionsOp(dhcpOptions(r.NetworkID, subnet, gateway, dns, boot))
+		if err != nil {
+			return fmt.Errorf("failed to create DHCP options operation: %w", err)
+		}
+		extraOps = append(extraOps, dhcpOps...)
+	}
+
+	ports := []*LogicalSwitchPort{}
+	if localnet != "" {
+		ports = append(ports, localnetPort(switchName, localnet, opts.EgressRate))
+	}
+
+	if dryRun {
+		plan := fmt.Sprintf("create logical switch %s with subnet %s, gateway %s", switchName, subnet, gateway)
+		if localnet != "" {
+			plan += fmt.Sprintf(" and localnet port %s to %s", ports[0].Name, localnet)
+			if opts.EgressRate > 0 {
+				plan += fmt.Sprintf(" limited to %d bit/s", opts.EgressRate)
+			}
+		}
+		if dns.Enabled() {
+			plan += fmt.Sprintf(", DHCP options with name servers %v and search domains %v", dns.Servers, dns.Search)
+		}
+		if boot.Enabled() {
+			plan += fmt.Sprintf(", DHCP boot options %v", boot.dhcpValues())
+		}
+		return dryRunError("%s", plan)
+	}
+
+	if err := d.ovn.CreateLogicalSwitch(switchName, otherConfig, ports, extraOps...); err != nil {
 		return err
 	}
 
-	log.Printf("Created network %s with subnet %s, gateway %s", switchName, subnet, gateway)
+	d.logf("Created network %s with subnet %s, gateway %s", switchName, subnet, gateway)
+	if d.docker != nil && sharedName == "" {
+		d.describeSwitch(r.NetworkID)
+	}
 	return nil
 }
 
-// DeleteNetwork removes an OVN logical switch
+// dryRunError reports what CreateNetwork would have done; returning an error
+// is the only way to keep Docker from creating the network
+func dryRunError(format string, args ...interface{}) error {
+	return fmt.Errorf("dry run: validation passed, would "+format+"; nothing was created", args...)
+}
+
+// adoptSharedNetwork attaches a local Docker network to a shared switch that
+// another host already created for the same subnet
+func (d *OVNDriver) adoptSharedNetwork(ls *LogicalSwitch, networkID string, gateway string, systemID string, node string) error {
+	if existingGateway := ls.OtherConfig["docker:gateway"]; existingGateway != gateway {
+		return codedErrorf(ErrSubnetConflict, "shared network %s uses gateway %s, not %s", ls.Name, existingGateway, gateway)
+	}
+
+	ops, err := d.ovn.MutateLogicalSwitchOtherConfigOp(ls, ovsdb.MutateOperationInsert, map[string]string{
+		networkOtherConfigKey(networkID): systemID,
+		nodeOtherConfigKey(node):         networkID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create mutate operation to adopt shared network: %w", err)
+	}
+
+	results, err := d.ovn.Transact(ops...)
+	if err != nil {
+		return fmt.Errorf("failed to adopt shared network: %w", err)
+	}
+	if len(results) > 0 && results[0].Error != "" {
+		return fmt.Errorf("failed to adopt shared network: %s", results[0].Error)
+	}
+
+	d.logf("Adopted shared logical switch %s for network %s", ls.Name, networkID[:12])
+	return nil
+}
+
+// DeleteNetwork removes an OVN logical switch, or only detaches this host's
+// network when the switch is shared with other hosts
 func (d *OVNDriver) DeleteNetwork(r *network.DeleteNetworkRequest) error {
-	log.Printf("DeleteNetwork: %s", r.NetworkID)
+	d.logf("DeleteNetwork: %s", r.NetworkID)
+	d.cleanups.Flush(func(c cleanupIntent) bool { return c.NetworkID == r.NetworkID })
+
+	ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(r.NetworkID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		d.logf("Logical switch for network %s not found, assuming already deleted", r.NetworkID[:12])
+		return nil
+	}
+
+	node, err := d.nodeName()
+	if err != nil {
+		return err
+	}
+	d.removeManagementPort(ls, node)
+	if len(switchNodes(ls, r.NetworkID)) > 1 {
+		// Other nodes still use this swarm scoped network
+		return d.detachNode(ls, r.NetworkID, node)
+	}
+
+	if len(switchNetworkIDs(ls)) == 1 {
+		if err := d.ovn.DeleteLogicalSwitch(ls.Name); err != nil {
+			return err
+		}
+		if err := d.ovn.DeleteDHCPOptions(ls); err != nil {
+			d.logf("Warning: %v", err)
+		}
+		return nil
+	}
 
-	switchName := fmt.Sprintf("ls-%s", r.NetworkID[:12])
+	keys := []string{networkOtherConfigKey(r.NetworkID), nodeOtherConfigKey(node)}
+	if ls.OtherConfig["docker:network"] == r.NetworkID {
+		keys = append(keys, "docker:network")
+	}
+	ops, err := d.ovn.DeleteLogicalSwitchOtherConfigKeysOp(ls, keys)
+	if err != nil {
+		return fmt.Errorf("failed to create mutate operation to detach shared network: %w", err)
+	}
+	results, err := d.ovn.Transact(ops...)
+	if err != nil {
+		return fmt.Errorf("failed to detach shared network: %w", err)
+	}
+	if len(results) > 0 && results[0].Error != "" {
+		return fmt.Errorf("failed to detach shared network: %s", results[0].Error)
+	}
 
-	return d.ovn.DeleteLogicalSwitch(switchName)
+	d.logf("Detached network %s from shared logical switch %s", r.NetworkID[:12], ls.Name)
+	return nil
 }
 
 // CreateEndpoint creates a logical switch port for a container
 func (d *OVNDriver) CreateEndpoint(r *network.CreateEndpointRequest) (*network.CreateEndpointResponse, error) {
-	log.Printf("CreateEndpoint: %s on network %s", r.EndpointID, r.NetworkID)
+	d.logf("CreateEndpoint: %s on network %s", r.EndpointID, r.NetworkID)
 
-	switchName := fmt.Sprintf("ls-%s", r.NetworkID[:12])
-	if _, found, err := d.ovn.GetLogicalSwitch(switchName); err != nil || !found {
-		return nil, fmt.Errorf("network %s not found", r.NetworkID)
+	if err := d.checkNotDraining(); err != nil {
+		return nil, err
+	}
+
+	if err := validateEndpointOptions(r.Options); err != nil {
+		return nil, err
+	}
+
+	portName := d.portName(r.EndpointID, r.NetworkID)
+
+	netConfig, err := d.networkConfig(r.NetworkID)
+	if err != nil {
+		return nil, codedErrorf(ErrNetworkNotFound, "network %s not found", r.NetworkID)
+	}
+	// Looked up by network ID, the switch may have been renamed after the
+	// Docker network since the cache was filled
+	ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(r.NetworkID)
+	if err != nil || !found {
+		return nil, codedErrorf(ErrNetworkNotFound, "network %s not found", r.NetworkID)
+	}
+	switchName := ls.Name
+
+	systemID, err := d.systemID()
+	if err != nil {
+		return nil, err
 	}
 
 	macAddr := r.Interface.MacAddress
@@ -139,56 +543,53 @@ func (d *OVNDriver) CreateEndpoint(r *network.CreateEndpointRequest) (*network.C
 		ipAddr = ip.String()
 	}
 
-	if err := d.storeEndpointMetadata(switchName, r.EndpointID, macAddr, ipAddr); err != nil {
-		return nil, err
+	addressPairs, err := parseAddressPairs(endpointOption(r.Options, addressPairsOption), macAddr)
+	if err != nil {
+		return nil, codedErrorf(ErrInvalidOption, "invalid %s: %w", addressPairsOption, err)
 	}
 
-	log.Printf("Created endpoint %s with MAC %s, IP %s", r.EndpointID[:12], macAddr, ipAddr)
-	return &network.CreateEndpointResponse{
-		Interface: &network.EndpointInterface{
-			MacAddress: macAddr,
-		},
-	}, nil
-}
-
-// DeleteEndpoint removes endpoint metadata
-func (d *OVNDriver) DeleteEndpoint(r *network.DeleteEndpointRequest) error {
-	log.Printf("DeleteEndpoint: %s", r.EndpointID)
-
-	switchName := fmt.Sprintf("ls-%s", r.NetworkID[:12])
-	return d.deleteEndpointMetadata(switchName, r.EndpointID)
-}
-
-// Join connects the endpoint to the network namespace
-func (d *OVNDriver) Join(r *network.JoinRequest) (*network.JoinResponse, error) {
-	log.Printf("Join: endpoint %s", r.EndpointID)
-
-	switchName := fmt.Sprintf("ls-%s", r.NetworkID[:12])
-	portName := fmt.Sprintf("lsp-%s-ls-%s", r.EndpointID[:12], r.NetworkID[:12])
-
-	macAddr, ipAddr, gateway, err := d.getEndpointMetadata(switchName, r.EndpointID)
+	// Parents of a virtual IP source it with their own MAC
+	virtualIPs, err := parseVirtualIPs(endpointOption(r.Options, virtualIPsOption))
 	if err != nil {
-		return nil, err
+		return nil, codedErrorf(ErrInvalidOption, "invalid %s: %w", virtualIPsOption, err)
+	}
+	if len(virtualIPs) > 0 {
+		_, subnet, err := net.ParseCIDR(netConfig.Subnet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet of network %s: %w", r.NetworkID[:12], err)
+		}
+		for _, vip := range virtualIPs {
+			if !subnet.Contains(net.ParseIP(vip)) || vip == ipAddr {
+				return nil, codedErrorf(ErrInvalidOption, "invalid %s: %s must be another address of subnet %s", virtualIPsOption, vip, netConfig.Subnet)
+			}
+			if port, found := d.networks.PortByIP(switchName, vip); found && port != virtualPortName(switchName, vip) {
+				return nil, codedErrorf(ErrIPInUse, "invalid %s: %s is used by port %s", virtualIPsOption, vip, port)
+			}
+			addressPairs = append(addressPairs, macAddr+" "+vip)
+		}
 	}
 
-	addressStr := fmt.Sprintf("%s %s", macAddr, ipAddr)
-	externalIDs := map[string]string{
-		"docker:endpoint": r.EndpointID,
-		"docker:network":  r.NetworkID,
+	dscp := endpointOption(r.Options, dscpOption)
+	if dscp == "" {
+		dscp = netConfig.Options.DSCP
+	}
+	connLimit := endpointOption(r.Options, connLimitOption)
+	if connLimit == "" {
+		connLimit = netConfig.Options.ConnLimit
 	}
 
-	if existingLSP, found, err := d.ovn.GetLogicalSwitchPortByIP(switchName, ipAddr); err != nil {
+	if err := checkIPNotExcluded(ls, ipAddr); err != nil {
 		return nil, err
-	} else if found {
-		return nil, fmt.Errorf("IP address %s already in use on logical switch %s by port %s", ipAddr, switchName, existingLSP.Name)
 	}
 
-	ls, found, err := d.ovn.GetLogicalSwitch(switchName)
-	if err != nil {
-		return nil, err
+	existingPort, found := d.networks.PortByIP(switchName, ipAddr)
+	if found && d.cleanups.Flush(func(c cleanupIntent) bool { return c.Kind == cleanupDelete && c.Port == existingPort }) {
+		// Docker released the address with an endpoint whose port was still
+		// queued for deletion
+		existingPort, found = d.networks.PortByIP(switchName, ipAddr)
 	}
-	if !found {
-		return nil, fmt.Errorf("logical switch %s not found", switchName)
+	if found {
+		return nil, codedErrorf(ErrIPInUse, "IP address %s already in use on logical switch %s by port %s", ipAddr, switchName, existingPort)
 	}
 
 	if _, found, err := d.ovn.GetLogicalSwitchPort(portName); err != nil {
@@ -197,232 +598,480 @@ func (d *OVNDriver) Join(r *network.JoinRequest) (*network.JoinResponse, error)
 		return nil, fmt.Errorf("logical switch port %s already exists", portName)
 	}
 
+	addresses, portSecurity := portAddresses(macAddr, ipAddr, addressPairs)
+	// Without an address from Docker, ovn-northd assigns one; the port is
+	// pinned to it before CreateEndpoint returns
+	dynamic := ipAddr == "" && ls.OtherConfig[subnetOtherConfigKey] != ""
+	if dynamic {
+		addresses = []string{macAddr + " dynamic"}
+		portSecurity = nil
+	}
+
 	enabled := true
 	lsp := &LogicalSwitchPort{
 		Name:         portName,
-		Addresses:    []string{addressStr},
-		PortSecurity: []string{addressStr},
+		Addresses:    addresses,
+		PortSecurity: portSecurity,
 		Enabled:      &enabled,
 		Type:         "",
-		ExternalIDs:  externalIDs,
+		ExternalIDs: map[string]string{
+			"docker:endpoint": r.EndpointID,
+			"docker:network":  r.NetworkID,
+			"docker:switch":   switchName,
+			"docker:chassis":  systemID,
+		},
+	}
+	lsp.Options = map[string]string{}
+	if systemID != "" {
+		// Bind the port on this chassis only
+		lsp.Options["requested-chassis"] = systemID
+	}
+	if d.nested == nil {
+		// Bind the port to the interface of this endpoint only
+		lsp.Options["iface-id-ver"] = r.EndpointID
+	}
+	if connLimit != "" {
+		lsp.Options["ct-zone-limit"] = connLimit
+		if d.connLimitIgnored() {
+			d.logf("Warning: ovn-northd %s ignores the connection limit of endpoint %s, which needs OVN %s", d.northdRelease, r.EndpointID[:12], ctZoneLimitRelease)
+		}
+	}
+	for name := range interfaceSysctls {
+		if value := endpointOption(r.Options, sysctlOptionPrefix+name); value != "" {
+			lsp.ExternalIDs[sysctlExternalIDPrefix+name] = value
+		}
 	}
 
-	cleanPortName := strings.ReplaceAll(portName, "-", "_")
-	namedUUID := fmt.Sprintf("lsp_named_%s", cleanPortName)
-	lsp.UUID = namedUUID
+	if dhcp, found, err := d.ovn.GetDHCPOptions(ls); err != nil {
+		return nil, err
+	} else if found {
+		lsp.DHCPv4 = &dhcp.UUID
+	}
+
+	lsp.UUID = newNamedUUID("lsp")
+
+	nestedOps := []ovsdb.Operation{}
+	if d.nested != nil {
+		nestedOps, err = d.nested.childPortOps(d.ovn, lsp)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	hookEvent := IPAMHookEvent{
+		Event:      "create",
+		NetworkID:  r.NetworkID,
+		EndpointID: r.EndpointID,
+		Switch:     switchName,
+		Port:       portName,
+		IPAddress:  ipAddr,
+		MACAddress: macAddr,
+		Subnet:     netConfig.Subnet,
+		Gateway:    netConfig.Gateway,
+	}
+	if d.ipamHook != nil {
+		if err := d.ipamHook.Notify(hookEvent); err != nil {
+			return nil, err
+		}
+	}
+
+	if !dynamic {
+		for k, v := range endpointMetadata(macAddr, ipAddr, addressPairs) {
+			lsp.ExternalIDs[k] = v
+		}
+	}
+
+	// The port and its switch attachment go in one transaction
 	lspOps, err := d.ovn.CreateLogicalSwitchPortOp(lsp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create logical switch port operation: %w", err)
 	}
 
-	mutateOps, err := d.ovn.MutateLogicalSwitchPortsOp(ls, ovsdb.MutateOperationInsert, []string{namedUUID})
+	mutateOps, err := d.ovn.MutateLogicalSwitchPortsOp(ls, ovsdb.MutateOperationInsert, []string{lsp.UUID})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create mutate operation: %w", err)
 	}
 
-	allOps := append(lspOps, mutateOps...)
+	virtualOps, err := d.addVirtualParentOps(ls, r.NetworkID, portName, virtualIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	qosOps := []ovsdb.Operation{}
+	if dscp != "" {
+		value, _ := strconv.Atoi(dscp)
+		qosOps, err = d.ovn.createDSCPOps(ls, portName, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	allOps := append(nestedOps, lspOps...)
+	allOps = append(allOps, mutateOps...)
+	allOps = append(allOps, virtualOps...)
+	allOps = append(allOps, qosOps...)
 	results, err := d.ovn.Transact(allOps...)
+	if err == nil {
+		err = transactError(nil, results)
+		if len(nestedOps) > 0 && len(results) > 0 && results[0].Error != "" {
+			err = fmt.Errorf("VLAN tag %s of parent port %s was taken concurrently", lsp.ExternalIDs["docker:tag"], d.nested.Port)
+		}
+	}
 	if err != nil {
+		if d.ipamHook != nil {
+			// Release the external allocation of the endpoint Docker will not create
+			hookEvent.Event = "delete"
+			d.ipamHook.Notify(hookEvent)
+		}
 		return nil, fmt.Errorf("failed to create logical switch port and attach to switch: %w", err)
 	}
 
-	for _, res := range results {
-		if res.Error != "" {
-			return nil, fmt.Errorf("transaction error: %s", res.Error)
+	resp := &network.CreateEndpointResponse{
+		Interface: &network.EndpointInterface{
+			MacAddress: macAddr,
+		},
+	}
+	if dynamic {
+		ipAddr, err = d.pinDynamicAddress(portName, macAddr, addressPairs)
+		if err != nil {
+			// Also when the request was cancelled, so not on its context
+			d.background().releaseEndpointPort(ls, portName)
+			if d.ipamHook != nil {
+				hookEvent.Event = "delete"
+				d.ipamHook.Notify(hookEvent)
+			}
+			return nil, err
 		}
+		// Docker takes the address from the driver when its IPAM gave none
+		_, subnet, _ := net.ParseCIDR(netConfig.Subnet)
+		prefixLen, _ := subnet.Mask.Size()
+		resp.Interface.Address = fmt.Sprintf("%s/%d", ipAddr, prefixLen)
 	}
 
-	log.Printf("Created logical switch port %s with address %s", portName, addressStr)
+	d.logf("Created endpoint %s with logical switch port %s, address %s %s", r.EndpointID[:12], portName, macAddr, ipAddr)
+	return resp, nil
+}
 
-	localVethName := fmt.Sprintf("veth%s", r.EndpointID[:7])
-	containerVethName := localVethName + "_c"
+// DeleteEndpoint removes the endpoint logical switch port and its metadata
+func (d *OVNDriver) DeleteEndpoint(r *network.DeleteEndpointRequest) error {
+	d.logf("DeleteEndpoint: %s", r.EndpointID)
 
-	log.Printf("Creating veth pair: %s <-> %s", localVethName, containerVethName)
-	cmd := exec.Command("ip", "link", "add", localVethName,
-		"type", "veth", "peer", "name", containerVethName)
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("failed to create veth pair: %w", err)
-	}
+	portName := d.portName(r.EndpointID, r.NetworkID)
 
-	cmd = exec.Command("ip", "link", "set", containerVethName, "address", macAddr)
-	if err := cmd.Run(); err != nil {
-		exec.Command("ip", "link", "del", localVethName).Run()
-		return nil, fmt.Errorf("failed to set MAC address: %w", err)
+	ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(r.NetworkID)
+	if err != nil {
+		return err
 	}
-
-	cmd = exec.Command("ip", "link", "set", localVethName, "up")
-	if err := cmd.Run(); err != nil {
-		exec.Command("ip", "link", "del", localVethName).Run()
-		return nil, fmt.Errorf("failed to bring up host veth: %w", err)
+	if !found {
+		d.logf("Warning: logical switch for network %s not found while deleting endpoint %s", r.NetworkID[:12], r.EndpointID[:12])
+		return nil
 	}
 
-	ovsPortName := localVethName
-	if err := d.ovs.AddPortToBridge(d.bridge, ovsPortName, localVethName, portName); err != nil {
-		exec.Command("ip", "link", "del", localVethName).Run()
-		return nil, fmt.Errorf("failed to add veth to OVS: %w", err)
+	if d.ipamHook != nil {
+		macAddr, ipAddr, err := d.endpointAddresses(ls, r.EndpointID, portName)
+		if err != nil {
+			return err
+		}
+		// Released before the port is removed so a rejected release can be
+		// retried by Docker against an unchanged endpoint
+		err = d.ipamHook.Notify(IPAMHookEvent{
+			Event:      "delete",
+			NetworkID:  r.NetworkID,
+			EndpointID: r.EndpointID,
+			Switch:     ls.Name,
+			Port:       portName,
+			IPAddress:  ipAddr,
+			MACAddress: macAddr,
+			Subnet:     ls.OtherConfig["docker:subnet"],
+			Gateway:    ls.OtherConfig["docker:gateway"],
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	exec.Command("ethtool", "-K", localVethName, "tx", "off").Run()
-	exec.Command("ethtool", "-K", containerVethName, "tx", "off").Run()
+	d.cleanup(cleanupIntent{
+		Kind:       cleanupDelete,
+		NetworkID:  r.NetworkID,
+		EndpointID: r.EndpointID,
+		Port:       portName,
+	})
+	return nil
+}
 
-	log.Printf("Join complete: returning gateway %s", gateway)
-	return &network.JoinResponse{
-		InterfaceName: network.InterfaceName{
-			SrcName:   containerVethName,
-			DstPrefix: "eth",
-		},
-		Gateway: gateway,
-	}, nil
+// Join connects the endpoint to the network namespace, on a bounded worker pool
+func (d *OVNDriver) Join(r *network.JoinRequest) (*network.JoinResponse, error) {
+	var resp *network.JoinResponse
+	var err error
+	d.joinPool.Do(func() {
+		// Docker may have given up while the Join was queued
+		if err = d.context().Err(); err != nil {
+			return
+		}
+		resp, err = d.journaledJoin(r)
+	})
+	return resp, err
 }
 
-// Leave disconnects the endpoint
-func (d *OVNDriver) Leave(r *network.LeaveRequest) error {
-	log.Printf("Leave: endpoint %s", r.EndpointID)
+func (d *OVNDriver) join(r *network.JoinRequest) (*network.JoinResponse, error) {
+	d.logf("Join: endpoint %s", r.EndpointID)
 
-	switchName := fmt.Sprintf("ls-%s", r.NetworkID[:12])
-	portName := fmt.Sprintf("lsp-%s-ls-%s", r.EndpointID[:12], r.NetworkID[:12])
-	if err := d.deleteLogicalSwitchPort(switchName, portName); err != nil {
-		log.Printf("Warning: failed to delete LSP %s: %v", portName, err)
+	portName := d.portName(r.EndpointID, r.NetworkID)
+
+	netConfig, err := d.networkConfig(r.NetworkID)
+	if err != nil {
+		return nil, err
 	}
+	gateway := netConfig.Gateway
 
-	localVethName := fmt.Sprintf("veth%s", r.EndpointID[:7])
-	if err := d.ovs.RemovePort(d.bridge, localVethName); err != nil {
-		log.Printf("Warning: failed to remove OVS port from OVS: %v", err)
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find logical switch port: %w", err)
 	}
+	if !found || len(lsp.Addresses) == 0 {
+		return nil, fmt.Errorf("logical switch port %s not found", portName)
+	}
+	macAddr := strings.Fields(lsp.Addresses[0])[0]
 
-	cmd := exec.Command("ip", "link", "del", localVethName)
-	if err := cmd.Run(); err != nil {
-		log.Printf("Warning: failed to delete veth pair: %v", err)
+	if sysctls := endpointSysctls(netConfig.Options.Sysctls, lsp.ExternalIDs); len(sysctls) > 0 {
+		if err := d.presetSysctls(r.SandboxKey, macAddr, sysctls); err != nil {
+			return nil, fmt.Errorf("failed to set sysctls of endpoint %s: %w", r.EndpointID[:12], err)
+		}
 	}
 
-	return nil
-}
+	// Secondary networks of a multi-homed container leave the default route
+	// and gateway service to the network that provides them
+	secondary := false
+	if netConfig.Options.NoDefaultGateway {
+		secondary = true
+		gateway = ""
+	} else if gatewayPort, found, err := d.sandboxGatewayPort(r.SandboxKey, portName); err != nil {
+		return nil, err
+	} else if found {
+		d.logf("Endpoint %s joins as a secondary network, %s provides the default route", r.EndpointID[:12], gatewayPort)
+		secondary = true
+		gateway = ""
+	}
 
-func endpointOtherConfigKey(endpointID string, suffix string) string {
-	return fmt.Sprintf("docker:endpoint:%s:%s", endpointID, suffix)
-}
+	var hostRoutes []*network.StaticRoute
+	if netConfig.Options.HostMasquerade {
+		if hostRoutes, err = d.hostRoutes(netConfig); err != nil {
+			return nil, err
+		}
+	}
 
-func (d *OVNDriver) storeEndpointMetadata(lsName string, endpointID string, macAddr string, ipAddr string) error {
-	ls, found, err := d.ovn.GetLogicalSwitch(lsName)
+	bridge := d.bridgeFor(r.NetworkID)
+	localVethName := d.vethName(r.EndpointID, r.NetworkID)
+	pooled, claimed := false, false
+	if d.nested == nil {
+		if name, ok := d.vethPool.Take(bridge); ok {
+			localVethName, pooled = name, true
+			// A Join failing before the pair is claimed deletes it
+			defer func() {
+				if !claimed {
+					d.vethPool.remove(name)
+				}
+			}()
+		}
+	}
+	containerVethName := localVethName + containerVethSuffix
+
+	sandboxIDs := map[string]string{
+		"docker:sandbox":         r.SandboxKey,
+		"docker:default_gateway": strconv.FormatBool(gateway != ""),
+	}
+	if pooled {
+		sandboxIDs[vethExternalIDKey] = localVethName
+	}
+	sandboxOps, err := d.ovn.UpdateLogicalSwitchPortExternalIDsOp(lsp, sandboxIDs)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to create update operation for logical switch port: %w", err)
 	}
-	if !found {
-		return fmt.Errorf("logical switch %s not found", lsName)
+	results, err := d.ovn.Transact(sandboxOps...)
+	if err := transactError(err, results); err != nil {
+		return nil, fmt.Errorf("failed to record sandbox on logical switch port: %w", err)
 	}
 
-	macKey := endpointOtherConfigKey(endpointID, "mac")
-	ipKey := endpointOtherConfigKey(endpointID, "ip")
-	mutateOps, err := d.ovn.MutateLogicalSwitchOtherConfigOp(ls, ovsdb.MutateOperationInsert, map[string]string{
-		macKey: macAddr,
-		ipKey:  ipAddr,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create mutate operation for endpoint metadata: %w", err)
+	// Interfaces are not created for a Join Docker already gave up on
+	if err := d.context().Err(); err != nil {
+		return nil, err
+	}
+	// A queued Leave may still hold the interface names
+	d.cleanups.Flush(func(c cleanupIntent) bool { return c.Kind == cleanupLeave && c.Veth == localVethName })
+	if d.nested != nil {
+		// The VLAN interface itself moves into the container
+		containerVethName = localVethName
+		if err := d.nested.addInterface(localVethName, lsp, macAddr); err != nil {
+			return nil, err
+		}
+	} else if pooled {
+		if err := d.claimPooledVeth(localVethName, macAddr, interfaceBinding(lsp)); err != nil {
+			return nil, err
+		}
+		claimed = true
+	} else if err := d.plugVeth(bridge, localVethName, containerVethName, macAddr, interfaceBinding(lsp)); err != nil {
+		return nil, err
 	}
 
-	results, err := d.ovn.Transact(mutateOps...)
-	if err != nil {
-		return fmt.Errorf("failed to store endpoint metadata: %w", err)
+	if d.dns != nil {
+		if fields := strings.Fields(lsp.Addresses[0]); len(fields) > 1 {
+			d.dns.Register(r.NetworkID, r.EndpointID, fields[1], func(fqdn string) {
+				d.recordDNSName(portName, fqdn)
+			})
+		}
 	}
-	if len(results) > 0 && results[0].Error != "" {
-		return fmt.Errorf("failed to store endpoint metadata: %s", results[0].Error)
+
+	if d.docker != nil {
+		d.onContainerJoined(r.NetworkID, r.EndpointID, r.SandboxKey, portName, localVethName)
 	}
 
-	return nil
+	d.logf("Join complete: returning gateway %s", gateway)
+	return &network.JoinResponse{
+		InterfaceName: network.InterfaceName{
+			SrcName:   containerVethName,
+			DstPrefix: "eth",
+		},
+		Gateway:               gateway,
+		StaticRoutes:          hostRoutes,
+		DisableGatewayService: secondary,
+	}, nil
 }
 
-func (d *OVNDriver) deleteEndpointMetadata(lsName string, endpointID string) error {
-	ls, found, err := d.ovn.GetLogicalSwitch(lsName)
-	if err != nil {
-		return err
+// plugVeth creates the veth pair of an endpoint and plugs its host end into
+// the integration bridge of its network, bound to the logical switch port
+func (d *OVNDriver) plugVeth(bridge string, localVethName string, containerVethName string, macAddr string, binding map[string]string) error {
+	d.logf("Creating veth pair: %s <-> %s", localVethName, containerVethName)
+	if _, err := runCommand("ip", "link", "add", localVethName,
+		"type", "veth", "peer", "name", containerVethName); err != nil {
+		return fmt.Errorf("failed to create veth pair: %w", err)
 	}
-	if !found {
-		log.Printf("Warning: logical switch %s not found while deleting endpoint metadata", lsName)
-		return nil
+
+	if _, err := runCommand("ip", "link", "set", containerVethName, "address", macAddr); err != nil {
+		cleanupCommand("ip", "link", "del", localVethName)
+		return fmt.Errorf("failed to set MAC address: %w", err)
 	}
 
-	macKey := endpointOtherConfigKey(endpointID, "mac")
-	ipKey := endpointOtherConfigKey(endpointID, "ip")
-	mutateOps, err := d.ovn.MutateLogicalSwitchOtherConfigOp(ls, ovsdb.MutateOperationDelete, map[string]string{
-		macKey: "",
-		ipKey:  "",
-	})
-	if err != nil {
-		log.Printf("Warning: failed to create mutate operation for endpoint metadata delete: %v", err)
-		return nil
+	if _, err := runCommand("ip", "link", "set", localVethName, "up"); err != nil {
+		cleanupCommand("ip", "link", "del", localVethName)
+		return fmt.Errorf("failed to bring up host veth: %w", err)
 	}
-	results, err := d.ovn.Transact(mutateOps...)
-	if err != nil {
-		log.Printf("Warning: failed to delete endpoint metadata: %v", err)
-		return nil
+
+	ovsPortName := localVethName
+	if err := d.ovs.AddPortToBridge(bridge, ovsPortName, localVethName, binding); err != nil {
+		cleanupCommand("ip", "link", "del", localVethName)
+		return fmt.Errorf("failed to add veth to OVS: %w", err)
 	}
-	if len(results) > 0 && results[0].Error != "" {
-		log.Printf("Warning: failed to delete endpoint metadata: %s", results[0].Error)
-		return nil
+
+	cleanupCommand("ethtool", "-K", localVethName, "tx", "off")
+	cleanupCommand("ethtool", "-K", containerVethName, "tx", "off")
+	return nil
+}
+
+// Leave disconnects the endpoint; the logical switch port lives until DeleteEndpoint
+func (d *OVNDriver) Leave(r *network.LeaveRequest) error {
+	d.logf("Leave: endpoint %s", r.EndpointID)
+
+	intent := cleanupIntent{
+		Kind:       cleanupLeave,
+		NetworkID:  r.NetworkID,
+		EndpointID: r.EndpointID,
+		Port:       d.portName(r.EndpointID, r.NetworkID),
+		Veth:       d.vethName(r.EndpointID, r.NetworkID),
+		Bridge:     d.bridgeFor(r.NetworkID),
+	}
+	if lsp, found, err := d.ovn.GetLogicalSwitchPort(intent.Port); err == nil && found {
+		intent.Veth = d.endpointVeth(lsp)
+		if d.dns != nil {
+			intent.DNSName = lsp.ExternalIDs["docker:dns_name"]
+		}
 	}
-	log.Printf("Deleted endpoint %s metadata", endpointID[:12])
+	d.cleanup(intent)
 	return nil
 }
 
-func (d *OVNDriver) getEndpointMetadata(lsName string, endpointID string) (string, string, string, error) {
-	ls, found, err := d.ovn.GetLogicalSwitch(lsName)
+// recordDNSName stores the exported DNS name on the port so Leave can remove
+// the record even after a plugin restart
+func (d *OVNDriver) recordDNSName(portName string, fqdn string) {
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil || !found {
+		return
+	}
+	ops, err := d.ovn.UpdateLogicalSwitchPortExternalIDsOp(lsp, map[string]string{
+		"docker:dns_name": fqdn,
+	})
+	if err == nil {
+		_, err = d.ovn.Transact(ops...)
+	}
 	if err != nil {
-		return "", "", "", err
+		d.logf("Warning: failed to record DNS name on %s: %v", portName, err)
 	}
-	if !found {
-		return "", "", "", fmt.Errorf("logical switch %s not found", lsName)
+}
+
+const (
+	addressPairsOption  = "ovn.allowed_address_pairs"
+	sharedNetworkOption = "ovn.shared_network"
+	localnetOption      = "ovn.localnet"
+	dryRunOption        = "ovn.dry_run"
+	excludeIPsOption    = "ovn.exclude_ips"
+	noGatewayOption     = "ovn.no_default_gateway"
+)
+
+// networkOtherConfigKey marks a Docker network ID (one per host) as attached
+// to a switch; the value is the chassis system-id of that host
+func networkOtherConfigKey(networkID string) string {
+	return "docker:network:" + networkID
+}
+
+// switchNetworkIDs returns the Docker network IDs attached to a switch
+func switchNetworkIDs(ls *LogicalSwitch) []string {
+	seen := map[string]bool{}
+	ids := []string{}
+	if id := ls.OtherConfig["docker:network"]; id != "" {
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	for key := range ls.OtherConfig {
+		id, ok := strings.CutPrefix(key, "docker:network:")
+		if ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
 	}
+	return ids
+}
 
-	macKey := endpointOtherConfigKey(endpointID, "mac")
-	ipKey := endpointOtherConfigKey(endpointID, "ip")
-	macAddr := ls.OtherConfig[macKey]
-	ipAddr := ls.OtherConfig[ipKey]
-	gateway := ls.OtherConfig["docker:gateway"]
-	if macAddr == "" || ipAddr == "" {
-		return "", "", "", fmt.Errorf("endpoint metadata not found in logical switch %s", lsName)
+func validSharedNetworkName(name string) bool {
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
 	}
-	return macAddr, ipAddr, gateway, nil
+	return true
 }
 
-func (d *OVNDriver) deleteLogicalSwitchPort(switchName string, portName string) error {
+// deleteLogicalSwitchPortOps detaches a port from its switch and deletes it;
+// a port that no longer exists yields no operations
+func (d *OVNDriver) deleteLogicalSwitchPortOps(ls *LogicalSwitch, portName string) ([]ovsdb.Operation, error) {
 	lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !found {
-		return nil
+		return nil, nil
 	}
 
-	ops := []ovsdb.Operation{}
-	if ls, found, err := d.ovn.GetLogicalSwitch(switchName); err == nil && found {
-		mutateOps, err := d.ovn.MutateLogicalSwitchPortsOp(ls, ovsdb.MutateOperationDelete, []string{lsp.UUID})
-		if err != nil {
-			log.Printf("Warning: failed to create mutate operation to remove port from switch: %v", err)
-		} else {
-			ops = append(ops, mutateOps...)
-		}
-	}
-
-	lspOps, err := d.ovn.DeleteLogicalSwitchPortOp(lsp)
+	ops, err := d.ovn.MutateLogicalSwitchPortsOp(ls, ovsdb.MutateOperationDelete, []string{lsp.UUID})
 	if err != nil {
-		return fmt.Errorf("failed to create delete operation for LSP: %w", err)
+		return nil, fmt.Errorf("failed to create mutate operation to remove port from switch: %w", err)
 	}
-	ops = append(ops, lspOps...)
 
-	results, err := d.ovn.Transact(ops...)
+	lspOps, err := d.ovn.DeleteLogicalSwitchPortOp(lsp)
 	if err != nil {
-		return err
-	}
-	for _, res := range results {
-		if res.Error != "" {
-			return fmt.Errorf("transaction error: %s", res.Error)
-		}
+		return nil, fmt.Errorf("failed to create delete operation for LSP: %w", err)
 	}
-
-	log.Printf("Deleted logical switch port %s from OVN", portName)
-	return nil
+	return append(ops, lspOps...), nil
 }
 
 // ProgramExternalConnectivity sets up external connectivity
@@ -455,9 +1104,45 @@ func (d *OVNDriver) FreeNetwork(r *network.FreeNetworkRequest) error {
 	return nil
 }
 
-// EndpointInfo returns endpoint information
+// EndpointInfo returns endpoint information, including the chassis the port
+// is bound to when the southbound database is available
 func (d *OVNDriver) EndpointInfo(r *network.InfoRequest) (*network.InfoResponse, error) {
-	return &network.InfoResponse{}, nil
+	portName := d.portName(r.EndpointID, r.NetworkID)
+
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// docker inspect still has to work for endpoints whose port is gone
+		d.logf("Warning: EndpointInfo: logical switch port %s not found", portName)
+		return &network.InfoResponse{Value: map[string]string{}}, nil
+	}
+
+	localVethName := d.endpointVeth(lsp)
+	info := EndpointInfo{
+		PortName:    portName,
+		VethHost:    localVethName,
+		OVSPortName: localVethName,
+	}
+	if len(lsp.Addresses) > 0 {
+		fields := strings.Fields(lsp.Addresses[0])
+		info.MacAddr = fields[0]
+		if len(fields) > 1 {
+			info.IPAddr = fields[1]
+		}
+	}
+
+	if d.sb != nil {
+		info.Binding, err = d.sb.GetPortBindingStatus(portName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	values := info.Values()
+	d.lastErrorValues(values, r.NetworkID, r.EndpointID)
+	return &network.InfoResponse{Value: values}, nil
 }
 
 // generateMAC creates a MAC address from endpoint ID
@@ -470,62 +1155,165 @@ func generateMAC(endpointID string) string {
 		mac[0], mac[1], mac[2], mac[3], mac[4], mac[5])
 }
 
-func envOrDefault(key string, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// networkOption returns a string option passed with -o on network create
+func networkOption(options map[string]interface{}, key string) string {
+	generic, _ := options["com.docker.network.generic"].(map[string]interface{})
+	if value, ok := generic[key].(string); ok {
+		return strings.TrimSpace(value)
 	}
-	return defaultValue
+	return ""
 }
 
-func main() {
-	bridge := envOrDefault("OVN_BRIDGE", "br-int")
-	ovsSocket := envOrDefault("OVS_SOCKET", "unix:/var/run/openvswitch/db.sock")
+// endpointOption returns a string option passed with --driver-opt on connect/run
+func endpointOption(options map[string]interface{}, key string) string {
+	if value, ok := options[key].(string); ok {
+		return strings.TrimSpace(value)
+	}
+	return ""
+}
 
-	const DOCKER_PLUGIN_SOCKET = "/run/docker/plugins/ovn.sock"
+// parseAddressPairs parses a comma separated list of "MAC IP [IP...]" or bare
+// "IP" entries into port_security entries. Bare IPs use the endpoint MAC.
+func parseAddressPairs(value string, defaultMAC string) ([]string, error) {
+	pairs := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
 
-	ctx := context.Background()
+		macAddr := defaultMAC
+		if hw, err := net.ParseMAC(fields[0]); err == nil {
+			macAddr = hw.String()
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("entry %q has no IP address", entry)
+		}
 
-	ovsDBModel, err := model.NewClientDBModel("Open_vSwitch",
-		map[string]model.Model{
-			"Bridge":       &Bridge{},
-			"Port":         &Port{},
-			"Interface":    &Interface{},
-			"Open_vSwitch": &OpenvSwitch{},
-		})
-	if err != nil {
-		log.Fatalf("Failed to create OVS DB model: %v", err)
+		for _, addr := range fields {
+			if net.ParseIP(addr) != nil {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(addr); err != nil {
+				return nil, fmt.Errorf("entry %q: %s is not an IP address or CIDR", entry, addr)
+			}
+		}
+		pairs = append(pairs, macAddr+" "+strings.Join(fields, " "))
 	}
+	return pairs, nil
+}
 
-	var discartLogger logr.Logger = logr.Discard()
-	ovsClient, err := client.NewOVSDBClient(
-		ovsDBModel,
-		client.WithEndpoint(ovsSocket),
-		client.WithLogger(&discartLogger),
-	)
+// splitAddressPairs splits the docker:address_pairs of an endpoint port
+func splitAddressPairs(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func main() {
+	cfg, err := LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		log.Fatalf("Failed to create OVS client: %v", err)
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	if err := ovsClient.Connect(ctx); err != nil {
-		log.Fatalf("Failed to connect to OVS database: %v", err)
+	names := NameTemplates{Switch: cfg.SwitchNameTemplate, Port: cfg.PortNameTemplate, Veth: cfg.VethNameTemplate}
+	if err := names.Validate(); err != nil {
+		log.Fatalf("Invalid naming template: %v", err)
 	}
 
-	if _, err := ovsClient.Monitor(ctx,
-		ovsClient.NewMonitor(
-			client.WithTable(&Bridge{}),
-			client.WithTable(&Port{}),
-			client.WithTable(&Interface{}),
-			client.WithTable(&OpenvSwitch{}),
-		),
-	); err != nil {
-		log.Fatalf("Failed to monitor OVS database: %v", err)
+	if cfg.LogFile != "" {
+		logFile, err := os.OpenFile(cfg.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		log.SetOutput(logFile)
+	}
+	// libovsdb logs through logr; route it to the plugin log, and with debug
+	// enabled include its connection and transaction details
+	ovsdbLogger := stdr.New(log.Default()).WithName("libovsdb")
+	if cfg.Debug {
+		stdr.SetVerbosity(5)
 	}
 
-	ovsAPI := NewOVSAPI(ovsClient, ctx)
+	ctx := context.Background()
 
-	ovnNBConn, err := ovsAPI.GetOVNNBConnection()
-	if err != nil {
-		log.Fatalf("Failed to get OVN NB connection: %v", err)
+	startup := DBStartupConfig{
+		Timeout: cfg.DBConnectTimeout,
+		Retries: cfg.DBConnectRetries,
+	}
+
+	// Nested inside a VM or container there is no local OVS: endpoints are
+	// child ports of the host's own port, switched by the chassis below it
+	var nested *NestedParent
+	var ovsClient client.Client
+	var ovsAPI *OVSAPI
+	var ovsCertReloader *CertReloader
+	if cfg.NestedParentPort != "" {
+		if cfg.OVNNBAddr == "" {
+			log.Fatalf("nested_parent_port requires ovn_nb_addr")
+		}
+		nested = &NestedParent{Port: cfg.NestedParentPort, Interface: cfg.NestedInterface}
+		log.Printf("Nested mode: endpoints are child ports of %s on %s", nested.Port, nested.Interface)
+	} else {
+		ovsDBModel, err := model.NewClientDBModel("Open_vSwitch",
+			map[string]model.Model{
+				"Bridge":       &Bridge{},
+				"Port":         &Port{},
+				"Interface":    &Interface{},
+				"Open_vSwitch": &OpenvSwitch{},
+			})
+		if err != nil {
+			log.Fatalf("Failed to create OVS DB model: %v", err)
+		}
+		ovsDBModel.SetIndexes(ovsClientIndexes())
+
+		ovsLogger := logr.Discard()
+		if cfg.Debug {
+			ovsLogger = ovsdbLogger
+		}
+		ovsOptions := []client.Option{
+			client.WithEndpoint(cfg.OVSSocket),
+			client.WithLogger(&ovsLogger),
+		}
+		var ovsTLSOptions []client.Option
+		ovsTLSOptions, ovsCertReloader, err = tlsClientOptions(cfg.OVSSocket, cfg.OVSTLS())
+		if err != nil {
+			log.Fatalf("Failed to configure OVS TLS: %v", err)
+		}
+		ovsOptions = append(ovsOptions, ovsTLSOptions...)
+
+		ovsClient, err = client.NewOVSDBClient(ovsDBModel, ovsOptions...)
+		if err != nil {
+			log.Fatalf("Failed to create OVS client: %v", err)
+		}
+
+		if err := connectWithRetry(ctx, "OVS", ovsClient, startup); err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		// The NB endpoint is read from the Open_vSwitch row, so monitor that small
+		// table first and bring up the NB client while the port tables sync
+		if err := monitorWithTimeout(ctx, "OVS", ovsClient, startup, ovsSystemMonitorOptions()...); err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		ovsAPI = NewOVSAPI(ovsClient, ctx)
+		ovsAPI.SetDebug(cfg.Debug)
+	}
+
+	// An explicit address skips the lookup, for hosts whose local OVS does not
+	// carry external_ids:ovn-nb
+	ovnNBConn := normalizeOVNConnection(cfg.OVNNBAddr)
+	if cfg.OVNNBAddr == "" {
+		ovnNBConn, err = ovsAPI.GetOVNNBConnection()
+		if err != nil {
+			log.Fatalf("Failed to get OVN NB connection: %v", err)
+		}
 	}
 
 	log.Printf("Using OVN NB connection: %s", ovnNBConn)
@@ -534,45 +1322,331 @@ func main() {
 		map[string]model.Model{
 			"Logical_Switch":      &LogicalSwitch{},
 			"Logical_Switch_Port": &LogicalSwitchPort{},
+			"DHCP_Options":        &DHCPOptions{},
+			"QoS":                 &QoS{},
 		})
 	if err != nil {
 		log.Fatalf("Failed to create OVN NB DB model: %v", err)
 	}
+	ovnNBModel.SetIndexes(ovnNBClientIndexes())
+
+	ovnNBRelays := splitEndpoints(cfg.OVNNBRelays)
+	ovnNBEndpoints := preferRelays(ovnNBRelays, splitEndpoints(ovnNBConn))
+	if len(ovnNBRelays) > 0 {
+		log.Printf("Preferring OVN NB relays: %s", strings.Join(ovnNBEndpoints, ","))
+	}
+	if cfg.OVNNBLeaderOnly && len(ovnNBRelays) > 0 {
+		log.Println("Warning: ovn_nb_leader_only is ignored with ovn_nb_relays, relays forward writes to the leader")
+	}
+	ovnNBOptions, ovnNBCertReloader, err := dbClientOptions(ovnNBEndpoints, cfg.OVNNBTLS(), len(ovnNBRelays) > 0, cfg.OVNNBLeaderOnly)
+	if err != nil {
+		log.Fatalf("Failed to configure OVN NB TLS: %v", err)
+	}
+	ovnNBOptions = append(ovnNBOptions, client.WithLogger(&ovsdbLogger))
 
-	ovnNBClient, err := client.NewOVSDBClient(ovnNBModel, client.WithEndpoint(ovnNBConn))
+	ovnNBClient, err := client.NewOVSDBClient(ovnNBModel, ovnNBOptions...)
 	if err != nil {
 		log.Fatalf("Failed to create OVN NB client: %v", err)
 	}
 
-	if err := ovnNBClient.Connect(ctx); err != nil {
-		log.Fatalf("Failed to connect to OVN NB database: %v", err)
+	// The southbound connection is optional and only used to report bindings
+	var ovnSBClient client.Client
+	var ovnSBCertReloader *CertReloader
+	ovnSBRelays := splitEndpoints(cfg.OVNSBRelays)
+	ovnSBEndpoints := preferRelays(ovnSBRelays, splitEndpoints(cfg.OVNSB))
+	if len(ovnSBEndpoints) > 0 {
+		log.Printf("Using OVN SB connection: %s", strings.Join(ovnSBEndpoints, ","))
+
+		ovnSBModel, err := newSBClientDBModel()
+		if err != nil {
+			log.Fatalf("Failed to create OVN SB DB model: %v", err)
+		}
+		var ovnSBOptions []client.Option
+		ovnSBOptions, ovnSBCertReloader, err = dbClientOptions(ovnSBEndpoints, cfg.OVNSBTLS(), len(ovnSBRelays) > 0, false)
+		if err != nil {
+			log.Fatalf("Failed to configure OVN SB TLS: %v", err)
+		}
+		ovnSBOptions = append(ovnSBOptions, client.WithLogger(&ovsdbLogger))
+
+		ovnSBClient, err = client.NewOVSDBClient(ovnSBModel, ovnSBOptions...)
+		if err != nil {
+			log.Fatalf("Failed to create OVN SB client: %v", err)
+		}
 	}
 
-	if _, err := ovnNBClient.Monitor(ctx,
-		ovnNBClient.NewMonitor(
-			client.WithTable(&LogicalSwitch{}),
-			client.WithTable(&LogicalSwitchPort{}),
-		),
-	); err != nil {
-		log.Fatalf("Failed to monitor OVN NB database: %v", err)
+	networks := NewNetworkCache()
+	restorer := NewOVSPortRestorer()
+	var bgp *BGPSpeaker
+	if cfg.BGPASN > 0 {
+		bgp = NewBGPSpeaker(cfg.BGPASN, cfg.BGPVtysh)
+	}
+	kubeOVN := cfg.KubeOVNCompat
+	tenant := cfg.Tenant
+	namePrefix := cfg.ResourcePrefix
+	if namePrefix == "" && kubeOVN {
+		namePrefix = kubeOVNSwitchPrefix
+	}
+	if err := validResourcePrefix(namePrefix); err != nil {
+		log.Fatalf("Invalid resource_prefix: %v", err)
+	}
+
+	err = runParallel(
+		func() error {
+			if ovsClient == nil {
+				return nil
+			}
+			ovsClient.Cache().AddEventHandler(restorer.EventHandler())
+			return monitorWithTimeout(ctx, "OVS", ovsClient, startup, ovsPortMonitorOptions()...)
+		},
+		func() error {
+			if err := connectWithRetry(ctx, "OVN NB", ovnNBClient, startup); err != nil {
+				return err
+			}
+			ovnNBClient.Cache().AddEventHandler(networks.EventHandler())
+			if bgp != nil {
+				ovnNBClient.Cache().AddEventHandler(bgp.EventHandler())
+			}
+			if err := monitorWithTimeout(ctx, "OVN NB", ovnNBClient, startup, ownedMonitorOptions(tenant)...); err != nil {
+				return err
+			}
+			if kubeOVN {
+				return monitorWithTimeout(ctx, "OVN NB kube-ovn", ovnNBClient, startup, kubeOVNMonitorOptions()...)
+			}
+			return nil
+		},
+		func() error {
+			if ovnSBClient == nil {
+				return nil
+			}
+			if err := connectWithRetry(ctx, "OVN SB", ovnSBClient, startup); err != nil {
+				return err
+			}
+			return monitorWithTimeout(ctx, "OVN SB", ovnSBClient, startup, sbMonitorOptions(tenant)...)
+		},
+	)
+	if err != nil {
+		log.Fatalf("%v", err)
 	}
 
 	log.Println("Successfully connected to OVS and OVN databases")
 
+	// A standby keeps its database connections warm and only touches OVN or
+	// the plugin socket once it is the active instance
+	if cfg.InstanceLock != "" && !cfg.CleanupOrphans {
+		instanceLock, err := acquireInstanceLock(cfg.InstanceLock)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer instanceLock.Close()
+	}
+
+	if !cfg.CleanupOrphans {
+		chassisConfig := map[string]string{}
+		if cfg.OVNEncapType != "" {
+			encapType, err := parseEncapType(cfg.OVNEncapType)
+			if err != nil {
+				log.Fatalf("Invalid ovn_encap_type: %v", err)
+			}
+			chassisConfig["ovn-encap-type"] = encapType
+		}
+		if cfg.OVNEncapIP != "" {
+			encapIP, err := resolveEncapIP(cfg.OVNEncapIP)
+			if err != nil {
+				log.Fatalf("Invalid ovn_encap_ip: %v", err)
+			}
+			chassisConfig["ovn-encap-ip"] = encapIP
+		}
+		if err := configureChassis(ovsAPI, chassisConfig); err != nil {
+			log.Fatalf("Failed to configure chassis: %v", err)
+		}
+		checkEncapIP(ovsAPI)
+	}
+
+	flavors, err := loadFlavors(cfg.FlavorsDir, pluginDriverName(cfg.PluginSocket))
+	if err != nil {
+		log.Fatalf("Invalid flavors: %v", err)
+	}
+
+	uplink, err := parseProviderUplink(cfg.ProviderUplink, cfg.ProviderBondMode, cfg.ProviderLACP, cfg.ProviderTrunks)
+	if err != nil {
+		log.Fatalf("Invalid provider uplink: %v", err)
+	}
+	if uplink != nil && !cfg.CleanupOrphans {
+		if err := configureUplink(ovsAPI, uplink); err != nil {
+			log.Fatalf("Failed to configure provider uplink: %v", err)
+		}
+		if status := ovsAPI.uplinkStatus(uplink); !status.Up {
+			log.Printf("Warning: uplink %s of %s has no NIC with link yet", status.Port, uplink.Bridge)
+		}
+	}
+
+	tlsReloadInterval := cfg.TLSReloadInterval
+	if ovsCertReloader != nil && tlsReloadInterval > 0 {
+		go ovsCertReloader.Watch(ctx, tlsReloadInterval, ovsClient.Disconnect)
+	}
+	if ovnNBCertReloader != nil && tlsReloadInterval > 0 {
+		go ovnNBCertReloader.Watch(ctx, tlsReloadInterval, ovnNBClient.Disconnect)
+	}
+	if ovnSBCertReloader != nil && tlsReloadInterval > 0 {
+		go ovnSBCertReloader.Watch(ctx, tlsReloadInterval, ovnSBClient.Disconnect)
+	}
+
 	ovnAPI := NewOVNAPI(ovnNBClient, ctx)
+	ovnAPI.SetTransactRetryTimeout(cfg.OVNNBTxnRetryTimeout)
+	ovnAPI.SetTransactAttemptTimeout(cfg.OVNNBTxnTimeout)
+	ovnAPI.SetDebug(cfg.Debug)
+	ovnAPI.SetNetworkCache(networks)
+	if kubeOVN {
+		ovnAPI.SetExternalID(kubeOVNVendorKey, driverVendor)
+		log.Println("kube-ovn compatibility mode enabled")
+	}
+	if tenant != "" {
+		ovnAPI.SetExternalID(tenantExternalIDKey, tenant)
+		log.Printf("Managing OVN rows of tenant %s", tenant)
+	}
+
+	var sbAPI *SBAPI
+	if ovnSBClient != nil {
+		sbAPI = NewSBAPI(ovnSBClient, ctx)
+		metricsRegistry.MustRegister(newPortBindingCollector(sbAPI))
+	}
+
+	driver := NewOVNDriver(cfg.Bridge, cfg.OVSSocket, ovsAPI, ovnAPI, networks, cfg.JoinWorkers, kubeOVN, namePrefix, sbAPI)
+
+	driver.names = names
+	driver.nested = nested
+	driver.uplink = uplink
+	if cfg.CleanupOrphans {
+		driver.docker = NewDockerClient(cfg.DockerSocket)
+		if err := driver.cleanupOrphans(driverNames(pluginDriverName(cfg.PluginSocket), flavors), cfg.CleanupOrphansForce, os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("Orphan cleanup failed: %v", err)
+		}
+		return
+	}
+	if release, err := ovnAPI.NorthdRelease(); err != nil {
+		log.Printf("Warning: failed to read the ovn-northd version: %v", err)
+	} else {
+		driver.northdRelease = release
+	}
+	driver.migrateEndpointMetadata()
+	driver.restoreManagementPorts()
+	if cfg.JournalDir != "" {
+		journal, err := NewJournal(cfg.JournalDir)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		driver.journal = journal
+		driver.recoverJoins()
+	}
+	if driver.ovs != nil {
+		driver.vethPool = NewVethPool(driver.ovs, cfg.Bridge, cfg.VethPoolSize)
+	}
+	if cfg.DeferredCleanup {
+		driver.cleanups = NewCleanupQueue(driver)
+		driver.cleanups.Resume()
+		metricsRegistry.MustRegister(newCleanupQueueGauge(driver.cleanups))
+	}
+	if cfg.SwitchNaming != switchNamingID && cfg.SwitchNaming != switchNamingName {
+		log.Fatalf("Invalid switch_naming %q: must be %s or %s", cfg.SwitchNaming, switchNamingID, switchNamingName)
+	}
+	driver.switchNaming = cfg.SwitchNaming
+	driver.labels = ParseLabelFilter(cfg.PropagateLabels)
+	driver.docker = NewDockerClient(cfg.DockerSocket)
+
+	if cfg.DNSExportEtcd != "" {
+		backend := NewEtcdDNSBackend(cfg.DNSExportEtcd, cfg.DNSExportPrefix, cfg.DNSExportTTL)
+		driver.dns = NewDNSExporter(ctx, backend, driver.docker, cfg.DNSExportZone)
+		log.Printf("Exporting container DNS records to %s", cfg.DNSExportEtcd)
+	}
+
+	ipamHook, err := NewIPAMHook(cfg.IPAMHookURL, cfg.IPAMHookCommand, cfg.IPAMHookFailurePolicy, cfg.IPAMHookTimeout)
+	if err != nil {
+		log.Fatalf("Invalid IPAM hook configuration: %v", err)
+	}
+	driver.ipamHook = ipamHook
+
+	webhooks, err := NewWebhooks(ctx, cfg.WebhookURLs, cfg.WebhookEvents, cfg.WebhookSecret, cfg.WebhookTimeout)
+	if err != nil {
+		log.Fatalf("Invalid webhook configuration: %v", err)
+	}
+	driver.webhooks = webhooks
+
+	if ovsAPI != nil {
+		metricsRegistry.MustRegister(newEndpointStatsCollector(driver))
+	}
+	if cfg.MetricsAddr != "" {
+		go serveMetrics(cfg.MetricsAddr)
+	}
+	if cfg.InventoryAddr != "" {
+		go serveInventory(cfg.InventoryAddr, driver)
+	}
+
+	if cfg.AdminSocket != "" {
+		tracer := NewTracer(strings.Join(ovnSBEndpoints, ","), cfg.OVNSBTLS())
+		go NewAdminServer(driver, tracer).Serve(cfg.AdminSocket)
+	}
+
+	if ovsAPI != nil {
+		go restorer.Run(ctx, driver)
+	}
+
+	if bgp != nil {
+		go bgp.Run(ctx, driver)
+	}
 
-	driver := NewOVNDriver(bridge, ovsSocket, ovsAPI, ovnAPI)
+	if cfg.PortSecurityAuditInterval > 0 && ovsAPI != nil {
+		auditor := NewPortSecurityAuditor(ovsAPI, ovnAPI, cfg.PortSecurityAuditRepair)
+		go auditor.Run(ctx, cfg.PortSecurityAuditInterval)
+	}
 
-	pluginDir := filepath.Dir(DOCKER_PLUGIN_SOCKET)
-	if err := os.MkdirAll(pluginDir, 0o755); err != nil {
-		log.Fatalf("Failed to create plugin directory: %v", err)
+	if cfg.OVSReconcileInterval > 0 && ovsAPI != nil {
+		reconciler := NewOVSReconciler(driver, cfg.OVSReconcileRepair)
+		go reconciler.Run(ctx, cfg.OVSReconcileInterval)
 	}
 
-	os.Remove(DOCKER_PLUGIN_SOCKET)
+	socketMode, err := parseFileMode(cfg.PluginSocketMode)
+	if err != nil {
+		log.Fatalf("Invalid plugin_socket_mode: %v", err)
+	}
+	socketDirMode, err := parseFileMode(cfg.PluginDirMode)
+	if err != nil {
+		log.Fatalf("Invalid plugin_dir_mode: %v", err)
+	}
+
+	socketConfig := SocketConfig{
+		Path:    cfg.PluginSocket,
+		Group:   cfg.PluginSocketGroup,
+		Mode:    socketMode,
+		DirMode: socketDirMode,
+	}
+	listener, err := activatedListener()
+	if err != nil {
+		log.Fatalf("Failed to use activated plugin socket: %v", err)
+	}
+	if listener != nil {
+		// Docker derives the driver name from the socket file name
+		if addr := listener.Addr().String(); addr != cfg.PluginSocket {
+			log.Fatalf("Activated plugin socket %s does not match plugin_socket %s", addr, cfg.PluginSocket)
+		}
+		log.Printf("Using plugin socket %s passed by systemd", cfg.PluginSocket)
+	} else {
+		listener, err = listenPluginSocket(socketConfig)
+		if err != nil {
+			log.Fatalf("Failed to create plugin socket: %v", err)
+		}
+	}
+
+	if cfg.ValidateDocker {
+		go driver.validateDockerState(driverNames(pluginDriverName(cfg.PluginSocket), flavors))
+	}
+	if cfg.DockerEvents {
+		go NewDockerEventWatcher(driver).Run(ctx)
+	}
 
-	handler := network.NewHandler(driver)
-	log.Printf("Starting OVN plugin on %s", DOCKER_PLUGIN_SOCKET)
-	if err := handler.ServeUnix(DOCKER_PLUGIN_SOCKET, 0); err != nil {
+	serveFlavors(driver, flavors, socketConfig)
+	handler := newPluginHandler(driver, nil)
+	log.Printf("Starting OVN plugin on %s", cfg.PluginSocket)
+	if err := handler.Serve(listener); err != nil {
 		log.Fatalf("Failed to start plugin: %v", err)
 	}
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAddressPairs(t *testing.T) {
+	const endpointMAC = "02:00:00:00:00:01"
+
+	pairs, err := parseAddressPairs("00:00:5E:00:01:01 172.16.0.100 172.16.0.101, 172.16.0.50,,10.1.0.0/24, 02:00:00:00:00:02 fd00::20 fd00:1::/64", endpointMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"00:00:5e:00:01:01 172.16.0.100 172.16.0.101",
+		endpointMAC + " 172.16.0.50",
+		endpointMAC + " 10.1.0.0/24",
+		"02:00:00:00:00:02 fd00::20 fd00:1::/64",
+	}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Errorf("parseAddressPairs() = %q, want %q", pairs, want)
+	}
+
+	if pairs, err := parseAddressPairs("", endpointMAC); err != nil || len(pairs) != 0 {
+		t.Errorf("parseAddressPairs(\"\") = %q, %v, want no pairs", pairs, err)
+	}
+
+	for _, value := range []string{
+		"00:00:5e:00:01:01",
+		"00:00:5e:00:01 172.16.0.100",
+		"02:00:00:00:00:02 172.16.0.300",
+		"172.16.0.100 vip",
+		"fd00::20/129",
+	} {
+		if _, err := parseAddressPairs(value, endpointMAC); err == nil {
+			t.Errorf("parseAddressPairs(%q) accepted a malformed entry", value)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-plugins-helpers/network"
+)
+
+// hostMasqueradeOption sends the traffic of containers to the addresses of
+// their host through the host's management port, masqueraded to the port's
+// address so host services answer it like a local client
+const hostMasqueradeOption = "ovn.host_masquerade"
+
+// routeTypeNextHop is libnetwork's types.NEXTHOP
+const routeTypeNextHop = 0
+
+// managementAddress returns the address of this host's management port on a
+// switch, empty when it has none
+func (d *OVNDriver) managementAddress(switchName string) (string, error) {
+	node, err := d.nodeName()
+	if err != nil {
+		return "", err
+	}
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(managementPortName(switchName, node))
+	if err != nil || !found || len(lsp.Addresses) == 0 {
+		return "", err
+	}
+	if fields := strings.Fields(lsp.Addresses[0]); len(fields) > 1 {
+		return fields[1], nil
+	}
+	return "", nil
+}
+
+// hostRoutes returns the routes of a joining container to the addresses of
+// this host through its management port. Loopback addresses, those of the
+// network itself and of management ports are left out.
+func (d *OVNDriver) hostRoutes(netConfig NetworkConfig) ([]*network.StaticRoute, error) {
+	nextHop, err := d.managementAddress(netConfig.SwitchName)
+	if err != nil {
+		return nil, err
+	}
+	if nextHop == "" {
+		return nil, fmt.Errorf("this host has no management port on %s", netConfig.SwitchName)
+	}
+	_, subnet, err := net.ParseCIDR(netConfig.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet of %s: %w", netConfig.SwitchName, err)
+	}
+	addrs, err := localIPv4Addresses()
+	if err != nil {
+		return nil, err
+	}
+
+	destinations := []string{}
+	for iface, ifaceAddrs := range addrs {
+		if strings.HasPrefix(iface, "ovnmp") {
+			continue
+		}
+		for _, addr := range ifaceAddrs {
+			if addr.IsLoopback() || subnet.Contains(addr) {
+				continue
+			}
+			destinations = append(destinations, addr.String()+"/32")
+		}
+	}
+	sort.Strings(destinations)
+	routes := make([]*network.StaticRoute, len(destinations))
+	for i, destination := range destinations {
+		routes[i] = &network.StaticRoute{Destination: destination, RouteType: routeTypeNextHop, NextHop: nextHop}
+	}
+	return routes, nil
+}
+
+// masqueradeRule is the iptables rule, without its action flag, rewriting
+// the source of traffic entering a management port for the host itself
+func masqueradeRule(ifaceName string, subnet string, address string) []string {
+	return []string{"-t", "nat", "INPUT", "-i", ifaceName, "-s", subnet,
+		"-m", "addrtype", "--dst-type", "LOCAL",
+		"-m", "comment", "--comment", "docker-network-ovn " + ifaceName,
+		"-j", "SNAT", "--to-source", address}
+}
+
+// iptablesArgs places the action flag before the chain of a rule
+func iptablesArgs(action string, rule []string) []string {
+	return append([]string{rule[0], rule[1], action}, rule[2:]...)
+}
+
+// ensureMasquerade adds the masquerade rule of a management port unless it
+// is already there
+func ensureMasquerade(ifaceName string, subnet string, address string) error {
+	rule := masqueradeRule(ifaceName, subnet, address)
+	if _, err := runCommand("iptables", iptablesArgs("-C", rule)...); err == nil {
+		return nil
+	}
+	if _, err := runCommand("iptables", iptablesArgs("-A", rule)...); err != nil {
+		return fmt.Errorf("failed to masquerade traffic of %s to the host: %w", ifaceName, err)
+	}
+	return nil
+}
+
+// removeMasquerade deletes the masquerade rule of a management port
+func removeMasquerade(ifaceName string, subnet string, address string) {
+	rule := masqueradeRule(ifaceName, subnet, address)
+	for {
+		if _, err := runCommand("iptables", iptablesArgs("-D", rule)...); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "docker_network_ovn"
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	portSecurityDriftPorts = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "port_security_drift_ports",
+		Help:      "Endpoints whose container MAC did not match the LSP addresses in the last audit.",
+	})
+	portSecurityAuditRuns = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "port_security_audit_runs_total",
+		Help:      "Completed port-security audit runs.",
+	})
+	portSecurityAuditErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "port_security_audit_errors_total",
+		Help:      "Endpoints the port-security audit could not inspect.",
+	})
+	portSecurityRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "port_security_repairs_total",
+		Help:      "Port-security drift repairs attempted, by result.",
+	}, []string{"result"})
+	ovsPortRestores = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "ovs_port_restores_total",
+		Help:      "OVS ports of joined endpoints plugged back after they vanished, by result.",
+	}, []string{"result"})
+	ovsReconcileDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "ovs_reconcile_drift",
+		Help:      "Logical switch ports and OVS interfaces out of sync in the last reconciliation, by kind.",
+	}, []string{"kind"})
+	ovsReconcileRuns = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "ovs_reconcile_runs_total",
+		Help:      "Completed OVS reconciliation runs.",
+	})
+	ovsReconcileRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "ovs_reconcile_repairs_total",
+		Help:      "OVS drift repairs attempted, by kind and result.",
+	}, []string{"kind", "result"})
+	bgpAdvertisedPrefixes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "bgp_advertised_prefixes",
+		Help:      "Network subnets advertised over BGP by this host.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		portSecurityDriftPorts,
+		portSecurityAuditRuns,
+		portSecurityAuditErrors,
+		portSecurityRepairs,
+		ovsPortRestores,
+		ovsReconcileDrift,
+		ovsReconcileRuns,
+		ovsReconcileRepairs,
+		bgpAdvertisedPrefixes,
+	)
+}
+
+// newCleanupQueueGauge reports the cleanups waiting in a queue
+func newCleanupQueueGauge(q *CleanupQueue) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cleanup_queue_length",
+		Help:      "Cleanups of left and deleted endpoints waiting to run or be retried.",
+	}, func() float64 { return float64(q.Len()) })
+}
+
+// serveMetrics exposes the Prometheus registry on addr until the listener fails
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+	log.Printf("Serving metrics on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Warning: metrics server stopped: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+)
+
+// sandboxGatewayPort returns the port of another OVN network that already
+// provides the default route of a sandbox, if any. A container on several
+// OVN networks takes its default route from the first one it joined.
+func (d *OVNDriver) sandboxGatewayPort(sandboxKey string, portName string) (string, bool, error) {
+	ports := []LogicalSwitchPort{}
+	err := d.ovn.client.WhereCache(func(lsp *LogicalSwitchPort) bool {
+		return lsp.ExternalIDs["docker:sandbox"] == sandboxKey &&
+			lsp.ExternalIDs["docker:default_gateway"] == "true" &&
+			lsp.Name != portName
+	}).List(d.ovn.ctx, &ports)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to list logical switch ports of sandbox: %w", err)
+	}
+	if len(ports) == 0 {
+		return "", false, nil
+	}
+	return ports[0].Name, true, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Switch naming modes: switches are created as ls-<network-id> and, in name
+// mode, renamed to ls-<network-name> once Docker has stored the network
+const (
+	switchNamingID   = "id"
+	switchNamingName = "name"
+)
+
+// describeSwitch records the Docker network name and labels on a network's
+// switch in the background, renaming it in name mode
+func (d *OVNDriver) describeSwitch(networkID string) {
+	d = d.background()
+	go func() {
+		retry := backoff.NewExponentialBackOff()
+		retry.MaxElapsedTime = time.Minute
+
+		err := backoff.Retry(func() error {
+			dockerNetwork, err := d.docker.InspectNetwork(d.ovn.ctx, networkID)
+			if err != nil {
+				return err
+			}
+			return d.updateSwitchMetadata(networkID, dockerNetwork)
+		}, backoff.WithContext(retry, d.ovn.ctx))
+		if err != nil {
+			d.logf("Warning: failed to record Docker metadata of network %s: %v", networkID[:12], err)
+		}
+	}()
+}
+
+// switchMetadata returns the external_ids describing a Docker network
+func (d *OVNDriver) switchMetadata(networkID string, dockerNetwork *DockerNetwork) map[string]string {
+	values := d.labels.ExternalIDs(dockerNetwork.Labels)
+	values["docker:network"] = networkID
+	values["docker:network_name"] = dockerNetwork.Name
+	return values
+}
+
+// updateSwitchMetadata writes the Docker metadata of a network to its switch,
+// keeping the ID based name when the name mode target is taken
+func (d *OVNDriver) updateSwitchMetadata(networkID string, dockerNetwork *DockerNetwork) error {
+	ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(networkID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// Deleted before Docker reported it
+		return nil
+	}
+	values := d.switchMetadata(networkID, dockerNetwork)
+	if err := d.labelDHCPOptions(ls, d.labels.ExternalIDs(dockerNetwork.Labels)); err != nil {
+		return err
+	}
+
+	if d.switchNaming == switchNamingName {
+		name := d.switchName(dockerNetwork.Name)
+		if !validSharedNetworkName(dockerNetwork.Name) {
+			d.logf("Warning: keeping switch name %s, network name %q is not a valid switch name", ls.Name, dockerNetwork.Name)
+		} else if existingLS, found, err := d.ovn.GetLogicalSwitch(name); err != nil {
+			return err
+		} else if found = found && existingLS.Name == name; found && existingLS.UUID != ls.UUID {
+			d.logf("Warning: keeping switch name %s, %s is taken by the switch of network(s) %v", ls.Name, name, switchNetworkIDs(existingLS))
+		} else if !found {
+			// Ports attached concurrently fail the transaction; the retry reads them
+			if err := d.ovn.RenameLogicalSwitch(ls, name, values); err != nil {
+				return err
+			}
+			d.logf("Renamed logical switch %s to %s after Docker network %s", ls.Name, name, dockerNetwork.Name)
+			return nil
+		}
+	}
+
+	ops, err := d.ovn.UpdateLogicalSwitchExternalIDsOp(ls, values)
+	if err != nil {
+		return err
+	}
+	results, err := d.ovn.Transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to record Docker metadata on logical switch %s: %w", ls.Name, err)
+	}
+	return nil
+}
+
+// NameTemplates generate the names of created resources from {name},
+// {endpoint} and {network} (or {endpoint:N} and {network:N})
+type NameTemplates struct {
+	Switch string
+	Port   string
+	Veth   string
+}
+
+func DefaultNameTemplates() NameTemplates {
+	return NameTemplates{
+		Switch: "ls-{name}",
+		Port:   "lsp-{endpoint}-ls-{network}",
+		Veth:   "veth{endpoint:7}",
+	}
+}
+
+// Linux interface names hold at most 15 characters, and the container side
+// of a veth pair is the host name with containerVethSuffix appended
+const (
+	maxInterfaceNameLength = 15
+	containerVethSuffix    = "_c"
+)
+
+// Validate checks that every template identifies its resource and that veth
+// names fit the interface name length limit
+func (t NameTemplates) Validate() error {
+	for _, tmpl := range []struct {
+		kind, template, placeholder string
+	}{
+		{"switch", t.Switch, "name"},
+		{"port", t.Port, "endpoint"},
+		{"veth", t.Veth, "endpoint"},
+	} {
+		if !hasNamePlaceholder(tmpl.template, tmpl.placeholder) {
+			return fmt.Errorf("%s name template %q must contain {%s}", tmpl.kind, tmpl.template, tmpl.placeholder)
+		}
+	}
+
+	sampleID := strings.Repeat("f", 64)
+	if name := expandNameTemplate(t.Switch, "", "", "name"); !validSharedNetworkName(name) {
+		return fmt.Errorf("switch name template %q: only letters, digits, '.', '_', '-' and placeholders are allowed", t.Switch)
+	}
+	if name := expandNameTemplate(t.Port, sampleID, sampleID, ""); !validSharedNetworkName(name) {
+		return fmt.Errorf("port name template %q: only letters, digits, '.', '_', '-' and placeholders are allowed", t.Port)
+	}
+	veth := expandNameTemplate(t.Veth, sampleID, sampleID, "")
+	if !validSharedNetworkName(veth) {
+		return fmt.Errorf("veth name template %q: only letters, digits, '.', '_', '-' and placeholders are allowed", t.Veth)
+	}
+	if len(veth)+len(containerVethSuffix) > maxInterfaceNameLength {
+		return fmt.Errorf("veth name template %q: %s%s is longer than %d characters", t.Veth, veth, containerVethSuffix, maxInterfaceNameLength)
+	}
+	return nil
+}
+
+var namePlaceholder = regexp.MustCompile(`\{(name|endpoint|network)(?::(\d+))?\}`)
+
+func hasNamePlaceholder(template string, placeholder string) bool {
+	for _, match := range namePlaceholder.FindAllStringSubmatch(template, -1) {
+		if match[1] == placeholder && match[2] != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+func expandNameTemplate(template string, endpointID string, networkID string, name string) string {
+	return namePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := namePlaceholder.FindStringSubmatch(placeholder)
+		value := name
+		switch match[1] {
+		case "endpoint":
+			value = endpointID
+		case "network":
+			value = networkID
+		}
+		length := 12
+		if match[2] != "" {
+			length, _ = strconv.Atoi(match[2])
+		}
+		if match[1] != "name" && len(value) > length {
+			value = value[:length]
+		}
+		return value
+	})
+}
+
+// portName returns the logical switch port name of an endpoint
+func (d *OVNDriver) portName(endpointID string, networkID string) string {
+	return expandNameTemplate(d.names.Port, endpointID, networkID, "")
+}
+
+// vethName returns the host side veth name of an endpoint
+func (d *OVNDriver) vethName(endpointID string, networkID string) string {
+	return expandNameTemplate(d.names.Veth, endpointID, networkID, "")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// nullIPAMPool is the pool Docker's null IPAM driver hands out. Such networks
+// take their subnet from ovn.subnet and OVN's native IPAM assigns addresses.
+const nullIPAMPool = "0.0.0.0/0"
+
+const (
+	subnetOption  = "ovn.subnet"
+	gatewayOption = "ovn.gateway"
+
+	// subnetOtherConfigKey enables ovn-northd's native IPAM on a switch
+	subnetOtherConfigKey = "subnet"
+
+	// dynamicAddressTimeout bounds the wait for ovn-northd to assign an address
+	dynamicAddressTimeout = 10 * time.Second
+)
+
+// parseIPv4Subnet parses an IPv4 CIDR
+func parseIPv4Subnet(value string) (*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(value)
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid IPv4 subnet %q", value)
+	}
+	return ipNet, nil
+}
+
+// portAddresses returns the addresses and port_security of an endpoint port
+func portAddresses(macAddr string, ipAddr string, addressPairs []string) ([]string, []string) {
+	addressStr := fmt.Sprintf("%s %s", macAddr, ipAddr)
+	portSecurity := []string{addressStr}
+	// Frames sent to a foreign MAC (e.g. a VRRP virtual MAC) are only
+	// delivered to this port if the MAC is listed in addresses as well, once
+	// with all the addresses of its pairs
+	foreignMACs := []string{}
+	foreignIPs := map[string][]string{}
+	for _, pair := range addressPairs {
+		portSecurity = append(portSecurity, pair)
+		fields := strings.Fields(pair)
+		pairMAC := fields[0]
+		if pairMAC == macAddr {
+			continue
+		}
+		if _, seen := foreignIPs[pairMAC]; !seen {
+			foreignMACs = append(foreignMACs, pairMAC)
+			foreignIPs[pairMAC] = []string{}
+		}
+		for _, addr := range fields[1:] {
+			// addresses takes plain IPs only, port_security keeps the CIDRs
+			if net.ParseIP(addr) != nil && !slices.Contains(foreignIPs[pairMAC], addr) {
+				foreignIPs[pairMAC] = append(foreignIPs[pairMAC], addr)
+			}
+		}
+	}
+	addresses := []string{addressStr}
+	for _, pairMAC := range foreignMACs {
+		addresses = append(addresses, strings.Join(append([]string{pairMAC}, foreignIPs[pairMAC]...), " "))
+	}
+	return addresses, portSecurity
+}
+
+// waitDynamicAddress waits for ovn-northd to fill the dynamic_addresses of a
+// port created with "<mac> dynamic" addresses and returns the port and its IP
+func (o *OVNAPI) waitDynamicAddress(portName string) (*LogicalSwitchPort, string, error) {
+	retry := backoff.NewExponentialBackOff()
+	retry.InitialInterval = 50 * time.Millisecond
+	retry.MaxElapsedTime = dynamicAddressTimeout
+
+	var lsp *LogicalSwitchPort
+	var ipAddr string
+	err := backoff.Retry(func() error {
+		port, found, err := o.GetLogicalSwitchPort(portName)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		if !found || port.DynamicAddresses == nil {
+			return fmt.Errorf("no address assigned to %s yet", portName)
+		}
+		fields := strings.Fields(*port.DynamicAddresses)
+		if len(fields) < 2 {
+			return fmt.Errorf("no IPv4 address assigned to %s yet", portName)
+		}
+		lsp, ipAddr = port, fields[1]
+		return nil
+	}, backoff.WithContext(retry, o.ctx))
+	if err != nil {
+		return nil, "", codedErrorf(ErrBindingTimeout, "ovn-northd did not assign an address to %s: %w", portName, err)
+	}
+	return lsp, ipAddr, nil
+}
+
+// pinDynamicAddress turns the address OVN assigned to an endpoint port into a
+// static one, so the rest of the driver, port security included, handles the
+// port like any other; ovn-northd keeps static addresses reserved
+func (d *OVNDriver) pinDynamicAddress(portName string, macAddr string, addressPairs []string) (string, error) {
+	lsp, ipAddr, err := d.ovn.waitDynamicAddress(portName)
+	if err != nil {
+		return "", err
+	}
+
+	addresses, portSecurity := portAddresses(macAddr, ipAddr, addressPairs)
+	ops, err := d.ovn.UpdateLogicalSwitchPortAddressesOp(lsp, addresses, portSecurity)
+	if err != nil {
+		return "", fmt.Errorf("failed to create update operation for logical switch port: %w", err)
+	}
+	metadataOps, err := d.ovn.UpdateLogicalSwitchPortExternalIDsOp(lsp, endpointMetadata(macAddr, ipAddr, addressPairs))
+	if err != nil {
+		return "", fmt.Errorf("failed to create update operation for endpoint metadata: %w", err)
+	}
+	results, err := d.ovn.Transact(append(ops, metadataOps...)...)
+	if err := transactError(err, results); err != nil {
+		return "", fmt.Errorf("failed to pin address %s of %s: %w", ipAddr, portName, err)
+	}
+	return ipAddr, nil
+}
+
+// releaseEndpointPort deletes a port whose creation could not be completed,
+// along with its share of virtual IPs and its QoS rules
+func (d *OVNDriver) releaseEndpointPort(ls *LogicalSwitch, portName string) {
+	ops, err := d.deleteLogicalSwitchPortOps(ls, portName)
+	if err == nil {
+		var virtualOps []ovsdb.Operation
+		virtualOps, err = d.removeVirtualParentOps(ls, portName)
+		ops = append(ops, virtualOps...)
+	}
+	if err == nil {
+		var qosOps []ovsdb.Operation
+		qosOps, err = d.ovn.deleteDSCPOps(ls, portName)
+		ops = append(ops, qosOps...)
+	}
+	if err == nil {
+		var results []ovsdb.OperationResult
+		results, err = d.ovn.Transact(ops...)
+		err = transactError(err, results)
+	}
+	if err != nil {
+		d.logf("Warning: failed to delete logical switch port %s: %v", portName, err)
+	}
+}
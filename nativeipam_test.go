@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPortAddresses(t *testing.T) {
+	const mac = "02:00:00:00:00:01"
+	const own = mac + " 172.16.0.2"
+
+	addresses, portSecurity := portAddresses(mac, "172.16.0.2", nil)
+	if want := []string{own}; !reflect.DeepEqual(addresses, want) || !reflect.DeepEqual(portSecurity, want) {
+		t.Errorf("without pairs: addresses %q, port_security %q, want %q for both", addresses, portSecurity, want)
+	}
+
+	// Pairs of the endpoint's own MAC only widen port security. A foreign
+	// MAC is listed in addresses once, with the plain IPs of all its pairs.
+	pairs := []string{
+		mac + " 172.16.0.100",
+		"00:00:5e:00:01:01 172.16.0.101",
+		"00:00:5e:00:02:01 fd00::101",
+		"00:00:5e:00:01:01 172.16.0.102 172.16.0.101 10.0.0.0/24",
+		"00:00:5e:00:02:01 fd00::101 fd00:1::/64",
+	}
+	addresses, portSecurity = portAddresses(mac, "172.16.0.2", pairs)
+	wantAddresses := []string{
+		own,
+		"00:00:5e:00:01:01 172.16.0.101 172.16.0.102",
+		"00:00:5e:00:02:01 fd00::101",
+	}
+	if !reflect.DeepEqual(addresses, wantAddresses) {
+		t.Errorf("addresses = %q, want %q", addresses, wantAddresses)
+	}
+	if want := append([]string{own}, pairs...); !reflect.DeepEqual(portSecurity, want) {
+		t.Errorf("port_security = %q, want %q", portSecurity, want)
+	}
+
+	// A foreign MAC whose pairs are all CIDRs still receives frames
+	addresses, _ = portAddresses(mac, "172.16.0.2", []string{"00:00:5e:00:01:01 10.0.0.0/24"})
+	if want := []string{own, "00:00:5e:00:01:01"}; !reflect.DeepEqual(addresses, want) {
+		t.Errorf("addresses = %q, want %q", addresses, want)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// NestedParent is the logical switch port of the VM or privileged container
+// the driver runs in, parent of the endpoint ports in nested mode
+type NestedParent struct {
+	// Port is the logical switch port name of the parent
+	Port string
+	// Interface is the local interface bound to Port
+	Interface string
+}
+
+// maxVLANTag is the highest usable 802.1Q VLAN ID
+const maxVLANTag = 4094
+
+// nextTag returns the lowest VLAN tag not used by another child of the parent
+func (n *NestedParent) nextTag(o *OVNAPI) (int, error) {
+	children := []LogicalSwitchPort{}
+	err := o.client.WhereCache(func(lsp *LogicalSwitchPort) bool {
+		return lsp.ExternalIDs["docker:parent"] == n.Port
+	}).List(o.ctx, &children)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list child ports of %s: %w", n.Port, err)
+	}
+	used := map[int]bool{}
+	for _, child := range children {
+		if tag, err := strconv.Atoi(child.ExternalIDs["docker:tag"]); err == nil {
+			used[tag] = true
+		}
+	}
+	for tag := 1; tag <= maxVLANTag; tag++ {
+		if !used[tag] {
+			return tag, nil
+		}
+	}
+	return 0, fmt.Errorf("all VLAN tags of parent port %s are in use", n.Port)
+}
+
+// childPortOps makes lsp a child port of the parent with a free VLAN tag,
+// failing if another child claimed the tag in the meantime
+func (n *NestedParent) childPortOps(o *OVNAPI, lsp *LogicalSwitchPort) ([]ovsdb.Operation, error) {
+	tag, err := n.nextTag(o)
+	if err != nil {
+		return nil, err
+	}
+	parent := n.Port
+	lsp.ParentName = &parent
+	lsp.TagRequest = &tag
+	lsp.ExternalIDs["docker:parent"] = parent
+	lsp.ExternalIDs["docker:tag"] = strconv.Itoa(tag)
+
+	probe := &LogicalSwitchPort{ParentName: &parent, TagRequest: &tag}
+	noPort := 0
+	ops, err := o.client.WhereAll(probe, model.Condition{
+		Field:    &probe.ParentName,
+		Function: ovsdb.ConditionEqual,
+		Value:    &parent,
+	}, model.Condition{
+		Field:    &probe.TagRequest,
+		Function: ovsdb.ConditionEqual,
+		Value:    &tag,
+	}).Wait(ovsdb.WaitConditionNotEqual, &noPort, probe, &probe.ParentName, &probe.TagRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create child port wait operation: %w", err)
+	}
+	return ops, nil
+}
+
+// addInterface creates the VLAN interface of a child port on the parent's
+// interface; Docker moves it into the container as is
+func (n *NestedParent) addInterface(name string, lsp *LogicalSwitchPort, macAddr string) error {
+	tag := lsp.ExternalIDs["docker:tag"]
+	if tag == "" {
+		return fmt.Errorf("logical switch port %s is not a child port of %s", lsp.Name, n.Port)
+	}
+
+	log.Printf("Creating VLAN %s interface %s on %s", tag, name, n.Interface)
+	if _, err := runCommand("ip", "link", "add", "link", n.Interface, "name", name,
+		"type", "vlan", "id", tag); err != nil {
+		return fmt.Errorf("failed to create VLAN interface: %w", err)
+	}
+
+	if _, err := runCommand("ip", "link", "set", name, "address", macAddr); err != nil {
+		cleanupCommand("ip", "link", "del", name)
+		return fmt.Errorf("failed to set MAC address: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Network options handing out network boot and time settings over OVN's
+// native DHCP, for VM-like workloads that chain-load over the network
+const (
+	tftpServerOption = "ovn.dhcp_tftp_server"
+	bootfileOption   = "ovn.dhcp_bootfile"
+	ntpServersOption = "ovn.dhcp_ntp_servers"
+)
+
+// networkBoot holds the boot settings of a network, recorded in the switch
+// other_config next to its DNS settings
+type networkBoot struct {
+	TFTPServer string
+	Bootfile   string
+	NTPServers []string
+}
+
+func (n networkBoot) Enabled() bool {
+	return n.TFTPServer != "" || n.Bootfile != "" || len(n.NTPServers) > 0
+}
+
+// validateTFTPServer accepts an IPv4 address or a host name
+func validateTFTPServer(value string) error {
+	if net.ParseIP(value).To4() != nil {
+		return nil
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(value, "."), ".") {
+		if label == "" || len(label) > 63 || dnsLabel(label) != strings.ToLower(label) {
+			return fmt.Errorf("expected an IPv4 address or a host name")
+		}
+	}
+	return nil
+}
+
+// validateBootfile accepts a file name OVN can quote as a DHCP string
+func validateBootfile(value string) error {
+	if value == "" || strings.ContainsAny(value, "\"\\") {
+		return fmt.Errorf("expected a file name without quotes or backslashes")
+	}
+	return nil
+}
+
+func (n networkBoot) otherConfig() map[string]string {
+	values := map[string]string{}
+	if n.TFTPServer != "" {
+		values["docker:dhcp_tftp_server"] = n.TFTPServer
+	}
+	if n.Bootfile != "" {
+		values["docker:dhcp_bootfile"] = n.Bootfile
+	}
+	if len(n.NTPServers) > 0 {
+		values["docker:dhcp_ntp_servers"] = strings.Join(n.NTPServers, ",")
+	}
+	return values
+}
+
+func networkBootFromSwitch(ls *LogicalSwitch) networkBoot {
+	boot := networkBoot{
+		TFTPServer: ls.OtherConfig["docker:dhcp_tftp_server"],
+		Bootfile:   ls.OtherConfig["docker:dhcp_bootfile"],
+	}
+	if servers := ls.OtherConfig["docker:dhcp_ntp_servers"]; servers != "" {
+		boot.NTPServers = strings.Split(servers, ",")
+	}
+	return boot
+}
+
+// dhcpValues returns the DHCP_Options options of the boot settings: DHCP
+// options 66, 67 and 42
+func (n networkBoot) dhcpValues() map[string]string {
+	values := map[string]string{}
+	if n.TFTPServer != "" {
+		if net.ParseIP(n.TFTPServer) != nil {
+			values["tftp_server"] = n.TFTPServer
+		} else {
+			values["tftp_server"] = `"` + n.TFTPServer + `"`
+		}
+	}
+	if n.Bootfile != "" {
+		values["bootfile_name"] = `"` + n.Bootfile + `"`
+	}
+	if len(n.NTPServers) > 0 {
+		values["ntp_server"] = "{" + strings.Join(n.NTPServers, ", ") + "}"
+	}
+	return values
+}
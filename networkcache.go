@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/model"
+)
+
+// NetworkCache keeps the NetworkConfig of every driver-owned logical switch
+// and a per-switch IP to port index, refreshed from the OVN NB monitor, so
+// hot paths avoid switch lookups and port scans
+type NetworkCache struct {
+	mu       sync.RWMutex
+	networks map[string]NetworkConfig
+	// ports maps logical switch name -> IP -> logical switch port name; a
+	// shared switch holds ports of several hosts' networks
+	ports map[string]map[string]string
+}
+
+// NewNetworkCache creates an empty cache; register EventHandler before monitoring
+func NewNetworkCache() *NetworkCache {
+	return &NetworkCache{
+		networks: map[string]NetworkConfig{},
+		ports:    map[string]map[string]string{},
+	}
+}
+
+// PortByIP returns the logical switch port using ipAddr on a logical switch
+func (c *NetworkCache) PortByIP(switchName string, ipAddr string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	portName, ok := c.ports[switchName][ipAddr]
+	return portName, ok
+}
+
+// Get returns the cached configuration of a Docker network
+func (c *NetworkCache) Get(networkID string) (NetworkConfig, bool) {
+	if c == nil {
+		return NetworkConfig{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	config, ok := c.networks[networkID]
+	return config, ok
+}
+
+// EventHandler returns the libovsdb cache handler keeping the cache current
+func (c *NetworkCache) EventHandler() cache.EventHandler {
+	return &cache.EventHandlerFuncs{
+		AddFunc: func(table string, m model.Model) {
+			c.add(m)
+		},
+		UpdateFunc: func(table string, old model.Model, new model.Model) {
+			c.delete(old)
+			c.add(new)
+		},
+		DeleteFunc: func(table string, m model.Model) {
+			c.delete(m)
+		},
+	}
+}
+
+func (c *NetworkCache) add(m model.Model) {
+	switch row := m.(type) {
+	case *LogicalSwitch:
+		c.store(row)
+	case *LogicalSwitchPort:
+		c.storePort(row)
+	}
+}
+
+func (c *NetworkCache) delete(m model.Model) {
+	switch row := m.(type) {
+	case *LogicalSwitch:
+		c.remove(row)
+	case *LogicalSwitchPort:
+		c.removePort(row)
+	}
+}
+
+func (c *NetworkCache) store(ls *LogicalSwitch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, networkID := range switchNetworkIDs(ls) {
+		if config, ok := networkConfigFromSwitch(ls, networkID); ok {
+			c.networks[networkID] = config
+		}
+	}
+}
+
+func (c *NetworkCache) remove(ls *LogicalSwitch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, networkID := range switchNetworkIDs(ls) {
+		delete(c.networks, networkID)
+	}
+}
+
+// networkConfigFromSwitch parses the docker:* other_config of a driver switch
+// as seen by one of the Docker networks attached to it
+func networkConfigFromSwitch(ls *LogicalSwitch, networkID string) (NetworkConfig, bool) {
+	if !isOwned(ls.ExternalIDs) || networkID == "" {
+		return NetworkConfig{}, false
+	}
+	return NetworkConfig{
+		ID:         networkID,
+		SwitchName: ls.Name,
+		SwitchUUID: ls.UUID,
+		Subnet:     ls.OtherConfig["docker:subnet"],
+		Gateway:    ls.OtherConfig["docker:gateway"],
+		Options:    networkOptionsFromSwitch(ls),
+	}, true
+}
+
+// portSwitchName returns the switch a Docker port belongs to; ports created
+// before docker:switch was recorded live on the network's own ls-<id> switch
+func portSwitchName(lsp *LogicalSwitchPort) string {
+	if switchName := lsp.ExternalIDs["docker:switch"]; switchName != "" {
+		return switchName
+	}
+	if networkID := lsp.ExternalIDs["docker:network"]; len(networkID) >= 12 {
+		return "ls-" + networkID[:12]
+	}
+	return ""
+}
+
+func (c *NetworkCache) storePort(lsp *LogicalSwitchPort) {
+	switchName := portSwitchName(lsp)
+	if switchName == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ips := c.ports[switchName]
+	if ips == nil {
+		ips = map[string]string{}
+		c.ports[switchName] = ips
+	}
+	for _, ipAddr := range logicalSwitchPortIPs(lsp) {
+		ips[ipAddr] = lsp.Name
+	}
+}
+
+func (c *NetworkCache) removePort(lsp *LogicalSwitchPort) {
+	switchName := portSwitchName(lsp)
+	if switchName == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ips := c.ports[switchName]
+	for _, ipAddr := range logicalSwitchPortIPs(lsp) {
+		if ips[ipAddr] == lsp.Name {
+			delete(ips, ipAddr)
+		}
+	}
+	if len(ips) == 0 {
+		delete(c.ports, switchName)
+	}
+}
+
+// logicalSwitchPortIPs returns the IPs a port holds: those of its first
+// addresses entry. Later entries list address pairs, which several ports
+// may share.
+func logicalSwitchPortIPs(lsp *LogicalSwitchPort) []string {
+	ips := []string{}
+	if len(lsp.Addresses) == 0 {
+		return ips
+	}
+	for _, field := range strings.Fields(lsp.Addresses[0]) {
+		if net.ParseIP(field) != nil {
+			ips = append(ips, field)
+		}
+	}
+	return ips
+}
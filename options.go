@@ -0,0 +1,401 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options in the ovn. namespace are owned by the driver and validated; other
+// keys may be labels or options of other tools and are left alone
+const driverOptionPrefix = "ovn."
+
+// optionSpec documents one driver option and checks its value
+type optionSpec struct {
+	Format   string
+	Validate func(value string) error
+}
+
+var networkOptionSpecs = map[string]optionSpec{
+	sharedNetworkOption: {
+		Format:   "<name> of letters, digits, '.', '_' and '-'",
+		Validate: validateName,
+	},
+	localnetOption: {
+		Format:   "<physnet> listed in external_ids:ovn-bridge-mappings",
+		Validate: validateName,
+	},
+	excludeIPsOption: {
+		Format: `space or comma separated IPv4 addresses and "<first>..<last>" ranges`,
+		Validate: func(value string) error {
+			_, err := parseExcludeIPs(value)
+			return err
+		},
+	},
+	dnsServersOption: {
+		Format: "comma separated IPv4 name server addresses",
+		Validate: func(value string) error {
+			_, err := parseDNSServers(value)
+			return err
+		},
+	},
+	dnsSearchOption: {
+		Format: "comma separated search domains",
+		Validate: func(value string) error {
+			_, err := parseDNSSearch(value)
+			return err
+		},
+	},
+	tftpServerOption: {Format: "IPv4 address or host name", Validate: validateTFTPServer},
+	bootfileOption:   {Format: "boot file name", Validate: validateBootfile},
+	ntpServersOption: {
+		Format: "comma separated IPv4 NTP server addresses",
+		Validate: func(value string) error {
+			_, err := parseDNSServers(value)
+			return err
+		},
+	},
+	"ovn.mcast_snoop":                   {Format: "true or false", Validate: validateBool},
+	"ovn.mcast_flood_unregistered":      {Format: "true or false", Validate: validateBool},
+	"ovn.broadcast_arps_to_all_routers": {Format: "true or false", Validate: validateBool},
+	dryRunOption: {
+		Format:   "true or false",
+		Validate: validateBool,
+	},
+	noGatewayOption: {
+		Format:   "true or false",
+		Validate: validateBool,
+	},
+	sysctlOptionPrefix + "accept_ra":    {Format: "0, 1 or 2", Validate: validateSysctl("accept_ra")},
+	sysctlOptionPrefix + "rp_filter":    {Format: "0, 1 or 2", Validate: validateSysctl("rp_filter")},
+	sysctlOptionPrefix + "arp_notify":   {Format: "0 or 1", Validate: validateSysctl("arp_notify")},
+	sysctlOptionPrefix + "disable_ipv6": {Format: "0 or 1", Validate: validateSysctl("disable_ipv6")},
+	subnetOption: {
+		Format: "<IPv4 CIDR>, with --ipam-driver=null",
+		Validate: func(value string) error {
+			_, err := parseIPv4Subnet(value)
+			return err
+		},
+	},
+	gatewayOption: {
+		Format: "<IPv4 address> of ovn.subnet",
+		Validate: func(value string) error {
+			if net.ParseIP(value).To4() == nil {
+				return fmt.Errorf("invalid IPv4 address")
+			}
+			return nil
+		},
+	},
+	dscpOption:           {Format: "0 to 63", Validate: validateDSCP},
+	bgpAdvertiseOption:   {Format: "true or false", Validate: validateBool},
+	tunnelKeyOption:      {Format: "1 to 16777215", Validate: validateTunnelKey},
+	bridgeOption:         {Format: "<bridge> of OVS on every host", Validate: validateName},
+	allowOverlapOption:   {Format: "true or false", Validate: validateBool},
+	hostAccessOption:     {Format: "true or false", Validate: validateBool},
+	hostMasqueradeOption: {Format: "true or false", Validate: validateBool},
+	egressRateOption:     {Format: "<n>[kbit|mbit|gbit] per chassis, with ovn.localnet", Validate: validateRate},
+	connLimitOption:      {Format: "connections per endpoint", Validate: validateConnLimit},
+}
+
+// splitOptionList splits a space or comma separated option value
+func splitOptionList(value string) []string {
+	return strings.FieldsFunc(value, func(c rune) bool { return c == ' ' || c == ',' })
+}
+
+// validateBool accepts the values of strconv.ParseBool
+func validateBool(value string) error {
+	_, err := strconv.ParseBool(value)
+	return err
+}
+
+// validateName accepts names usable in OVN row names and external_ids
+func validateName(value string) error {
+	if value == "" || !validSharedNetworkName(value) {
+		return fmt.Errorf("only letters, digits, '.', '_' and '-' are allowed")
+	}
+	return nil
+}
+
+var endpointOptionSpecs = map[string]optionSpec{
+	virtualIPsOption: {
+		Format: "comma separated IPv4 addresses of the network",
+		Validate: func(value string) error {
+			_, err := parseVirtualIPs(value)
+			return err
+		},
+	},
+	addressPairsOption: {
+		Format: `comma separated "<mac> <ip>..." or "<ip>" entries`,
+		Validate: func(value string) error {
+			_, err := parseAddressPairs(value, "")
+			return err
+		},
+	},
+	dscpOption:                          {Format: "0 to 63", Validate: validateDSCP},
+	connLimitOption:                     {Format: "connections", Validate: validateConnLimit},
+	sysctlOptionPrefix + "accept_ra":    {Format: "0, 1 or 2", Validate: validateSysctl("accept_ra")},
+	sysctlOptionPrefix + "rp_filter":    {Format: "0, 1 or 2", Validate: validateSysctl("rp_filter")},
+	sysctlOptionPrefix + "arp_notify":   {Format: "0 or 1", Validate: validateSysctl("arp_notify")},
+	sysctlOptionPrefix + "disable_ipv6": {Format: "0 or 1", Validate: validateSysctl("disable_ipv6")},
+}
+
+// NetworkOptions are the driver options of a network, validated and
+// normalized once so driver methods never parse option strings themselves
+type NetworkOptions struct {
+	SharedNetwork string
+	Localnet      string
+	ExcludeIPs    []ipRange
+	DNS           networkDNS
+	Boot          networkBoot
+	// FloodControls are the switch other_config keys of the flood options set
+	FloodControls map[string]string
+	DryRun        bool
+	// NoDefaultGateway keeps the network from providing a default route
+	NoDefaultGateway bool
+	// Sysctls are set on the interface of every endpoint, by sysctl name
+	Sysctls map[string]string
+	// Subnet and Gateway replace the IPAM data of null IPAM networks
+	Subnet  string
+	Gateway string
+	// DSCP marks the traffic of endpoints without their own ovn.dscp
+	DSCP string
+	// ConnLimit caps the connections of endpoints without their own ovn.conn_limit
+	ConnLimit string
+	// BGPAdvertise announces the subnet from hosts running a BGP speaker
+	BGPAdvertise bool
+	// TunnelKey is the requested tunnel key of the switch
+	TunnelKey string
+	// Bridge is the integration bridge of the endpoints, empty for OVN_BRIDGE
+	Bridge string
+	// AllowOverlap lets the subnet be used by other networks with the option
+	AllowOverlap bool
+	// HostAccess gives every host a management port on the switch
+	HostAccess bool
+	// HostMasquerade routes traffic to the host through the management port
+	HostMasquerade bool
+	// EgressRate caps the traffic of the localnet port in bit/s, 0 for none
+	EgressRate int64
+}
+
+// parseNetworkOptions rejects unknown, malformed or conflicting -o options of
+// a network and returns them typed
+func parseNetworkOptions(options map[string]interface{}) (NetworkOptions, error) {
+	generic, _ := options["com.docker.network.generic"].(map[string]interface{})
+	if err := validateOptions("network option", generic, networkOptionSpecs); err != nil {
+		return NetworkOptions{}, err
+	}
+
+	// Values are validated above, so parse errors are not possible below
+	value := func(key string) string { return networkOption(options, key) }
+	opts := NetworkOptions{
+		SharedNetwork: value(sharedNetworkOption),
+		Localnet:      value(localnetOption),
+		FloodControls: map[string]string{},
+	}
+	if v := value(excludeIPsOption); v != "" {
+		opts.ExcludeIPs, _ = parseExcludeIPs(v)
+	}
+	if v := value(dnsServersOption); v != "" {
+		opts.DNS.Servers, _ = parseDNSServers(v)
+	}
+	if v := value(dnsSearchOption); v != "" {
+		opts.DNS.Search, _ = parseDNSSearch(v)
+	}
+	opts.Boot.TFTPServer = value(tftpServerOption)
+	opts.Boot.Bootfile = value(bootfileOption)
+	if v := value(ntpServersOption); v != "" {
+		opts.Boot.NTPServers, _ = parseDNSServers(v)
+	}
+	for option, key := range floodOtherConfig {
+		if v := value(option); v != "" {
+			enabled, _ := strconv.ParseBool(v)
+			opts.FloodControls[key] = strconv.FormatBool(enabled)
+		}
+	}
+	opts.DryRun, _ = strconv.ParseBool(value(dryRunOption))
+	opts.NoDefaultGateway, _ = strconv.ParseBool(value(noGatewayOption))
+	opts.Sysctls = map[string]string{}
+	for name := range interfaceSysctls {
+		if v := value(sysctlOptionPrefix + name); v != "" {
+			opts.Sysctls[name] = v
+		}
+	}
+	if v := value(subnetOption); v != "" {
+		ipNet, _ := parseIPv4Subnet(v)
+		opts.Subnet = ipNet.String()
+	}
+	opts.Gateway = value(gatewayOption)
+	opts.DSCP = value(dscpOption)
+	opts.ConnLimit = value(connLimitOption)
+	opts.BGPAdvertise, _ = strconv.ParseBool(value(bgpAdvertiseOption))
+	opts.TunnelKey = value(tunnelKeyOption)
+	opts.Bridge = value(bridgeOption)
+	opts.AllowOverlap, _ = strconv.ParseBool(value(allowOverlapOption))
+	opts.HostAccess, _ = strconv.ParseBool(value(hostAccessOption))
+	opts.HostMasquerade, _ = strconv.ParseBool(value(hostMasqueradeOption))
+	if v := value(egressRateOption); v != "" {
+		opts.EgressRate, _ = parseRate(v)
+	}
+
+	if _, ok := opts.FloodControls["mcast_flood_unregistered"]; ok && opts.FloodControls["mcast_snoop"] != "true" {
+		return NetworkOptions{}, codedErrorf(ErrInvalidOption, "network option ovn.mcast_flood_unregistered only applies with ovn.mcast_snoop=true")
+	}
+	if opts.AllowOverlap && opts.Localnet != "" {
+		return NetworkOptions{}, codedErrorf(ErrInvalidOption, "network option %s does not apply with %s: overlapping subnets would meet on the physical network", allowOverlapOption, localnetOption)
+	}
+	if opts.EgressRate > 0 && opts.Localnet == "" {
+		return NetworkOptions{}, codedErrorf(ErrInvalidOption, "network option %s only applies with %s", egressRateOption, localnetOption)
+	}
+	if opts.HostMasquerade && !opts.HostAccess {
+		return NetworkOptions{}, codedErrorf(ErrInvalidOption, "network option %s needs %s=true", hostMasqueradeOption, hostAccessOption)
+	}
+	if opts.AllowOverlap && opts.HostAccess {
+		return NetworkOptions{}, codedErrorf(ErrInvalidOption, "network option %s does not apply with %s: the host would route the subnet to several networks", allowOverlapOption, hostAccessOption)
+	}
+	if opts.AllowOverlap && opts.BGPAdvertise {
+		return NetworkOptions{}, codedErrorf(ErrInvalidOption, "network option %s does not apply with %s", allowOverlapOption, bgpAdvertiseOption)
+	}
+	if opts.Gateway != "" {
+		if opts.Subnet == "" {
+			return NetworkOptions{}, codedErrorf(ErrInvalidOption, "network option %s only applies with %s", gatewayOption, subnetOption)
+		}
+		if ipNet, _ := parseIPv4Subnet(opts.Subnet); !ipNet.Contains(net.ParseIP(opts.Gateway)) {
+			return NetworkOptions{}, codedErrorf(ErrInvalidOption, "network option %s=%s is not in %s", gatewayOption, opts.Gateway, opts.Subnet)
+		}
+	}
+	return opts, nil
+}
+
+// otherConfig returns the switch other_config recording the options that
+// outlive CreateNetwork
+func (o NetworkOptions) otherConfig() map[string]string {
+	values := map[string]string{}
+	for k, v := range o.FloodControls {
+		values[k] = v
+	}
+	for k, v := range o.DNS.otherConfig() {
+		values[k] = v
+	}
+	for k, v := range o.Boot.otherConfig() {
+		values[k] = v
+	}
+	if len(o.ExcludeIPs) > 0 {
+		values[excludeIPsOtherConfigKey] = formatExcludeIPs(o.ExcludeIPs)
+	}
+	if o.NoDefaultGateway {
+		values["docker:no_default_gateway"] = "true"
+	}
+	for name, value := range o.Sysctls {
+		values["docker:sysctl:"+name] = value
+	}
+	if o.DSCP != "" {
+		values["docker:dscp"] = o.DSCP
+	}
+	if o.ConnLimit != "" {
+		values["docker:conn_limit"] = o.ConnLimit
+	}
+	if o.BGPAdvertise {
+		values["docker:bgp_advertise"] = "true"
+	}
+	if o.TunnelKey != "" {
+		values[requestedTunnelKeyOtherConfigKey] = o.TunnelKey
+	}
+	if o.Bridge != "" {
+		values["docker:bridge"] = o.Bridge
+	}
+	if o.AllowOverlap {
+		values["docker:allow_overlap"] = "true"
+	}
+	if o.HostAccess {
+		values["docker:host_access"] = "true"
+	}
+	if o.HostMasquerade {
+		values["docker:host_masquerade"] = "true"
+	}
+	if o.EgressRate > 0 {
+		values["docker:egress_rate"] = strconv.FormatInt(o.EgressRate, 10)
+	}
+	if o.Localnet != "" {
+		values["docker:localnet"] = o.Localnet
+	}
+	return values
+}
+
+// networkOptionsFromSwitch reads back the options recorded on a switch. The
+// shared network name and dry run only matter while creating it.
+func networkOptionsFromSwitch(ls *LogicalSwitch) NetworkOptions {
+	opts := NetworkOptions{
+		Localnet:         ls.OtherConfig["docker:localnet"],
+		DNS:              networkDNSFromSwitch(ls),
+		Boot:             networkBootFromSwitch(ls),
+		FloodControls:    map[string]string{},
+		NoDefaultGateway: ls.OtherConfig["docker:no_default_gateway"] == "true",
+		Sysctls:          map[string]string{},
+		DSCP:             ls.OtherConfig["docker:dscp"],
+		ConnLimit:        ls.OtherConfig["docker:conn_limit"],
+		BGPAdvertise:     ls.OtherConfig["docker:bgp_advertise"] == "true",
+		TunnelKey:        ls.OtherConfig[requestedTunnelKeyOtherConfigKey],
+		Bridge:           ls.OtherConfig["docker:bridge"],
+		AllowOverlap:     ls.OtherConfig["docker:allow_overlap"] == "true",
+		HostAccess:       ls.OtherConfig["docker:host_access"] == "true",
+		HostMasquerade:   ls.OtherConfig["docker:host_masquerade"] == "true",
+	}
+	opts.EgressRate, _ = strconv.ParseInt(ls.OtherConfig["docker:egress_rate"], 10, 64)
+	for name := range interfaceSysctls {
+		if value, ok := ls.OtherConfig["docker:sysctl:"+name]; ok {
+			opts.Sysctls[name] = value
+		}
+	}
+	if value := ls.OtherConfig[excludeIPsOtherConfigKey]; value != "" {
+		opts.ExcludeIPs, _ = parseExcludeIPs(value)
+	}
+	for _, key := range floodOtherConfig {
+		if value, ok := ls.OtherConfig[key]; ok {
+			opts.FloodControls[key] = value
+		}
+	}
+	return opts
+}
+
+// validateEndpointOptions rejects unknown or malformed --driver-opt options of
+// an endpoint
+func validateEndpointOptions(options map[string]interface{}) error {
+	return validateOptions("endpoint option", options, endpointOptionSpecs)
+}
+
+func validateOptions(kind string, options map[string]interface{}, specs map[string]optionSpec) error {
+	for key, raw := range options {
+		if !strings.HasPrefix(key, driverOptionPrefix) {
+			continue
+		}
+		spec, ok := specs[key]
+		if !ok {
+			return codedErrorf(ErrInvalidOption, "unknown %s %q; supported options: %s", kind, key, supportedOptions(specs))
+		}
+		value, ok := raw.(string)
+		if !ok {
+			return codedErrorf(ErrInvalidOption, "invalid %s %s: expected %s, got %v", kind, key, spec.Format, raw)
+		}
+		if err := spec.Validate(strings.TrimSpace(value)); err != nil {
+			return codedErrorf(ErrInvalidOption, "invalid %s %s=%q: %v (expected %s)", kind, key, value, err, spec.Format)
+		}
+	}
+	return nil
+}
+
+// supportedOptions lists the supported keys and formats for error messages
+func supportedOptions(specs map[string]optionSpec) string {
+	keys := make([]string, 0, len(specs))
+	for key := range specs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, fmt.Sprintf("%s=%s", key, specs[key].Format))
+	}
+	return strings.Join(entries, ", ")
+}
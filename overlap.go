@@ -0,0 +1,24 @@
+package main
+
+// allowOverlapOption lets a network use a subnet other networks with the
+// option already use. Logical switches without a router between them are
+// separate L2 domains, so the copies never see each other.
+const allowOverlapOption = "ovn.allow_overlap"
+
+// subnetSwitch returns the shared switch a network with this subnet adopts,
+// nil when there is none, or an error when another switch uses the subnet and
+// the two networks did not both opt into overlapping
+func subnetSwitch(sameSubnet []LogicalSwitch, subnet string, switchName string, sharedName string, allowOverlap bool) (*LogicalSwitch, error) {
+	var shared *LogicalSwitch
+	for i := range sameSubnet {
+		ls := &sameSubnet[i]
+		if sharedName != "" && ls.Name == switchName {
+			shared = ls
+			continue
+		}
+		if !allowOverlap || ls.OtherConfig["docker:allow_overlap"] != "true" {
+			return nil, codedErrorf(ErrSubnetConflict, "subnet %s already in use by logical switch %s", subnet, ls.Name)
+		}
+	}
+	return shared, nil
+}
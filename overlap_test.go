@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubnetSwitch(t *testing.T) {
+	const subnet = "172.16.0.0/16"
+	plain := LogicalSwitch{Name: "ls-a", OtherConfig: map[string]string{"docker:subnet": subnet}}
+	overlapping := LogicalSwitch{Name: "ls-b", OtherConfig: map[string]string{"docker:subnet": subnet, "docker:allow_overlap": "true"}}
+	shared := LogicalSwitch{Name: "ls-web", OtherConfig: map[string]string{"docker:subnet": subnet}}
+
+	conflicts := func(sameSubnet []LogicalSwitch, sharedName string, allowOverlap bool) bool {
+		_, err := subnetSwitch(sameSubnet, subnet, "ls-web", sharedName, allowOverlap)
+		var driverErr *DriverError
+		return errors.As(err, &driverErr) && driverErr.Code == ErrSubnetConflict
+	}
+
+	// Overlapping takes the consent of both networks
+	if !conflicts([]LogicalSwitch{plain}, "", false) {
+		t.Error("a used subnet was accepted")
+	}
+	if !conflicts([]LogicalSwitch{plain}, "", true) {
+		t.Error("a network allowing overlap took the subnet of one that does not")
+	}
+	if !conflicts([]LogicalSwitch{overlapping}, "", false) {
+		t.Error("a network not allowing overlap took the subnet of one that does")
+	}
+	if conflicts([]LogicalSwitch{overlapping}, "", true) {
+		t.Error("two networks allowing overlap conflict")
+	}
+
+	// The switch of a shared network is adopted rather than conflicting,
+	// but only by a network naming it
+	ls, err := subnetSwitch([]LogicalSwitch{overlapping, shared}, subnet, "ls-web", "web", true)
+	if err != nil || ls == nil || ls.Name != "ls-web" {
+		t.Errorf("subnetSwitch() = %v, %v, want the shared switch ls-web", ls, err)
+	}
+	if !conflicts([]LogicalSwitch{shared}, "", false) {
+		t.Error("a switch was adopted without a shared network name")
+	}
+	if !conflicts([]LogicalSwitch{shared, plain}, "web", false) {
+		t.Error("a shared switch was adopted next to another network on its subnet")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ovn-org/libovsdb/client"
 	"github.com/ovn-org/libovsdb/model"
@@ -16,49 +18,190 @@ type LogicalSwitch struct {
 	UUID        string            `ovsdb:"_uuid"`
 	Name        string            `ovsdb:"name"`
 	Ports       []string          `ovsdb:"ports"`
+	QoSRules    []string          `ovsdb:"qos_rules"`
 	OtherConfig map[string]string `ovsdb:"other_config"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
 }
 
 type LogicalSwitchPort struct {
-	UUID         string            `ovsdb:"_uuid"`
-	Name         string            `ovsdb:"name"`
-	Addresses    []string          `ovsdb:"addresses"`
-	PortSecurity []string          `ovsdb:"port_security"`
-	Enabled      *bool             `ovsdb:"enabled"`
-	Type         string            `ovsdb:"type"`
-	Options      map[string]string `ovsdb:"options"`
-	ExternalIDs  map[string]string `ovsdb:"external_ids"`
+	UUID             string            `ovsdb:"_uuid"`
+	Name             string            `ovsdb:"name"`
+	Addresses        []string          `ovsdb:"addresses"`
+	PortSecurity     []string          `ovsdb:"port_security"`
+	DynamicAddresses *string           `ovsdb:"dynamic_addresses"`
+	Enabled          *bool             `ovsdb:"enabled"`
+	Type             string            `ovsdb:"type"`
+	Options          map[string]string `ovsdb:"options"`
+	DHCPv4           *string           `ovsdb:"dhcpv4_options"`
+	ParentName       *string           `ovsdb:"parent_name"`
+	TagRequest       *int              `ovsdb:"tag_request"`
+	ExternalIDs      map[string]string `ovsdb:"external_ids"`
+}
+
+// Every row created by the driver carries this external_ids tag; rows without it
+// belong to someone else sharing the NB database and are never modified
+const (
+	ownerExternalIDKey   = "docker-network-ovn"
+	ownerExternalIDValue = "owner"
+	tenantExternalIDKey  = "docker:tenant"
+)
+
+// namedUUIDs numbers the named UUIDs of the process
+var namedUUIDs atomic.Uint64
+
+// newNamedUUID returns a named UUID for a row inserted in a transaction.
+// Named UUIDs must be identifiers ([_a-zA-Z][_a-zA-Z0-9]*), so they are
+// numbered instead of derived from row names, which may hold '-' or '.'.
+func newNamedUUID(kind string) string {
+	return fmt.Sprintf("%s_named_%d", kind, namedUUIDs.Add(1))
+}
+
+// isOwned reports whether a row's external_ids carry the driver ownership tag
+func isOwned(externalIDs map[string]string) bool {
+	return externalIDs[ownerExternalIDKey] == ownerExternalIDValue
+}
+
+// withOwnerTag returns a copy of externalIDs including the ownership tag
+func withOwnerTag(externalIDs map[string]string) map[string]string {
+	tagged := make(map[string]string, len(externalIDs)+1)
+	for k, v := range externalIDs {
+		tagged[k] = v
+	}
+	tagged[ownerExternalIDKey] = ownerExternalIDValue
+	return tagged
+}
+
+// Neutron's OVN driver tags its rows with neutron:* external_ids
+const neutronExternalIDPrefix = "neutron:"
+
+// isNeutronOwned reports whether a row was created by OpenStack Neutron
+func isNeutronOwned(externalIDs map[string]string) bool {
+	for key := range externalIDs {
+		if strings.HasPrefix(key, neutronExternalIDPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSwitchOwned refuses switches without the ownership tag. Neutron rows are
+// refused even when tagged, since Neutron rewrites them on its next sync.
+func checkSwitchOwned(ls *LogicalSwitch) error {
+	if isNeutronOwned(ls.ExternalIDs) {
+		return fmt.Errorf("logical switch %s is managed by neutron, refusing to modify it", ls.Name)
+	}
+	if !isOwned(ls.ExternalIDs) {
+		return fmt.Errorf("logical switch %s is not owned by docker-network-ovn, refusing to modify it", ls.Name)
+	}
+	return nil
+}
+
+func checkPortOwned(lsp *LogicalSwitchPort) error {
+	if isNeutronOwned(lsp.ExternalIDs) {
+		return fmt.Errorf("logical switch port %s is managed by neutron, refusing to modify it", lsp.Name)
+	}
+	if !isOwned(lsp.ExternalIDs) {
+		return fmt.Errorf("logical switch port %s is not owned by docker-network-ovn, refusing to modify it", lsp.Name)
+	}
+	return nil
+}
+
+// ovnNBClientIndexes are the cache indexes backing the driver lookups. Callers
+// drop the rows a fallthrough index returned that do not match.
+func ovnNBClientIndexes() map[string][]model.ClientIndex {
+	return map[string][]model.ClientIndex{
+		"Logical_Switch": {
+			{Columns: []model.ColumnKey{{Column: "name"}}},
+			{Columns: []model.ColumnKey{{Column: "other_config", Key: "docker:subnet"}}},
+		},
+	}
+}
+
+// ownedMonitorOptions monitors the columns the driver reads of the rows
+// carrying the ownership tag, and tenant when set
+func ownedMonitorOptions(tenant string) []client.MonitorOption {
+	ownerTag := map[string]string{ownerExternalIDKey: ownerExternalIDValue}
+	if tenant != "" {
+		ownerTag[tenantExternalIDKey] = tenant
+	}
+
+	ls := &LogicalSwitch{}
+	lsp := &LogicalSwitchPort{}
+	return []client.MonitorOption{
+		client.WithConditionalTable(ls, []model.Condition{{
+			Field:    &ls.ExternalIDs,
+			Function: ovsdb.ConditionIncludes,
+			Value:    ownerTag,
+		}}, &ls.Name, &ls.Ports, &ls.OtherConfig, &ls.ExternalIDs),
+		client.WithConditionalTable(lsp, []model.Condition{{
+			Field:    &lsp.ExternalIDs,
+			Function: ovsdb.ConditionIncludes,
+			Value:    ownerTag,
+		}}, &lsp.Name, &lsp.Addresses, &lsp.PortSecurity, &lsp.DynamicAddresses, &lsp.ExternalIDs),
+		dhcpMonitorOption(ownerTag),
+		qosMonitorOption(ownerTag),
+	}
 }
 
 // OVNAPI provides a clean abstraction for OVN Northbound operations
 type OVNAPI struct {
 	client client.Client
 	ctx    context.Context
+	// externalIDs are added to every row the driver creates, next to the
+	// ownership tag, to follow the conventions of other NB controllers
+	externalIDs map[string]string
+	// txnRetryTimeout bounds re-dispatching of interrupted transactions
+	txnRetryTimeout time.Duration
+	// txnAttemptTimeout bounds each transaction attempt, 0 waits forever
+	txnAttemptTimeout time.Duration
+	// debug logs the operations and results of every transaction attempt
+	debug bool
+	// networks maps Docker networks to their switch, so lookups by network
+	// do not scan every switch
+	networks *NetworkCache
 }
 
 func NewOVNAPI(c client.Client, ctx context.Context) *OVNAPI {
-	return &OVNAPI{client: c, ctx: ctx}
+	return &OVNAPI{client: c, ctx: ctx, externalIDs: map[string]string{}}
+}
+
+// SetNetworkCache makes lookups by network go through the switch UUID kept in c
+func (o *OVNAPI) SetNetworkCache(c *NetworkCache) {
+	o.networks = c
+}
+
+// SetExternalID adds a key to the external_ids of rows created from now on
+func (o *OVNAPI) SetExternalID(key string, value string) {
+	o.externalIDs[key] = value
+}
+
+// tagExternalIDs returns a copy of externalIDs with the ownership tag and the
+// configured external_ids of created rows
+func (o *OVNAPI) tagExternalIDs(externalIDs map[string]string) map[string]string {
+	tagged := withOwnerTag(externalIDs)
+	for k, v := range o.externalIDs {
+		tagged[k] = v
+	}
+	return tagged
 }
 
 func (o *OVNAPI) findLogicalSwitch(name string) (*LogicalSwitch, bool, error) {
 	list := []LogicalSwitch{}
-	err := o.client.WhereCache(func(ls *LogicalSwitch) bool {
-		return ls.Name == name
-	}).List(o.ctx, &list)
+	err := o.client.Where(&LogicalSwitch{Name: name}).List(o.ctx, &list)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to list logical switches: %w", err)
 	}
-	if len(list) == 0 {
-		return nil, false, nil
+	for i := range list {
+		if list[i].Name == name {
+			return &list[i], true, nil
+		}
 	}
-	return &list[0], true, nil
+	return nil, false, nil
 }
 
 func (o *OVNAPI) findLogicalSwitchPort(name string) (*LogicalSwitchPort, bool, error) {
 	list := []LogicalSwitchPort{}
-	err := o.client.WhereCache(func(lsp *LogicalSwitchPort) bool {
-		return lsp.Name == name
-	}).List(o.ctx, &list)
+	err := o.client.Where(&LogicalSwitchPort{Name: name}).List(o.ctx, &list)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to list logical switch ports: %w", err)
 	}
@@ -68,48 +211,62 @@ func (o *OVNAPI) findLogicalSwitchPort(name string) (*LogicalSwitchPort, bool, e
 	return &list[0], true, nil
 }
 
-func (o *OVNAPI) findLogicalSwitchBySubnet(subnet string) (*LogicalSwitch, bool, error) {
+func (o *OVNAPI) findLogicalSwitchesBySubnet(subnet string) ([]LogicalSwitch, error) {
 	list := []LogicalSwitch{}
-	err := o.client.WhereCache(func(ls *LogicalSwitch) bool {
-		return ls.OtherConfig != nil && ls.OtherConfig["docker:subnet"] == subnet
+	err := o.client.Where(&LogicalSwitch{
+		OtherConfig: map[string]string{"docker:subnet": subnet},
 	}).List(o.ctx, &list)
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to list logical switches by subnet: %w", err)
+		return nil, fmt.Errorf("failed to list logical switches by subnet: %w", err)
 	}
-	if len(list) == 0 {
-		return nil, false, nil
+	matching := list[:0]
+	for _, ls := range list {
+		if ls.OtherConfig["docker:subnet"] == subnet {
+			matching = append(matching, ls)
+		}
 	}
-	return &list[0], true, nil
+	return matching, nil
 }
 
-func (o *OVNAPI) findLogicalSwitchPortByIP(switchName string, ipAddr string) (*LogicalSwitchPort, bool, error) {
-	ls, found, err := o.findLogicalSwitch(switchName)
-	if err != nil {
-		return nil, false, err
-	}
-	if !found {
-		return nil, false, nil
-	}
+// GetLogicalSwitch returns a logical switch by name
+func (o *OVNAPI) GetLogicalSwitch(name string) (*LogicalSwitch, bool, error) {
+	return o.findLogicalSwitch(name)
+}
 
-	portUUIDs := map[string]struct{}{}
-	for _, uuid := range ls.Ports {
-		portUUIDs[uuid] = struct{}{}
-	}
+// GetLogicalSwitchPort returns a logical switch port by name
+func (o *OVNAPI) GetLogicalSwitchPort(name string) (*LogicalSwitchPort, bool, error) {
+	return o.findLogicalSwitchPort(name)
+}
 
-	list := []LogicalSwitchPort{}
-	err = o.client.WhereCache(func(lsp *LogicalSwitchPort) bool {
-		if _, ok := portUUIDs[lsp.UUID]; !ok {
-			return false
+// ListLogicalSwitchesBySubnet returns the logical switches with matching
+// docker:subnet, several with ovn.allow_overlap
+func (o *OVNAPI) ListLogicalSwitchesBySubnet(subnet string) ([]LogicalSwitch, error) {
+	return o.findLogicalSwitchesBySubnet(subnet)
+}
+
+// GetLogicalSwitchByNetworkID returns the switch a Docker network is attached
+// to, which may be a shared switch named after another host's network
+func (o *OVNAPI) GetLogicalSwitchByNetworkID(networkID string) (*LogicalSwitch, bool, error) {
+	attached := func(ls *LogicalSwitch) bool {
+		_, attached := ls.OtherConfig[networkOtherConfigKey(networkID)]
+		return attached || ls.OtherConfig["docker:network"] == networkID
+	}
+	list := []LogicalSwitch{}
+	if config, ok := o.networks.Get(networkID); ok {
+		err := o.client.Where(&LogicalSwitch{UUID: config.SwitchUUID}).List(o.ctx, &list)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to list logical switches by network: %w", err)
 		}
-		for _, addr := range lsp.Addresses {
-			if logicalSwitchPortAddressHasIP(addr, ipAddr) {
-				return true
+		for i := range list {
+			if list[i].UUID == config.SwitchUUID && attached(&list[i]) {
+				return &list[i], true, nil
 			}
 		}
-		return false
-	}).List(o.ctx, &list)
+		list = list[:0]
+	}
+	err := o.client.WhereCache(attached).List(o.ctx, &list)
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to list logical switch ports by IP: %w", err)
+		return nil, false, fmt.Errorf("failed to list logical switches by network: %w", err)
 	}
 	if len(list) == 0 {
 		return nil, false, nil
@@ -117,69 +274,205 @@ func (o *OVNAPI) findLogicalSwitchPortByIP(switchName string, ipAddr string) (*L
 	return &list[0], true, nil
 }
 
-func logicalSwitchPortAddressHasIP(address string, ipAddr string) bool {
-	if address == ipAddr {
-		return true
+// ListDockerLogicalSwitches returns all driver-owned logical switches
+func (o *OVNAPI) ListDockerLogicalSwitches() ([]LogicalSwitch, error) {
+	list := []LogicalSwitch{}
+	err := o.client.WhereCache(func(ls *LogicalSwitch) bool {
+		return isOwned(ls.ExternalIDs)
+	}).List(o.ctx, &list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list docker logical switches: %w", err)
 	}
-	parts := strings.Fields(address)
-	for _, part := range parts {
-		if part == ipAddr {
-			return true
-		}
+	return list, nil
+}
+
+// ListDockerLogicalSwitchPorts returns all logical switch ports created for Docker endpoints
+func (o *OVNAPI) ListDockerLogicalSwitchPorts() ([]LogicalSwitchPort, error) {
+	list := []LogicalSwitchPort{}
+	err := o.client.WhereCache(func(lsp *LogicalSwitchPort) bool {
+		return isOwned(lsp.ExternalIDs) && lsp.ExternalIDs["docker:endpoint"] != ""
+	}).List(o.ctx, &list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list docker logical switch ports: %w", err)
 	}
-	return false
+	return list, nil
 }
 
-// GetLogicalSwitch returns a logical switch by name
-func (o *OVNAPI) GetLogicalSwitch(name string) (*LogicalSwitch, bool, error) {
-	return o.findLogicalSwitch(name)
+// ListLogicalSwitchPorts returns the ports attached to a logical switch
+func (o *OVNAPI) ListLogicalSwitchPorts(ls *LogicalSwitch) ([]LogicalSwitchPort, error) {
+	attached := make(map[string]bool, len(ls.Ports))
+	for _, uuid := range ls.Ports {
+		attached[uuid] = true
+	}
+	list := []LogicalSwitchPort{}
+	err := o.client.WhereCache(func(lsp *LogicalSwitchPort) bool {
+		return attached[lsp.UUID]
+	}).List(o.ctx, &list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logical switch ports: %w", err)
+	}
+	return list, nil
 }
 
-// GetLogicalSwitchPort returns a logical switch port by name
-func (o *OVNAPI) GetLogicalSwitchPort(name string) (*LogicalSwitchPort, bool, error) {
-	return o.findLogicalSwitchPort(name)
+// Transact executes a set of OVN Northbound operations, re-dispatching them
+// after transient failures when a retry timeout is configured
+func (o *OVNAPI) Transact(ops ...ovsdb.Operation) ([]ovsdb.OperationResult, error) {
+	ops = withRequestComment(o.ctx, ops)
+	if o.txnRetryTimeout > 0 {
+		results, err := o.transactWithRetry(ops, o.txnRetryTimeout)
+		return results, unavailableError(err)
+	}
+	results, err := o.transactOnce(ops)
+	return results, unavailableError(err)
 }
 
-// GetLogicalSwitchBySubnet returns a logical switch with matching docker:subnet
-func (o *OVNAPI) GetLogicalSwitchBySubnet(subnet string) (*LogicalSwitch, bool, error) {
-	return o.findLogicalSwitchBySubnet(subnet)
+// SetTransactRetryTimeout sets how long interrupted transactions are retried
+func (o *OVNAPI) SetTransactRetryTimeout(timeout time.Duration) {
+	o.txnRetryTimeout = timeout
 }
 
-// GetLogicalSwitchPortByIP returns a logical switch port on a switch matching an IP
-func (o *OVNAPI) GetLogicalSwitchPortByIP(switchName string, ipAddr string) (*LogicalSwitchPort, bool, error) {
-	return o.findLogicalSwitchPortByIP(switchName, ipAddr)
+// SetTransactAttemptTimeout sets how long one transaction attempt may wait
+// for an answer
+func (o *OVNAPI) SetTransactAttemptTimeout(timeout time.Duration) {
+	o.txnAttemptTimeout = timeout
 }
 
-// Transact executes a set of OVN Northbound operations
-func (o *OVNAPI) Transact(ops ...ovsdb.Operation) ([]ovsdb.OperationResult, error) {
-	return o.client.Transact(o.ctx, ops...)
+// SetDebug enables dumps of every transaction attempt
+func (o *OVNAPI) SetDebug(debug bool) {
+	o.debug = debug
 }
 
-// CreateLogicalSwitch creates a logical switch
-func (o *OVNAPI) CreateLogicalSwitch(name string, otherConfig map[string]string) error {
+// CreateLogicalSwitch creates a logical switch together with its initial ports
+// and any extra rows of the network in one transaction
+func (o *OVNAPI) CreateLogicalSwitch(name string, otherConfig map[string]string, ports []*LogicalSwitchPort, extraOps ...ovsdb.Operation) error {
 	ls := &LogicalSwitch{
 		Name:        name,
 		OtherConfig: otherConfig,
+		ExternalIDs: o.tagExternalIDs(nil),
+	}
+
+	ops := []ovsdb.Operation{}
+	for _, lsp := range ports {
+		lsp.UUID = newNamedUUID("lsp")
+		portOps, err := o.CreateLogicalSwitchPortOp(lsp)
+		if err != nil {
+			return fmt.Errorf("failed to create logical switch port operation: %w", err)
+		}
+		ops = append(ops, portOps...)
+		ls.Ports = append(ls.Ports, lsp.UUID)
 	}
 
-	ops, err := o.client.Create(ls)
+	switchOps, err := o.client.Create(ls)
 	if err != nil {
 		return fmt.Errorf("failed to create logical switch operation: %w", err)
 	}
+	ops = append(ops, switchOps...)
+	ops = append(ops, extraOps...)
+
+	// Switch names are not unique in the schema
+	noSwitch := 0
+	waitOps, err := o.client.WhereAny(ls, model.Condition{
+		Field:    &ls.Name,
+		Function: ovsdb.ConditionEqual,
+		Value:    name,
+	}).Wait(ovsdb.WaitConditionNotEqual, &noSwitch, ls, &ls.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create logical switch wait operation: %w", err)
+	}
+	ops = append(waitOps, ops...)
 
-	results, err := o.client.Transact(o.ctx, ops...)
+	results, err := o.Transact(ops...)
 	if err != nil {
 		return fmt.Errorf("failed to create logical switch: %w", err)
 	}
 
-	if len(results) == 0 || results[0].Error != "" {
-		errMsg := "unknown error"
-		if len(results) > 0 {
-			errMsg = results[0].Error
+	if len(results) == 0 {
+		return fmt.Errorf("failed to create logical switch: unknown error")
+	}
+	if err := transactError(nil, results); err != nil {
+		if results[0].Error != "" {
+			return fmt.Errorf("logical switch %s already exists", name)
+		}
+		return fmt.Errorf("failed to create logical switch: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateLogicalSwitchExternalIDsOp merges values into a switch's external_ids
+func (o *OVNAPI) UpdateLogicalSwitchExternalIDsOp(ls *LogicalSwitch, values map[string]string) ([]ovsdb.Operation, error) {
+	if err := checkSwitchOwned(ls); err != nil {
+		return nil, err
+	}
+
+	// Cached rows share their maps with the cache, so never modify them in place
+	updated := *ls
+	updated.ExternalIDs = withOwnerTag(ls.ExternalIDs)
+	for k, v := range values {
+		updated.ExternalIDs[k] = v
+	}
+	return o.client.Where(&updated).Update(&updated, &updated.ExternalIDs)
+}
+
+// RenameLogicalSwitch renames a switch, merges values into its external_ids
+// and moves the docker:switch of its endpoint ports along. The transaction
+// fails if the new name is taken or ports were attached since ls was read.
+func (o *OVNAPI) RenameLogicalSwitch(ls *LogicalSwitch, name string, values map[string]string) error {
+	if err := checkSwitchOwned(ls); err != nil {
+		return err
+	}
+
+	probe := &LogicalSwitch{Name: name}
+	noSwitch := 0
+	ops, err := o.client.WhereAny(probe, model.Condition{
+		Field:    &probe.Name,
+		Function: ovsdb.ConditionEqual,
+		Value:    name,
+	}).Wait(ovsdb.WaitConditionNotEqual, &noSwitch, probe, &probe.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create logical switch wait operation: %w", err)
+	}
+	portsWait, err := o.client.Where(ls).Wait(ovsdb.WaitConditionEqual, &noSwitch, ls, &ls.Ports)
+	if err != nil {
+		return fmt.Errorf("failed to create logical switch wait operation: %w", err)
+	}
+	ops = append(ops, portsWait...)
+
+	// Cached rows share their maps with the cache, so never modify them in place
+	updated := *ls
+	updated.Name = name
+	updated.ExternalIDs = withOwnerTag(ls.ExternalIDs)
+	for k, v := range values {
+		updated.ExternalIDs[k] = v
+	}
+	updateOps, err := o.client.Where(&updated).Update(&updated, &updated.Name, &updated.ExternalIDs)
+	if err != nil {
+		return fmt.Errorf("failed to create logical switch update operation: %w", err)
+	}
+	ops = append(ops, updateOps...)
+
+	ports, err := o.ListLogicalSwitchPorts(ls)
+	if err != nil {
+		return err
+	}
+	for i := range ports {
+		if ports[i].ExternalIDs["docker:switch"] == "" {
+			continue
 		}
-		return fmt.Errorf("failed to create logical switch: %s", errMsg)
+		portOps, err := o.UpdateLogicalSwitchPortExternalIDsOp(&ports[i], map[string]string{"docker:switch": name})
+		if err != nil {
+			return fmt.Errorf("failed to create update operation for logical switch port: %w", err)
+		}
+		ops = append(ops, portOps...)
 	}
 
+	results, err := o.Transact(ops...)
+	if err := transactError(err, results); err != nil {
+		if len(results) > 0 && results[0].Error != "" {
+			return fmt.Errorf("logical switch %s already exists", name)
+		}
+		return fmt.Errorf("failed to rename logical switch %s: %w", ls.Name, err)
+	}
 	return nil
 }
 
@@ -193,13 +486,16 @@ func (o *OVNAPI) DeleteLogicalSwitch(name string) error {
 		log.Printf("Logical switch %s not found, assuming already deleted", name)
 		return nil
 	}
+	if err := checkSwitchOwned(ls); err != nil {
+		return err
+	}
 
 	ops, err := o.client.Where(ls).Delete()
 	if err != nil {
 		return fmt.Errorf("failed to create delete operation: %w", err)
 	}
 
-	results, err := o.client.Transact(o.ctx, ops...)
+	results, err := o.Transact(ops...)
 	if err != nil {
 		return fmt.Errorf("failed to delete logical switch: %w", err)
 	}
@@ -214,6 +510,9 @@ func (o *OVNAPI) DeleteLogicalSwitch(name string) error {
 
 // MutateLogicalSwitchOtherConfigOp builds a mutation operation on a switch other_config
 func (o *OVNAPI) MutateLogicalSwitchOtherConfigOp(ls *LogicalSwitch, mutator ovsdb.Mutator, values map[string]string) ([]ovsdb.Operation, error) {
+	if err := checkSwitchOwned(ls); err != nil {
+		return nil, err
+	}
 	return o.client.Where(ls).Mutate(ls, model.Mutation{
 		Field:   &ls.OtherConfig,
 		Mutator: mutator,
@@ -221,18 +520,78 @@ func (o *OVNAPI) MutateLogicalSwitchOtherConfigOp(ls *LogicalSwitch, mutator ovs
 	})
 }
 
+// DeleteLogicalSwitchOtherConfigKeysOp builds a mutation removing keys from a switch other_config
+func (o *OVNAPI) DeleteLogicalSwitchOtherConfigKeysOp(ls *LogicalSwitch, keys []string) ([]ovsdb.Operation, error) {
+	if err := checkSwitchOwned(ls); err != nil {
+		return nil, err
+	}
+	return o.client.Where(ls).Mutate(ls, model.Mutation{
+		Field:   &ls.OtherConfig,
+		Mutator: ovsdb.MutateOperationDelete,
+		Value:   keys,
+	})
+}
+
 // CreateLogicalSwitchPortOp builds an operation to create a logical switch port
 func (o *OVNAPI) CreateLogicalSwitchPortOp(lsp *LogicalSwitchPort) ([]ovsdb.Operation, error) {
+	lsp.ExternalIDs = o.tagExternalIDs(lsp.ExternalIDs)
 	return o.client.Create(lsp)
 }
 
+// UpdateLogicalSwitchPortExternalIDsOp builds an operation setting keys in a port external_ids
+func (o *OVNAPI) UpdateLogicalSwitchPortExternalIDsOp(lsp *LogicalSwitchPort, values map[string]string) ([]ovsdb.Operation, error) {
+	if err := checkPortOwned(lsp); err != nil {
+		return nil, err
+	}
+
+	// Cached rows share their maps with the cache, so never modify them in place
+	updated := *lsp
+	updated.ExternalIDs = withOwnerTag(lsp.ExternalIDs)
+	for k, v := range values {
+		updated.ExternalIDs[k] = v
+	}
+	return o.client.Where(&updated).Update(&updated, &updated.ExternalIDs)
+}
+
+// DeleteLogicalSwitchPortExternalIDsOp builds a mutation removing keys from a
+// port external_ids
+func (o *OVNAPI) DeleteLogicalSwitchPortExternalIDsOp(lsp *LogicalSwitchPort, keys []string) ([]ovsdb.Operation, error) {
+	if err := checkPortOwned(lsp); err != nil {
+		return nil, err
+	}
+	return o.client.Where(lsp).Mutate(lsp, model.Mutation{
+		Field:   &lsp.ExternalIDs,
+		Mutator: ovsdb.MutateOperationDelete,
+		Value:   keys,
+	})
+}
+
+// UpdateLogicalSwitchPortAddressesOp replaces the addresses and port_security
+// of a logical switch port
+func (o *OVNAPI) UpdateLogicalSwitchPortAddressesOp(lsp *LogicalSwitchPort, addresses []string, portSecurity []string) ([]ovsdb.Operation, error) {
+	if err := checkPortOwned(lsp); err != nil {
+		return nil, err
+	}
+
+	updated := *lsp
+	updated.Addresses = addresses
+	updated.PortSecurity = portSecurity
+	return o.client.Where(&updated).Update(&updated, &updated.Addresses, &updated.PortSecurity)
+}
+
 // DeleteLogicalSwitchPortOp builds an operation to delete a logical switch port
 func (o *OVNAPI) DeleteLogicalSwitchPortOp(lsp *LogicalSwitchPort) ([]ovsdb.Operation, error) {
+	if err := checkPortOwned(lsp); err != nil {
+		return nil, err
+	}
 	return o.client.Where(lsp).Delete()
 }
 
 // MutateLogicalSwitchPortsOp builds a mutation operation on a switch ports list
 func (o *OVNAPI) MutateLogicalSwitchPortsOp(ls *LogicalSwitch, mutator ovsdb.Mutator, portUUIDs []string) ([]ovsdb.Operation, error) {
+	if err := checkSwitchOwned(ls); err != nil {
+		return nil, err
+	}
 	return o.client.Where(ls).Mutate(ls, model.Mutation{
 		Field:   &ls.Ports,
 		Mutator: mutator,
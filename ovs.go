@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
+	"slices"
 	"strings"
 
 	"github.com/ovn-org/libovsdb/client"
@@ -22,30 +24,86 @@ type Port struct {
 	UUID       string   `ovsdb:"_uuid"`
 	Name       string   `ovsdb:"name"`
 	Interfaces []string `ovsdb:"interfaces"`
+	BondMode   *string  `ovsdb:"bond_mode"`
+	LACP       *string  `ovsdb:"lacp"`
+	Trunks     []int    `ovsdb:"trunks"`
 }
 
 type Interface struct {
-	UUID        string            `ovsdb:"_uuid"`
-	Name        string            `ovsdb:"name"`
-	Type        string            `ovsdb:"type"`
-	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	UUID                 string            `ovsdb:"_uuid"`
+	Name                 string            `ovsdb:"name"`
+	Type                 string            `ovsdb:"type"`
+	IngressPolicingRate  int               `ovsdb:"ingress_policing_rate"`
+	IngressPolicingBurst int               `ovsdb:"ingress_policing_burst"`
+	Statistics           map[string]int    `ovsdb:"statistics"`
+	ExternalIDs          map[string]string `ovsdb:"external_ids"`
+	LACPCurrent          *bool             `ovsdb:"lacp_current"`
 }
 
 type OpenvSwitch struct {
 	UUID        string            `ovsdb:"_uuid"`
 	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	Bridges     []string          `ovsdb:"bridges"`
+}
+
+// ovsClientIndexes adds cache indexes for lookups not covered by the schema
+// indexes (Bridge, Port and Interface are already indexed by name)
+func ovsClientIndexes() map[string][]model.ClientIndex {
+	return map[string][]model.ClientIndex{
+		"Interface": {
+			{Columns: []model.ColumnKey{{Column: "external_ids", Key: "iface-id"}}},
+		},
+	}
+}
+
+// ovsSystemMonitorOptions monitors the Open_vSwitch row, which holds the
+// chassis configuration the driver needs before anything else
+func ovsSystemMonitorOptions() []client.MonitorOption {
+	ovs := &OpenvSwitch{}
+	return []client.MonitorOption{
+		client.WithTable(ovs, &ovs.ExternalIDs),
+	}
+}
+
+// ovsPortMonitorOptions monitors only the bridge/port/interface columns the
+// driver reads back
+func ovsPortMonitorOptions() []client.MonitorOption {
+	bridge := &Bridge{}
+	port := &Port{}
+	iface := &Interface{}
+	return []client.MonitorOption{
+		client.WithTable(bridge, &bridge.Name, &bridge.Ports),
+		client.WithTable(port, &port.Name, &port.Interfaces, &port.BondMode, &port.LACP, &port.Trunks),
+		client.WithTable(iface, &iface.Name, &iface.Statistics, &iface.ExternalIDs, &iface.LACPCurrent),
+	}
 }
 
 // OVSAPI provides a clean abstraction for OVS operations
 type OVSAPI struct {
 	client client.Client
 	ctx    context.Context
+	// debug logs the operations and results of every transaction
+	debug bool
 }
 
 func NewOVSAPI(c client.Client, ctx context.Context) *OVSAPI {
 	return &OVSAPI{client: c, ctx: ctx}
 }
 
+// SetDebug enables dumps of every transaction
+func (o *OVSAPI) SetDebug(debug bool) {
+	o.debug = debug
+}
+
+func (o *OVSAPI) transact(ops ...ovsdb.Operation) ([]ovsdb.OperationResult, error) {
+	ops = withRequestComment(o.ctx, ops)
+	results, err := o.client.Transact(o.ctx, ops...)
+	if o.debug {
+		dumpTransaction(o.ctx, "Open_vSwitch", ops, results, err)
+	}
+	return results, err
+}
+
 // GetOVNNBConnection reads OVN NB connection from OVS database
 func (o *OVSAPI) GetOVNNBConnection() (string, error) {
 	// List all Open_vSwitch entries
@@ -76,6 +134,19 @@ func (o *OVSAPI) GetOVNNBConnection() (string, error) {
 	return defaultConnection, nil
 }
 
+// GetSystemID returns this chassis' system-id, which OVN uses to identify the
+// host in the southbound Chassis table; empty when ovn-controller is not set up
+func (o *OVSAPI) GetSystemID() (string, error) {
+	ovsList := []OpenvSwitch{}
+	if err := o.client.List(o.ctx, &ovsList); err != nil {
+		return "", fmt.Errorf("failed to list Open_vSwitch table: %w", err)
+	}
+	if len(ovsList) == 0 {
+		return "", nil
+	}
+	return ovsList[0].ExternalIDs["system-id"], nil
+}
+
 // normalizeOVNConnection ensures the connection string has a proper scheme
 func normalizeOVNConnection(conn string) string {
 	if strings.HasPrefix(conn, "unix:") || strings.HasPrefix(conn, "tcp:") ||
@@ -97,9 +168,7 @@ func normalizeOVNConnection(conn string) string {
 
 func (o *OVSAPI) findBridge(name string) (*Bridge, bool, error) {
 	bridgeList := []Bridge{}
-	err := o.client.WhereCache(func(b *Bridge) bool {
-		return b.Name == name
-	}).List(o.ctx, &bridgeList)
+	err := o.client.Where(&Bridge{Name: name}).List(o.ctx, &bridgeList)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to list bridges: %w", err)
 	}
@@ -109,27 +178,136 @@ func (o *OVSAPI) findBridge(name string) (*Bridge, bool, error) {
 	return &bridgeList[0], true, nil
 }
 
-// AddPortToBridge adds a port and interface to an OVS bridge
-func (o *OVSAPI) AddPortToBridge(bridgeName string, ovsPortName string, interfaceName string, ifaceID string) error {
-	bridge, found, err := o.findBridge(bridgeName)
+// GetInterfaceByIfaceID returns the interface bound to an OVN logical port
+func (o *OVSAPI) GetInterfaceByIfaceID(ifaceID string) (*Interface, bool, error) {
+	ifaceList := []Interface{}
+	err := o.client.Where(&Interface{
+		ExternalIDs: map[string]string{"iface-id": ifaceID},
+	}).List(o.ctx, &ifaceList)
 	if err != nil {
-		return err
+		return nil, false, fmt.Errorf("failed to list interfaces: %w", err)
 	}
-	if !found {
-		return fmt.Errorf("bridge %s not found", bridgeName)
+	if len(ifaceList) == 0 {
+		return nil, false, nil
 	}
+	return &ifaceList[0], true, nil
+}
 
-	ifaceUUID := fmt.Sprintf("iface_named_%s", interfaceName)
-	portUUID := fmt.Sprintf("port_named_%s", ovsPortName)
+// GetInterface returns an interface by name
+func (o *OVSAPI) GetInterface(name string) (*Interface, bool, error) {
+	ifaceList := []Interface{}
+	err := o.client.Where(&Interface{Name: name}).List(o.ctx, &ifaceList)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	if len(ifaceList) == 0 {
+		return nil, false, nil
+	}
+	return &ifaceList[0], true, nil
+}
 
-	iface := &Interface{
-		UUID: ifaceUUID,
+// ListOwnedInterfaces returns the interfaces created by the driver
+func (o *OVSAPI) ListOwnedInterfaces() ([]Interface, error) {
+	ifaceList := []Interface{}
+	err := o.client.WhereCache(func(iface *Interface) bool {
+		return isOwned(iface.ExternalIDs)
+	}).List(o.ctx, &ifaceList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	return ifaceList, nil
+}
+
+// interfaceBinding returns the external_ids binding an interface to the
+// logical switch port of an endpoint
+func interfaceBinding(lsp *LogicalSwitchPort) map[string]string {
+	binding := map[string]string{"iface-id": lsp.Name}
+	if endpointID := lsp.ExternalIDs["docker:endpoint"]; endpointID != "" {
+		binding["iface-id-ver"] = endpointID
+	}
+	if len(lsp.Addresses) > 0 {
+		if fields := strings.Fields(lsp.Addresses[0]); len(fields) > 0 {
+			if _, err := net.ParseMAC(fields[0]); err == nil {
+				binding["attached-mac"] = fields[0]
+			}
+		}
+	}
+	return binding
+}
+
+// bindingDrifted reports whether an interface is bound to another logical
+// switch port or endpoint. Interfaces plugged before iface-id-ver was written
+// have none and still match.
+func bindingDrifted(iface *Interface, binding map[string]string) bool {
+	if iface.ExternalIDs["iface-id"] != binding["iface-id"] {
+		return true
+	}
+	ver := iface.ExternalIDs["iface-id-ver"]
+	return ver != "" && ver != binding["iface-id-ver"]
+}
+
+// SetInterfaceBinding binds an interface to another logical switch port
+func (o *OVSAPI) SetInterfaceBinding(iface *Interface, binding map[string]string) error {
+	// Cached rows share their maps with the cache, so never modify them in place
+	updated := *iface
+	updated.ExternalIDs = map[string]string{}
+	for k, v := range iface.ExternalIDs {
+		updated.ExternalIDs[k] = v
+	}
+	for k, v := range binding {
+		updated.ExternalIDs[k] = v
+	}
+	ops, err := o.client.Where(&updated).Update(&updated, &updated.ExternalIDs)
+	if err != nil {
+		return fmt.Errorf("failed to create update operation for interface %s: %w", iface.Name, err)
+	}
+	results, err := o.transact(ops...)
+	if err != nil {
+		return fmt.Errorf("failed to bind interface %s: %w", iface.Name, err)
+	}
+	for _, res := range results {
+		if res.Error != "" {
+			return fmt.Errorf("transaction error: %s", res.Error)
+		}
+	}
+	return nil
+}
+
+// AddPortToBridge adds a port and interface to an OVS bridge, the interface
+// carrying the binding from interfaceBinding
+func (o *OVSAPI) AddPortToBridge(bridgeName string, ovsPortName string, interfaceName string, binding map[string]string) error {
+	return o.addPort(bridgeName, ovsPortName, &Interface{
 		Name: interfaceName,
 		Type: "",
-		ExternalIDs: map[string]string{
-			"iface-id": ifaceID,
-		},
+		// The ownership tag lets the reconciler find interfaces whose logical
+		// switch port is gone
+		ExternalIDs: withOwnerTag(binding),
+	})
+}
+
+// AddInternalPort adds a port whose interface OVS creates on the host, bound
+// to an OVN logical port. Management ports have no endpoint, so it carries
+// no ownership tag and the reconciler leaves it alone.
+func (o *OVSAPI) AddInternalPort(bridgeName string, name string, ifaceID string) error {
+	return o.addPort(bridgeName, name, &Interface{
+		Name:        name,
+		Type:        "internal",
+		ExternalIDs: map[string]string{"iface-id": ifaceID},
+	})
+}
+
+func (o *OVSAPI) addPort(bridgeName string, ovsPortName string, iface *Interface) error {
+	bridge, found, err := o.findBridge(bridgeName)
+	if err != nil {
+		return err
 	}
+	if !found {
+		return fmt.Errorf("bridge %s not found", bridgeName)
+	}
+
+	ifaceUUID := newNamedUUID("iface")
+	portUUID := newNamedUUID("port")
+	iface.UUID = ifaceUUID
 
 	port := &Port{
 		UUID:       portUUID,
@@ -158,7 +336,7 @@ func (o *OVSAPI) AddPortToBridge(bridgeName string, ovsPortName string, interfac
 
 	allOps := append(ifaceOps, portOps...)
 	allOps = append(allOps, bridgeMutateOps...)
-	results, err := o.client.Transact(o.ctx, allOps...)
+	results, err := o.transact(allOps...)
 	if err != nil {
 		return fmt.Errorf("failed to create interface/port and attach to bridge: %w", err)
 	}
@@ -169,16 +347,39 @@ func (o *OVSAPI) AddPortToBridge(bridgeName string, ovsPortName string, interfac
 		}
 	}
 
-	log.Printf("Successfully added port %s to OVS bridge %s with iface-id=%s", ovsPortName, bridgeName, ifaceID)
+	log.Printf("Successfully added port %s to OVS bridge %s with iface-id=%s", ovsPortName, bridgeName, iface.ExternalIDs["iface-id"])
+	return nil
+}
+
+// SetIngressPolicing sets the ingress policing rate (kbps) and burst (kb) of
+// an interface; a zero rate disables policing
+func (o *OVSAPI) SetIngressPolicing(interfaceName string, rate int, burst int) error {
+	iface := &Interface{
+		Name:                 interfaceName,
+		IngressPolicingRate:  rate,
+		IngressPolicingBurst: burst,
+	}
+	ops, err := o.client.Where(iface).Update(iface, &iface.IngressPolicingRate, &iface.IngressPolicingBurst)
+	if err != nil {
+		return fmt.Errorf("failed to create update operation for interface %s: %w", interfaceName, err)
+	}
+	results, err := o.transact(ops...)
+	if err != nil {
+		return fmt.Errorf("failed to set ingress policing on %s: %w", interfaceName, err)
+	}
+	for _, res := range results {
+		if res.Error != "" {
+			return fmt.Errorf("transaction error: %s", res.Error)
+		}
+	}
 	return nil
 }
 
-// RemovePort removes a port from an OVS bridge and deletes its interface
+// RemovePort removes a port from an OVS bridge and deletes its interfaces in a
+// single transaction
 func (o *OVSAPI) RemovePort(bridgeName string, portName string) error {
 	portList := []Port{}
-	err := o.client.WhereCache(func(p *Port) bool {
-		return p.Name == portName
-	}).List(o.ctx, &portList)
+	err := o.client.Where(&Port{Name: portName}).List(o.ctx, &portList)
 	if err != nil {
 		return fmt.Errorf("failed to list ports: %w", err)
 	}
@@ -188,11 +389,20 @@ func (o *OVSAPI) RemovePort(bridgeName string, portName string) error {
 	}
 
 	port := &portList[0]
+	ops := []ovsdb.Operation{}
 
 	bridge, found, err := o.findBridge(bridgeName)
 	if err != nil {
 		return err
 	}
+	if !found || !slices.Contains(bridge.Ports, port.UUID) {
+		// The network's ovn.bridge may differ from the bridge given, e.g. for
+		// a stale interface whose network is gone
+		bridge, found, err = o.bridgeOfPort(port.UUID)
+		if err != nil {
+			return err
+		}
+	}
 	if !found {
 		log.Printf("Warning: bridge %s not found while removing port %s", bridgeName, portName)
 	} else {
@@ -202,53 +412,36 @@ func (o *OVSAPI) RemovePort(bridgeName string, portName string) error {
 			Value:   []string{port.UUID},
 		})
 		if err != nil {
-			log.Printf("Warning: failed to create mutate operation for bridge: %v", err)
-		} else {
-			results, err := o.client.Transact(o.ctx, bridgeMutateOps...)
-			if err != nil {
-				log.Printf("Warning: failed to remove port from bridge: %v", err)
-			} else if len(results) > 0 && results[0].Error != "" {
-				log.Printf("Warning: failed to remove port from bridge: %s", results[0].Error)
-			}
+			return fmt.Errorf("failed to create mutate operation for bridge: %w", err)
 		}
+		ops = append(ops, bridgeMutateOps...)
 	}
 
 	portOps, err := o.client.Where(port).Delete()
 	if err != nil {
 		return fmt.Errorf("failed to create delete operation for port: %w", err)
 	}
+	ops = append(ops, portOps...)
 
-	results, err := o.client.Transact(o.ctx, portOps...)
-	if err != nil {
-		return fmt.Errorf("failed to remove port: %w", err)
+	for _, ifaceUUID := range port.Interfaces {
+		ifaceOps, err := o.client.Where(&Interface{UUID: ifaceUUID}).Delete()
+		if err != nil {
+			return fmt.Errorf("failed to create delete operation for interface: %w", err)
+		}
+		ops = append(ops, ifaceOps...)
 	}
 
-	if len(results) > 0 && results[0].Error != "" {
-		return fmt.Errorf("failed to remove port: %s", results[0].Error)
+	results, err := o.transact(ops...)
+	if err != nil {
+		return fmt.Errorf("failed to remove port: %w", err)
 	}
 
-	log.Printf("Removed port %s from OVS", portName)
-
-	ifaceList := []Interface{}
-	err = o.client.WhereCache(func(i *Interface) bool {
-		return i.Name == portName
-	}).List(o.ctx, &ifaceList)
-	if err == nil && len(ifaceList) > 0 {
-		iface := &ifaceList[0]
-		ifaceOps, err := o.client.Where(iface).Delete()
-		if err != nil {
-			log.Printf("Warning: failed to create delete operation for interface: %v", err)
-		} else {
-			results, err := o.client.Transact(o.ctx, ifaceOps...)
-			if err != nil {
-				log.Printf("Warning: failed to delete interface: %v", err)
-			} else if len(results) > 0 && results[0].Error != "" {
-				log.Printf("Warning: failed to delete interface: %s", results[0].Error)
-			} else {
-				log.Printf("Deleted interface %s from OVS", portName)
-			}
+	for _, res := range results {
+		if res.Error != "" {
+			return fmt.Errorf("failed to remove port: %s", res.Error)
 		}
 	}
 
+	log.Printf("Removed port %s and its interfaces from OVS", portName)
 	return nil
 }
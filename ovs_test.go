@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterfaceBinding(t *testing.T) {
+	lsp := &LogicalSwitchPort{
+		Name:        "lsp-3fa9c0a1b2c3",
+		Addresses:   []string{"02:00:00:00:00:01 172.16.0.2", "00:00:5e:00:01:01"},
+		ExternalIDs: map[string]string{"docker:endpoint": "3fa9c0a1b2c3d4e5"},
+	}
+	want := map[string]string{
+		"iface-id":     "lsp-3fa9c0a1b2c3",
+		"iface-id-ver": "3fa9c0a1b2c3d4e5",
+		"attached-mac": "02:00:00:00:00:01",
+	}
+	if got := interfaceBinding(lsp); !reflect.DeepEqual(got, want) {
+		t.Errorf("interfaceBinding() = %v, want %v", got, want)
+	}
+
+	// Ports not created for an endpoint, or without a static MAC, are bound
+	// by iface-id alone
+	for _, addresses := range [][]string{nil, {"unknown"}, {"dynamic"}} {
+		lsp := &LogicalSwitchPort{Name: "lsp-a", Addresses: addresses}
+		if got := interfaceBinding(lsp); !reflect.DeepEqual(got, map[string]string{"iface-id": "lsp-a"}) {
+			t.Errorf("interfaceBinding() with addresses %q = %v", addresses, got)
+		}
+	}
+}
+
+func TestBindingDrifted(t *testing.T) {
+	binding := interfaceBinding(&LogicalSwitchPort{
+		Name:        "lsp-a",
+		Addresses:   []string{"02:00:00:00:00:01 172.16.0.2"},
+		ExternalIDs: map[string]string{"docker:endpoint": "ep1"},
+	})
+	iface := func(externalIDs map[string]string) *Interface {
+		return &Interface{ExternalIDs: externalIDs}
+	}
+
+	if bindingDrifted(iface(binding), binding) {
+		t.Error("an interface with the binding of the port drifted")
+	}
+	if bindingDrifted(iface(map[string]string{"iface-id": "lsp-a"}), binding) {
+		t.Error("an interface plugged before iface-id-ver was written drifted")
+	}
+	if !bindingDrifted(iface(map[string]string{"iface-id": "lsp-a", "iface-id-ver": "ep0"}), binding) {
+		t.Error("an interface of an earlier endpoint reusing the port name did not drift")
+	}
+	if !bindingDrifted(iface(map[string]string{"iface-id": "lsp-b", "iface-id-ver": "ep1"}), binding) {
+		t.Error("an interface bound to another port did not drift")
+	}
+	if !bindingDrifted(iface(nil), binding) {
+		t.Error("an unbound interface did not drift")
+	}
+}
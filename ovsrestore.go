@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ovn-org/libovsdb/cache"
+	"github.com/ovn-org/libovsdb/model"
+)
+
+// ovsRestoreDelay lets a rebuilt bridge settle, and a Leave that removed its
+// port delete the veth, before ports are restored
+const ovsRestoreDelay = 2 * time.Second
+
+// OVSPortRestorer re-adds the OVS ports of joined endpoints that vanished
+// while their containers kept running
+type OVSPortRestorer struct {
+	trigger chan struct{}
+}
+
+// NewOVSPortRestorer creates a restorer; register EventHandler before
+// monitoring OVS
+func NewOVSPortRestorer() *OVSPortRestorer {
+	return &OVSPortRestorer{trigger: make(chan struct{}, 1)}
+}
+
+// EventHandler returns the OVS cache handler scheduling a restore when an
+// interface or bridge goes away or a bridge (re)appears
+func (r *OVSPortRestorer) EventHandler() cache.EventHandler {
+	return &cache.EventHandlerFuncs{
+		AddFunc: func(table string, m model.Model) {
+			if _, ok := m.(*Bridge); ok {
+				r.schedule()
+			}
+		},
+		DeleteFunc: func(table string, m model.Model) {
+			switch m.(type) {
+			case *Bridge, *Interface:
+				r.schedule()
+			}
+		},
+	}
+}
+
+func (r *OVSPortRestorer) schedule() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run restores ports once at startup, covering OVS restarts while the plugin
+// was down, then whenever scheduled until ctx is cancelled
+func (r *OVSPortRestorer) Run(ctx context.Context, d *OVNDriver) {
+	r.schedule()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.trigger:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ovsRestoreDelay):
+		}
+		// Events of the same rebuild are handled by this pass
+		select {
+		case <-r.trigger:
+		default:
+		}
+		d.restoreOVSPorts()
+	}
+}
+
+// restoreOVSPorts plugs the host veth of every joined endpoint without an OVS
+// interface back into the integration bridge. Endpoints whose veth does not
+// exist on this host were joined elsewhere or have left.
+func (d *OVNDriver) restoreOVSPorts() {
+	lsps, err := d.ovn.ListDockerLogicalSwitchPorts()
+	if err != nil {
+		log.Printf("Warning: failed to list ports to restore in OVS: %v", err)
+		return
+	}
+	for _, lsp := range lsps {
+		if lsp.ExternalIDs["docker:sandbox"] == "" || lsp.ExternalIDs["docker:parent"] != "" {
+			continue
+		}
+		if _, found, err := d.ovs.GetInterfaceByIfaceID(lsp.Name); err != nil || found {
+			continue
+		}
+		vethName := d.endpointVeth(&lsp)
+		if _, err := runCommand("ip", "link", "show", "dev", vethName); err != nil {
+			continue
+		}
+		bridge := d.bridgeFor(lsp.ExternalIDs["docker:network"])
+		if _, found, err := d.ovs.findBridge(bridge); err != nil || !found {
+			// Restored once the bridge is added back
+			continue
+		}
+
+		log.Printf("OVS port of %s is missing, plugging %s back into %s", lsp.Name, vethName, bridge)
+		if err := d.ovs.AddPortToBridge(bridge, vethName, vethName, interfaceBinding(&lsp)); err != nil {
+			log.Printf("Warning: failed to restore OVS port of %s: %v", lsp.Name, err)
+			ovsPortRestores.WithLabelValues("failed").Inc()
+			continue
+		}
+		ovsPortRestores.WithLabelValues("restored").Inc()
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Container labels setting OVS ingress policing on the host side veth, in
+// kbps and kb. Policing is done by the kernel datapath, so it works without
+// OVN QoS support.
+const (
+	ingressPolicingRateLabel  = "ovn.ingress_policing_rate"
+	ingressPolicingBurstLabel = "ovn.ingress_policing_burst"
+)
+
+// ingressPolicing parses the policing labels of a container; found is false
+// when the container sets none
+func ingressPolicing(labels map[string]string) (rate int, burst int, found bool, err error) {
+	rateValue, hasRate := labels[ingressPolicingRateLabel]
+	burstValue, hasBurst := labels[ingressPolicingBurstLabel]
+	if !hasRate && !hasBurst {
+		return 0, 0, false, nil
+	}
+	if !hasRate {
+		return 0, 0, false, fmt.Errorf("%s requires %s", ingressPolicingBurstLabel, ingressPolicingRateLabel)
+	}
+	rate, err = strconv.Atoi(rateValue)
+	if err != nil || rate < 0 {
+		return 0, 0, false, fmt.Errorf("invalid %s=%q: expected a rate in kbps", ingressPolicingRateLabel, rateValue)
+	}
+	if hasBurst {
+		burst, err = strconv.Atoi(burstValue)
+		if err != nil || burst < 0 {
+			return 0, 0, false, fmt.Errorf("invalid %s=%q: expected a burst in kb", ingressPolicingBurstLabel, burstValue)
+		}
+	}
+	return rate, burst, true, nil
+}
+
+// applyIngressPolicing limits what a container can send through its veth
+// according to its labels
+func (d *OVNDriver) applyIngressPolicing(vethName string, labels map[string]string) error {
+	rate, burst, found, err := ingressPolicing(labels)
+	if err != nil || !found {
+		return err
+	}
+	if d.ovs == nil {
+		return fmt.Errorf("ingress policing needs a local OVS, it is not available in nested mode")
+	}
+	if err := d.ovs.SetIngressPolicing(vethName, rate, burst); err != nil {
+		return err
+	}
+	d.logf("Policing ingress of %s at %d kbps, burst %d kb", vethName, rate, burst)
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+// WorkerPool runs tasks on a fixed number of goroutines, bounding how many
+// run concurrently while letting callers submit from any goroutine
+type WorkerPool struct {
+	tasks chan func()
+}
+
+// NewWorkerPool starts workers goroutines consuming a queue of queueSize tasks
+func NewWorkerPool(workers int, queueSize int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &WorkerPool{tasks: make(chan func(), queueSize)}
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+func (p *WorkerPool) worker() {
+	for task := range p.tasks {
+		task()
+	}
+}
+
+// Do queues task and blocks until a worker has run it
+func (p *WorkerPool) Do(task func()) {
+	done := make(chan struct{})
+	p.tasks <- func() {
+		defer close(done)
+		task()
+	}
+	<-done
+}
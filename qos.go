@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// QoS is the OVN Northbound QoS table; rows referenced by a switch's
+// qos_rules act on the traffic matching them
+type QoS struct {
+	UUID        string            `ovsdb:"_uuid"`
+	Priority    int               `ovsdb:"priority"`
+	Direction   string            `ovsdb:"direction"`
+	Match       string            `ovsdb:"match"`
+	Action      map[string]int    `ovsdb:"action"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+}
+
+// dscpOption marks the IP traffic sent by endpoints with a DSCP value, for
+// every endpoint of a network with -o or for one endpoint with --driver-opt
+const dscpOption = "ovn.dscp"
+
+const (
+	maxDSCP      = 63
+	dscpPriority = 100
+)
+
+// validateDSCP accepts a 6 bit DSCP value
+func validateDSCP(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > maxDSCP {
+		return fmt.Errorf("expected 0 to %d", maxDSCP)
+	}
+	return nil
+}
+
+// createDSCPOps creates the QoS rule marking the traffic of a port and adds it
+// to the switch. The port is matched by name, so the rule may be created in
+// the same transaction as the port.
+func (o *OVNAPI) createDSCPOps(ls *LogicalSwitch, portName string, dscp int) ([]ovsdb.Operation, error) {
+	if err := checkSwitchOwned(ls); err != nil {
+		return nil, err
+	}
+	rule := &QoS{
+		UUID:        newNamedUUID("qos"),
+		Priority:    dscpPriority,
+		Direction:   "from-lport",
+		Match:       fmt.Sprintf("inport == %q && ip", portName),
+		Action:      map[string]int{"dscp": dscp},
+		ExternalIDs: o.tagExternalIDs(map[string]string{"docker:port": portName}),
+	}
+	ops, err := o.client.Create(rule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create QoS operation: %w", err)
+	}
+	mutateOps, err := o.client.Where(ls).Mutate(ls, model.Mutation{
+		Field:   &ls.QoSRules,
+		Mutator: ovsdb.MutateOperationInsert,
+		Value:   []string{rule.UUID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mutate operation for QoS rules: %w", err)
+	}
+	return append(ops, mutateOps...), nil
+}
+
+// deleteDSCPOps removes the QoS rules of a port from the switch
+func (o *OVNAPI) deleteDSCPOps(ls *LogicalSwitch, portName string) ([]ovsdb.Operation, error) {
+	rules := []QoS{}
+	err := o.client.WhereCache(func(row *QoS) bool {
+		return row.ExternalIDs["docker:port"] == portName && isOwned(row.ExternalIDs)
+	}).List(o.ctx, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list QoS rules: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	if err := checkSwitchOwned(ls); err != nil {
+		return nil, err
+	}
+
+	uuids := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		uuids = append(uuids, rule.UUID)
+	}
+	// QoS rows are not root rows, ovsdb-server removes them once unreferenced
+	return o.client.Where(ls).Mutate(ls, model.Mutation{
+		Field:   &ls.QoSRules,
+		Mutator: ovsdb.MutateOperationDelete,
+		Value:   uuids,
+	})
+}
+
+// qosMonitorOption monitors the driver-owned QoS rows
+func qosMonitorOption(ownerTag map[string]string) client.MonitorOption {
+	row := &QoS{}
+	return client.WithConditionalTable(row, []model.Condition{{
+		Field:    &row.ExternalIDs,
+		Function: ovsdb.ConditionIncludes,
+		Value:    ownerTag,
+	}}, &row.ExternalIDs)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// Error a RAFT cluster returns for a transaction sent to a server that is not
+// the leader, which therefore never committed it; see
+// raft_command_status_to_string in ovsdb/raft.c
+const clusterNotLeaderError = "not leader"
+
+// Error a RAFT cluster returns when the leader changed while a transaction
+// was in flight. The new leader may or may not have committed it.
+const clusterLostLeadershipError = "lost leadership"
+
+// transactErrorClass tells how a failed transaction may be retried
+type transactErrorClass int
+
+const (
+	// txnPermanent failures are returned as is
+	txnPermanent transactErrorClass = iota
+	// txnNotCommitted failures were rejected before committing anything
+	txnNotCommitted
+	// txnUncertain failures may have committed
+	txnUncertain
+)
+
+// referentialIntegrityError is returned when a transaction references a row
+// a concurrent transaction deleted, or deletes a row still referenced
+const referentialIntegrityError = "referential integrity violation"
+
+// maxIntegrityRetries bounds retries of referential integrity failures, which
+// only clear up when they were caused by a race
+const maxIntegrityRetries = 3
+
+// classifyTransactError classifies the failure of a transaction
+func classifyTransactError(err error, results []ovsdb.OperationResult) transactErrorClass {
+	if err != nil {
+		switch {
+		case errors.Is(err, client.ErrNotConnected), errors.Is(err, context.DeadlineExceeded):
+			return txnUncertain
+		}
+		return txnPermanent
+	}
+	for _, result := range results {
+		if result.Error == "" {
+			continue
+		}
+		if strings.Contains(result.Error, clusterNotLeaderError) || strings.Contains(result.Details, clusterNotLeaderError) {
+			return txnNotCommitted
+		}
+		if strings.Contains(result.Error, clusterLostLeadershipError) || strings.Contains(result.Details, clusterLostLeadershipError) {
+			return txnUncertain
+		}
+		if result.Error == referentialIntegrityError {
+			return txnNotCommitted
+		}
+	}
+	return txnPermanent
+}
+
+func hasIntegrityError(results []ovsdb.OperationResult) bool {
+	for _, result := range results {
+		if result.Error == referentialIntegrityError {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotentOps reports whether ops hold no insert, the only driver
+// operation whose second application differs
+func idempotentOps(ops []ovsdb.Operation) bool {
+	for _, op := range ops {
+		if op.Op == ovsdb.OperationInsert {
+			return false
+		}
+	}
+	return true
+}
+
+// transactOnce runs one attempt of a transaction, bounded by the attempt
+// timeout when set
+func (o *OVNAPI) transactOnce(ops []ovsdb.Operation) ([]ovsdb.OperationResult, error) {
+	ctx := o.ctx
+	if o.txnAttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.txnAttemptTimeout)
+		defer cancel()
+	}
+	results, err := o.client.Transact(ctx, ops...)
+	if o.debug {
+		dumpTransaction(ctx, "OVN_Northbound", ops, results, err)
+	}
+	return results, err
+}
+
+// transactWithRetry re-dispatches a transaction that failed transiently until
+// timeout elapses
+func (o *OVNAPI) transactWithRetry(ops []ovsdb.Operation, timeout time.Duration) ([]ovsdb.OperationResult, error) {
+	var results []ovsdb.OperationResult
+	var err error
+
+	retry := backoff.NewExponentialBackOff()
+	retry.InitialInterval = 200 * time.Millisecond
+	retry.MaxElapsedTime = timeout
+
+	idempotent := idempotentOps(ops)
+	attempt := 0
+	integrityFailures := 0
+	retryErr := backoff.Retry(func() error {
+		attempt++
+		results, err = o.transactOnce(ops)
+		switch classifyTransactError(err, results) {
+		case txnPermanent:
+			return nil
+		case txnUncertain:
+			if !idempotent {
+				return nil
+			}
+		case txnNotCommitted:
+			if hasIntegrityError(results) {
+				integrityFailures++
+				if integrityFailures >= maxIntegrityRetries {
+					return nil
+				}
+			}
+		}
+		log.Printf("Warning: OVN NB transaction%s failed transiently (attempt %d), retrying: %v", requestSuffix(requestIDFrom(o.ctx)), attempt, transactError(err, results))
+		return fmt.Errorf("transaction failed transiently")
+	}, backoff.WithContext(retry, o.ctx))
+	if retryErr != nil && o.ctx.Err() != nil {
+		return nil, o.ctx.Err()
+	}
+	// Once the timeout elapses the last failure is returned as is
+	return results, err
+}
+
+// transactError describes the failure of a transaction for logging
+func transactError(err error, results []ovsdb.OperationResult) error {
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			return fmt.Errorf("%s: %s", result.Error, result.Details)
+		}
+	}
+	return nil
+}
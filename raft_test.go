@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// fakeNB answers transactions with canned replies, repeating the last one,
+// and records the operations it was sent
+type fakeNB struct {
+	client.Client
+	replies []fakeReply
+	sent    [][]ovsdb.Operation
+}
+
+type fakeReply struct {
+	results []ovsdb.OperationResult
+	err     error
+}
+
+func (f *fakeNB) Transact(ctx context.Context, ops ...ovsdb.Operation) ([]ovsdb.OperationResult, error) {
+	f.sent = append(f.sent, ops)
+	reply := f.replies[min(len(f.sent), len(f.replies))-1]
+	return reply.results, reply.err
+}
+
+var (
+	insertOps = []ovsdb.Operation{{Op: ovsdb.OperationInsert, Table: "Logical_Switch_Port"}, {Op: ovsdb.OperationMutate, Table: "Logical_Switch"}}
+	mutateOps = []ovsdb.Operation{{Op: ovsdb.OperationMutate, Table: "Logical_Switch"}}
+
+	committed  = fakeReply{results: []ovsdb.OperationResult{{}, {}}}
+	notLeader  = fakeReply{results: []ovsdb.OperationResult{{Error: "not leader", Details: "ovsdb-server is not the cluster leader"}}}
+	timedOut   = fakeReply{err: context.DeadlineExceeded}
+	integrity  = fakeReply{results: []ovsdb.OperationResult{{}, {Error: referentialIntegrityError}}}
+	constraint = fakeReply{results: []ovsdb.OperationResult{{Error: "constraint violation"}}}
+)
+
+// transactWithFake runs transactWithRetry against replies and returns the
+// number of attempts and the outcome
+func transactWithFake(ops []ovsdb.Operation, timeout time.Duration, replies ...fakeReply) (int, []ovsdb.OperationResult, error) {
+	nb := &fakeNB{replies: replies}
+	results, err := NewOVNAPI(nb, context.Background()).transactWithRetry(ops, timeout)
+	return len(nb.sent), results, err
+}
+
+func TestTransactWithRetryReDispatchesRejectedTransactions(t *testing.T) {
+	attempts, results, err := transactWithFake(insertOps, 10*time.Second, notLeader, integrity, committed)
+	if err := transactError(err, results); err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("sent %d attempts, want 3", attempts)
+	}
+}
+
+func TestTransactWithRetryUncertainCommit(t *testing.T) {
+	for name, uncertain := range map[string]fakeReply{
+		"attempt timeout":    timedOut,
+		"lost leadership":    {results: []ovsdb.OperationResult{{Error: "lost leadership"}}},
+		"dropped connection": {err: client.ErrNotConnected},
+	} {
+		// An insert that may have been committed is not sent again, it
+		// could create a second row
+		attempts, results, err := transactWithFake(insertOps, 10*time.Second, uncertain, committed)
+		if transactError(err, results) == nil || attempts != 1 {
+			t.Errorf("%s: insert sent %d times, want it failed after 1", name, attempts)
+		}
+
+		attempts, results, err = transactWithFake(mutateOps, 10*time.Second, uncertain, committed)
+		if err := transactError(err, results); err != nil || attempts != 2 {
+			t.Errorf("%s: mutate got %v after %d attempts, want success after 2", name, err, attempts)
+		}
+	}
+}
+
+func TestTransactWithRetryGivesUp(t *testing.T) {
+	attempts, results, _ := transactWithFake(mutateOps, 10*time.Second, integrity)
+	if attempts != maxIntegrityRetries || !hasIntegrityError(results) {
+		t.Errorf("referential integrity: %d attempts returning %v, want %d returning the violation", attempts, results, maxIntegrityRetries)
+	}
+
+	attempts, results, _ = transactWithFake(mutateOps, 10*time.Second, constraint, committed)
+	if attempts != 1 || transactError(nil, results) == nil {
+		t.Errorf("constraint violation: %d attempts returning %v, want 1 returning the violation", attempts, results)
+	}
+
+	start := time.Now()
+	attempts, results, _ = transactWithFake(mutateOps, 500*time.Millisecond, notLeader)
+	if classifyTransactError(nil, results) != txnNotCommitted || attempts < 2 {
+		t.Errorf("election: %d attempts returning %v, want the last not leader reply", attempts, results)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("retried for %v past a 500ms timeout", elapsed)
+	}
+}
+
+func TestTransactCommentsRequestOnce(t *testing.T) {
+	nb := &fakeNB{replies: []fakeReply{notLeader, committed}}
+	api := NewOVNAPI(nb, withRequestID(context.Background(), "0123456789ab"))
+	api.SetTransactRetryTimeout(10 * time.Second)
+	if _, err := api.Transact(mutateOps...); err != nil {
+		t.Fatal(err)
+	}
+	if len(nb.sent) != 2 {
+		t.Fatalf("sent %d attempts, want 2", len(nb.sent))
+	}
+	for i, ops := range nb.sent {
+		if len(ops) != len(mutateOps)+1 || ops[len(ops)-1].Op != ovsdb.OperationComment {
+			t.Errorf("attempt %d sent %v, want the operations followed by one comment", i+1, ops)
+		}
+	}
+}
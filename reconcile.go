@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// OVSReconciler compares the docker-owned logical switch ports joined on this
+// host with the interfaces of the local OVS
+type OVSReconciler struct {
+	driver *OVNDriver
+	repair bool
+}
+
+// Kinds of drift, used as metric labels
+const (
+	driftMissingInterface = "missing_interface"
+	driftWrongIfaceID     = "wrong_iface_id"
+	driftStaleInterface   = "stale_interface"
+)
+
+// NewOVSReconciler creates a reconciler; with repair set, missing interfaces
+// are re-added, wrong iface-ids rewritten and stale interfaces removed
+func NewOVSReconciler(d *OVNDriver, repair bool) *OVSReconciler {
+	return &OVSReconciler{driver: d, repair: repair}
+}
+
+// Run reconciles every interval until ctx is cancelled
+func (r *OVSReconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reconcileOnce()
+		}
+	}
+}
+
+func (r *OVSReconciler) reconcileOnce() {
+	d := r.driver
+	lsps, err := d.ovn.ListDockerLogicalSwitchPorts()
+	if err != nil {
+		log.Printf("Warning: OVS reconciliation failed: %v", err)
+		return
+	}
+
+	drift := map[string]int{driftMissingInterface: 0, driftWrongIfaceID: 0, driftStaleInterface: 0}
+	ports := make(map[string]bool, len(lsps))
+	for _, lsp := range lsps {
+		ports[lsp.Name] = true
+		if lsp.ExternalIDs["docker:sandbox"] == "" || lsp.ExternalIDs["docker:parent"] != "" {
+			continue
+		}
+		// Left endpoints lose their interfaces once their cleanup has run
+		if d.cleanups.Queued(lsp.ExternalIDs["docker:endpoint"]) {
+			continue
+		}
+		// Ports joined on other hosts have no local veth
+		vethName := d.endpointVeth(&lsp)
+		if _, err := runCommand("ip", "link", "show", "dev", vethName); err != nil {
+			continue
+		}
+
+		iface, found, err := d.ovs.GetInterface(vethName)
+		if err != nil {
+			log.Printf("Warning: OVS reconciliation could not inspect %s: %v", lsp.Name, err)
+			continue
+		}
+		if !found {
+			drift[driftMissingInterface]++
+			log.Printf("Warning: OVS drift on %s: veth %s is not in OVS", lsp.Name, vethName)
+			if r.repair {
+				r.repaired(driftMissingInterface, d.ovs.AddPortToBridge(d.bridgeFor(lsp.ExternalIDs["docker:network"]), vethName, vethName, interfaceBinding(&lsp)))
+			}
+			continue
+		}
+		if binding := interfaceBinding(&lsp); bindingDrifted(iface, binding) {
+			drift[driftWrongIfaceID]++
+			log.Printf("Warning: OVS drift on %s: interface %s has iface-id %q version %q", lsp.Name, vethName,
+				iface.ExternalIDs["iface-id"], iface.ExternalIDs["iface-id-ver"])
+			if r.repair {
+				r.repaired(driftWrongIfaceID, d.ovs.SetInterfaceBinding(iface, binding))
+			}
+		}
+	}
+
+	ifaces, err := d.ovs.ListOwnedInterfaces()
+	if err != nil {
+		log.Printf("Warning: OVS reconciliation failed: %v", err)
+		return
+	}
+	for _, iface := range ifaces {
+		ifaceID := iface.ExternalIDs["iface-id"]
+		if ports[ifaceID] || (ifaceID == "" && iface.ExternalIDs[vethPoolExternalIDKey] == "true") {
+			// Pooled veths are unbound until a Join claims them
+			continue
+		}
+		drift[driftStaleInterface]++
+		log.Printf("Warning: OVS drift: interface %s is bound to missing logical switch port %q", iface.Name, ifaceID)
+		if r.repair {
+			err := d.ovs.RemovePort(d.bridge, iface.Name)
+			if err == nil {
+				cleanupCommand("ip", "link", "del", iface.Name)
+			}
+			r.repaired(driftStaleInterface, err)
+		}
+	}
+
+	for kind, count := range drift {
+		ovsReconcileDrift.WithLabelValues(kind).Set(float64(count))
+	}
+	ovsReconcileRuns.Inc()
+}
+
+// repaired logs and counts the result of one repair
+func (r *OVSReconciler) repaired(kind string, err error) {
+	if err != nil {
+		log.Printf("Warning: failed to repair %s: %v", kind, err)
+		ovsReconcileRepairs.WithLabelValues(kind, "failed").Inc()
+		return
+	}
+	ovsReconcileRepairs.WithLabelValues(kind, "repaired").Inc()
+}
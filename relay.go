@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/ovn-org/libovsdb/client"
+)
+
+// relayInactivityProbe is how long a relay connection may stay silent before
+// an echo is sent; a relay that stops answering is dropped for the next one
+const relayInactivityProbe = 30 * time.Second
+
+// splitEndpoints parses a comma separated OVSDB remote list, as accepted by
+// ovn-nb/ovn-remote and the ovn-* utilities
+func splitEndpoints(value string) []string {
+	endpoints := []string{}
+	for _, endpoint := range strings.Split(value, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint != "" {
+			endpoints = append(endpoints, normalizeOVNConnection(endpoint))
+		}
+	}
+	return endpoints
+}
+
+// preferRelays orders the relay endpoints first, shuffled so hosts spread
+// across relays, followed by the direct database endpoints as a fallback
+func preferRelays(relays []string, direct []string) []string {
+	endpoints := make([]string, 0, len(relays)+len(direct))
+	endpoints = append(endpoints, relays...)
+	rand.Shuffle(len(endpoints), func(i, j int) {
+		endpoints[i], endpoints[j] = endpoints[j], endpoints[i]
+	})
+
+	seen := map[string]bool{}
+	for _, endpoint := range endpoints {
+		seen[endpoint] = true
+	}
+	for _, endpoint := range direct {
+		if !seen[endpoint] {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// dbClientOptions returns the endpoint, TLS and reconnection options of an
+// OVN database client, reconnecting to the RAFT leader with leaderOnly
+func dbClientOptions(endpoints []string, files TLSFiles, relay bool, leaderOnly bool) ([]client.Option, *CertReloader, error) {
+	options := []client.Option{}
+	tlsEndpoint := endpoints[0]
+	for _, endpoint := range endpoints {
+		options = append(options, client.WithEndpoint(endpoint))
+		if isSSLEndpoint(endpoint) {
+			tlsEndpoint = endpoint
+		}
+	}
+
+	tlsOptions, reloader, err := tlsClientOptions(tlsEndpoint, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	options = append(options, tlsOptions...)
+
+	switch {
+	case relay:
+		options = append(options, client.WithInactivityCheck(relayInactivityProbe, 10*time.Second, newReconnectBackoff()))
+	case reloader == nil && (len(endpoints) > 1 || leaderOnly):
+		options = append(options, client.WithReconnect(10*time.Second, newReconnectBackoff()))
+	}
+	if leaderOnly && !relay {
+		options = append(options, client.WithLeaderOnly(true))
+	}
+	return options, reloader, nil
+}
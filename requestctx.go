@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/docker/go-plugins-helpers/network"
+	"github.com/docker/go-plugins-helpers/sdk"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+const networkDriverManifest = `{"Implements": ["NetworkDriver"]}`
+
+// newPluginHandler returns the plugin HTTP handler of a driver, running each
+// call on a copy bound to the request, and serving one of its flavors unless
+// flavor is nil
+func newPluginHandler(d *OVNDriver, flavor *Flavor) sdk.Handler {
+	h := sdk.NewHandler(networkDriverManifest)
+	h.HandleFunc("/NetworkDriver.GetCapabilities", func(w http.ResponseWriter, r *http.Request) {
+		res, err := d.GetCapabilities()
+		encodeDriverResponse(w, res, err)
+	})
+	handleDriverCall(h, d, "/NetworkDriver.CreateNetwork",
+		withLifecycleEvent(eventNetworkCreate, noResponse(func(d *OVNDriver, r *network.CreateNetworkRequest) error {
+			return d.CreateNetwork(flavor.withOptions(r))
+		})))
+	handleDriverCall(h, d, "/NetworkDriver.AllocateNetwork", (*OVNDriver).AllocateNetwork)
+	handleDriverCall(h, d, "/NetworkDriver.DeleteNetwork",
+		withLifecycleEvent(eventNetworkDelete, noResponse((*OVNDriver).DeleteNetwork)))
+	handleDriverCall(h, d, "/NetworkDriver.FreeNetwork", noResponse((*OVNDriver).FreeNetwork))
+	handleDriverCall(h, d, "/NetworkDriver.CreateEndpoint",
+		withLifecycleEvent(eventEndpointCreate, (*OVNDriver).CreateEndpoint))
+	handleDriverCall(h, d, "/NetworkDriver.DeleteEndpoint",
+		withLifecycleEvent(eventEndpointDelete, noResponse((*OVNDriver).DeleteEndpoint)))
+	handleDriverCall(h, d, "/NetworkDriver.EndpointOperInfo", (*OVNDriver).EndpointInfo)
+	handleDriverCall(h, d, "/NetworkDriver.Join", (*OVNDriver).Join)
+	handleDriverCall(h, d, "/NetworkDriver.Leave", noResponse((*OVNDriver).Leave))
+	handleDriverCall(h, d, "/NetworkDriver.DiscoverNew", noResponse((*OVNDriver).DiscoverNew))
+	handleDriverCall(h, d, "/NetworkDriver.DiscoverDelete", noResponse((*OVNDriver).DiscoverDelete))
+	handleDriverCall(h, d, "/NetworkDriver.ProgramExternalConnectivity", noResponse((*OVNDriver).ProgramExternalConnectivity))
+	handleDriverCall(h, d, "/NetworkDriver.RevokeExternalConnectivity", noResponse((*OVNDriver).RevokeExternalConnectivity))
+	return h
+}
+
+// handleDriverCall decodes the request of path and runs call on the driver
+// bound to the request context
+func handleDriverCall[Req any, Res any](h sdk.Handler, d *OVNDriver, path string, call func(*OVNDriver, *Req) (Res, error)) {
+	h.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		req := new(Req)
+		if err := sdk.DecodeRequest(w, r, req); err != nil {
+			return
+		}
+		bound := d.withContext(withRequestID(r.Context(), newRequestID()))
+		res, err := call(bound, req)
+		if err != nil {
+			bound.logf("%s failed: %v", path[1:], err)
+		}
+		bound.trackCall(path, req, err)
+		encodeDriverResponse(w, res, err)
+	})
+}
+
+// noResponse adapts a driver call answering with an empty object
+func noResponse[Req any](call func(*OVNDriver, *Req) error) func(*OVNDriver, *Req) (struct{}, error) {
+	return func(d *OVNDriver, req *Req) (struct{}, error) {
+		return struct{}{}, call(d, req)
+	}
+}
+
+func encodeDriverResponse(w http.ResponseWriter, res interface{}, err error) {
+	if err != nil {
+		sdk.EncodeResponse(w, network.NewErrorResponse(err.Error()), true)
+		return
+	}
+	sdk.EncodeResponse(w, res, false)
+}
+
+// withContext returns a copy of the driver whose database work is bound to
+// ctx. Work outliving the request runs on background().
+func (d *OVNDriver) withContext(ctx context.Context) *OVNDriver {
+	bound := *d
+	bound.root = d.background()
+	bound.ovn = d.ovn.withContext(ctx)
+	if d.ovs != nil {
+		bound.ovs = d.ovs.withContext(ctx)
+	}
+	return &bound
+}
+
+// background returns the driver unbound from the request context, keeping its
+// request ID
+func (d *OVNDriver) background() *OVNDriver {
+	if d.root == nil {
+		return d
+	}
+	id := requestIDFrom(d.context())
+	if id == "" {
+		return d.root
+	}
+	unbound := *d.root
+	unbound.ovn = d.root.ovn.withContext(withRequestID(d.root.ovn.ctx, id))
+	if d.root.ovs != nil {
+		unbound.ovs = d.root.ovs.withContext(withRequestID(d.root.ovs.ctx, id))
+	}
+	return &unbound
+}
+
+// context returns the context bounding the driver's work
+func (d *OVNDriver) context() context.Context {
+	return d.ovn.ctx
+}
+
+func (o *OVNAPI) withContext(ctx context.Context) *OVNAPI {
+	bound := *o
+	bound.ctx = ctx
+	return &bound
+}
+
+func (o *OVSAPI) withContext(ctx context.Context) *OVSAPI {
+	bound := *o
+	bound.ctx = ctx
+	return &bound
+}
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// newRequestID returns a random request ID, short enough for log lines
+func newRequestID() string {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom returns the request ID of ctx, empty outside of requests
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestSuffix names a request ID in a log line, if any
+func requestSuffix(id string) string {
+	if id != "" {
+		return " of request " + id
+	}
+	return ""
+}
+
+// logf logs a line prefixed with the request ID the driver is bound to
+func (d *OVNDriver) logf(format string, args ...interface{}) {
+	if id := requestIDFrom(d.context()); id != "" {
+		log.Printf("[%s] %s", id, fmt.Sprintf(format, args...))
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// withRequestComment appends a comment naming the request ID of ctx to a
+// transaction; ovsdb-server keeps it in the database log next to the changes
+func withRequestComment(ctx context.Context, ops []ovsdb.Operation) []ovsdb.Operation {
+	id := requestIDFrom(ctx)
+	if id == "" {
+		return ops
+	}
+	comment := "docker-network-ovn request " + id
+	return append(ops[:len(ops):len(ops)], ovsdb.Operation{Op: ovsdb.OperationComment, Comment: &comment})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OVN Southbound Database Models
+type PortBinding struct {
+	UUID        string            `ovsdb:"_uuid"`
+	LogicalPort string            `ovsdb:"logical_port"`
+	Chassis     *string           `ovsdb:"chassis"`
+	Up          *bool             `ovsdb:"up"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+}
+
+type Chassis struct {
+	UUID     string `ovsdb:"_uuid"`
+	Name     string `ovsdb:"name"`
+	Hostname string `ovsdb:"hostname"`
+}
+
+// newSBClientDBModel returns the southbound tables the driver reads
+func newSBClientDBModel() (model.ClientDBModel, error) {
+	return model.NewClientDBModel("OVN_Southbound",
+		map[string]model.Model{
+			"Port_Binding": &PortBinding{},
+			"Chassis":      &Chassis{},
+		})
+}
+
+// sbMonitorOptions monitors the bindings of driver-owned ports, which
+// ovn-northd creates with the external_ids of the NB port, and every chassis
+func sbMonitorOptions(tenant string) []client.MonitorOption {
+	ownerTag := map[string]string{ownerExternalIDKey: ownerExternalIDValue}
+	if tenant != "" {
+		ownerTag[tenantExternalIDKey] = tenant
+	}
+
+	pb := &PortBinding{}
+	chassis := &Chassis{}
+	return []client.MonitorOption{
+		client.WithConditionalTable(pb, []model.Condition{{
+			Field:    &pb.ExternalIDs,
+			Function: ovsdb.ConditionIncludes,
+			Value:    ownerTag,
+		}}, &pb.LogicalPort, &pb.Chassis, &pb.Up, &pb.ExternalIDs),
+		client.WithTable(chassis, &chassis.Name, &chassis.Hostname),
+	}
+}
+
+// SBAPI provides read access to OVN Southbound binding state
+type SBAPI struct {
+	client client.Client
+	ctx    context.Context
+}
+
+func NewSBAPI(c client.Client, ctx context.Context) *SBAPI {
+	return &SBAPI{client: c, ctx: ctx}
+}
+
+// PortBindingStatus describes where a logical switch port is bound
+type PortBindingStatus struct {
+	Found    bool
+	Chassis  string
+	Hostname string
+	Up       bool
+}
+
+// Bound reports whether a chassis has claimed the port
+func (s PortBindingStatus) Bound() bool {
+	return s.Chassis != ""
+}
+
+func (s *SBAPI) findChassis(uuid string) (*Chassis, bool, error) {
+	list := []Chassis{}
+	err := s.client.Where(&Chassis{UUID: uuid}).List(s.ctx, &list)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list chassis: %w", err)
+	}
+	if len(list) == 0 {
+		return nil, false, nil
+	}
+	return &list[0], true, nil
+}
+
+// bindingStatus resolves the chassis of a cached port binding
+func (s *SBAPI) bindingStatus(pb *PortBinding) (PortBindingStatus, error) {
+	status := PortBindingStatus{Found: true, Up: pb.Up != nil && *pb.Up}
+	if pb.Chassis == nil {
+		return status, nil
+	}
+	chassis, found, err := s.findChassis(*pb.Chassis)
+	if err != nil {
+		return status, err
+	}
+	if found {
+		status.Chassis = chassis.Name
+		status.Hostname = chassis.Hostname
+	} else {
+		status.Chassis = *pb.Chassis
+	}
+	return status, nil
+}
+
+// GetPortBindingStatus returns the binding of a logical switch port
+func (s *SBAPI) GetPortBindingStatus(logicalPort string) (PortBindingStatus, error) {
+	list := []PortBinding{}
+	err := s.client.Where(&PortBinding{LogicalPort: logicalPort}).List(s.ctx, &list)
+	if err != nil {
+		return PortBindingStatus{}, fmt.Errorf("failed to list port bindings: %w", err)
+	}
+	if len(list) == 0 {
+		return PortBindingStatus{}, nil
+	}
+	return s.bindingStatus(&list[0])
+}
+
+// portBindingCollector reports southbound binding state at scrape time
+type portBindingCollector struct {
+	sb      *SBAPI
+	bound   *prometheus.Desc
+	unbound *prometheus.Desc
+}
+
+func newPortBindingCollector(sb *SBAPI) *portBindingCollector {
+	return &portBindingCollector{
+		sb: sb,
+		bound: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "bound_ports"),
+			"Joined endpoint ports bound to a chassis, by chassis.",
+			[]string{"chassis"}, nil),
+		unbound: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "unbound_ports"),
+			"Joined endpoint ports no chassis has claimed.",
+			nil, nil),
+	}
+}
+
+func (c *portBindingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bound
+	ch <- c.unbound
+}
+
+func (c *portBindingCollector) Collect(ch chan<- prometheus.Metric) {
+	list := []PortBinding{}
+	if err := c.sb.client.List(c.sb.ctx, &list); err != nil {
+		return
+	}
+
+	bound := map[string]int{}
+	unbound := 0
+	for i := range list {
+		// Ports that were never joined have no container and are not expected
+		// to be bound anywhere yet
+		if list[i].ExternalIDs["docker:sandbox"] == "" {
+			continue
+		}
+		status, err := c.sb.bindingStatus(&list[i])
+		if err != nil {
+			continue
+		}
+		if status.Bound() {
+			bound[status.Chassis]++
+		} else {
+			unbound++
+		}
+	}
+
+	for chassis, count := range bound {
+		ch <- prometheus.MustNewConstMetric(c.bound, prometheus.GaugeValue, float64(count), chassis)
+	}
+	ch <- prometheus.MustNewConstMetric(c.unbound, prometheus.GaugeValue, float64(unbound))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// secondaryAddressesLabel lists extra addresses (e.g. link-local or anycast
+// service IPs) of a container's OVN interfaces. The label suffixed with
+// ".<network name>" applies to that network only and takes precedence.
+const secondaryAddressesLabel = "ovn.secondary_addresses"
+
+// secondaryAddresses parses the comma separated "ip[/prefix]" entries of the
+// secondary address label that applies to a network
+func secondaryAddresses(labels map[string]string, networkName string) ([]*net.IPNet, error) {
+	value, key := networkLabel(labels, secondaryAddressesLabel, networkName)
+
+	addrs := []*net.IPNet{}
+	for _, entry := range splitOptionList(value) {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() == nil {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		ip, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s=%q: %q is not an address", key, value, entry)
+		}
+		ipNet.IP = ip
+		addrs = append(addrs, ipNet)
+	}
+	return addrs, nil
+}
+
+// addSecondaryAddresses adds addresses to the first addresses and
+// port_security entries of a joined endpoint's port, then to its interface
+// inside the sandbox. Addresses used by another port of the switch are skipped.
+func (d *OVNDriver) addSecondaryAddresses(portName string, sandboxKey string, addrs []*net.IPNet) error {
+	lsp, found, err := d.ovn.GetLogicalSwitchPort(portName)
+	if err != nil {
+		return err
+	}
+	if !found || len(lsp.Addresses) == 0 || len(lsp.PortSecurity) == 0 {
+		// Removed in the meantime
+		return nil
+	}
+	switchName := portSwitchName(lsp)
+	macAddr := strings.Fields(lsp.Addresses[0])[0]
+
+	addresses := append([]string{}, lsp.Addresses...)
+	portSecurity := append([]string{}, lsp.PortSecurity...)
+	known := map[string]bool{}
+	for _, ip := range strings.Fields(addresses[0])[1:] {
+		known[ip] = true
+	}
+	added := []*net.IPNet{}
+	for _, addr := range addrs {
+		ip := addr.IP.String()
+		if port, used := d.networks.PortByIP(switchName, ip); used && port != portName {
+			d.logf("Warning: secondary address %s of %s is used by port %s, skipping it", ip, portName, port)
+			continue
+		}
+		added = append(added, addr)
+		if !known[ip] {
+			known[ip] = true
+			addresses[0] += " " + ip
+			portSecurity[0] += " " + ip
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	ops, err := d.ovn.UpdateLogicalSwitchPortAddressesOp(lsp, addresses, portSecurity)
+	if err != nil {
+		return err
+	}
+	results, err := d.ovn.Transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to add secondary addresses to %s: %w", portName, err)
+	}
+
+	iface, err := sandboxInterface(sandboxKey, macAddr)
+	if err != nil {
+		return err
+	}
+	for _, addr := range added {
+		if _, err := runCommand("nsenter", "--net="+sandboxKey, "ip", "addr", "replace", addr.String(), "dev", iface); err != nil {
+			return fmt.Errorf("failed to add %s to %s: %w", addr, iface, err)
+		}
+	}
+	d.logf("Added secondary addresses %v to %s", added, portName)
+	return nil
+}
+
+// sandboxInterface returns the name of the interface with a MAC address in a
+// container network namespace
+func sandboxInterface(sandboxKey string, macAddr string) (string, error) {
+	out, err := runCommand("nsenter", "--net="+sandboxKey, "ip", "-o", "link", "show")
+	if err != nil {
+		return "", fmt.Errorf("failed to list interfaces of %s: %w", sandboxKey, err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "link/ether" && strings.EqualFold(fields[i+1], macAddr) {
+				name, _, _ := strings.Cut(strings.TrimSuffix(fields[1], ":"), "@")
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no interface with MAC %s in %s", macAddr, sandboxKey)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/docker/go-connections/sockets"
+)
+
+// SocketConfig controls where the plugin socket is created and who may use it
+type SocketConfig struct {
+	Path    string
+	Group   string
+	Mode    os.FileMode
+	DirMode os.FileMode
+}
+
+// listenPluginSocket creates the Docker plugin unix socket with the configured
+// group ownership and permissions
+func listenPluginSocket(cfg SocketConfig) (net.Listener, error) {
+	gid, err := lookupGroupID(cfg.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	pluginDir := filepath.Dir(cfg.Path)
+	if err := os.MkdirAll(pluginDir, cfg.DirMode); err != nil {
+		return nil, fmt.Errorf("failed to create plugin directory: %w", err)
+	}
+	// MkdirAll leaves existing directories alone and is subject to the umask
+	if err := os.Chmod(pluginDir, cfg.DirMode); err != nil {
+		return nil, fmt.Errorf("failed to set plugin directory mode: %w", err)
+	}
+
+	os.Remove(cfg.Path)
+
+	listener, err := sockets.NewUnixSocketWithOpts(cfg.Path,
+		sockets.WithChown(0, gid),
+		sockets.WithChmod(cfg.Mode),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Path, err)
+	}
+	return listener, nil
+}
+
+// listenFDsStart is the first file descriptor systemd passes to an activated
+// service
+const listenFDsStart = 3
+
+// activatedListener returns the unix socket passed by systemd socket
+// activation (LISTEN_FDS), nil without one
+func activatedListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count == 0 {
+		return nil, nil
+	}
+	// Commands started by the plugin must not take the sockets for theirs
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if count > 1 {
+		return nil, fmt.Errorf("expected one activated socket, got %d", count)
+	}
+
+	syscall.CloseOnExec(listenFDsStart)
+	file := os.NewFile(listenFDsStart, "LISTEN_FD_3")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("activated socket is not a stream socket: %w", err)
+	}
+	if _, ok := listener.(*net.UnixListener); !ok {
+		listener.Close()
+		return nil, fmt.Errorf("activated socket is not a unix socket")
+	}
+	return listener, nil
+}
+
+// lookupGroupID resolves a group name or numeric gid; empty means root
+func lookupGroupID(group string) (int, error) {
+	if group == "" {
+		return 0, nil
+	}
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up socket group %s: %w", group, err)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// parseFileMode parses an octal permission string such as "0660"
+func parseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q: %w", value, err)
+	}
+	if mode > 0o777 {
+		return 0, fmt.Errorf("invalid file mode %q: only permission bits are allowed", value)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ovn-org/libovsdb/client"
+)
+
+// DBStartupConfig bounds how long the plugin waits for a database at startup
+type DBStartupConfig struct {
+	Timeout time.Duration
+	Retries int
+}
+
+// connectWithRetry connects a client, retrying with exponential backoff so a
+// database that is momentarily slow or restarting does not abort startup
+func connectWithRetry(ctx context.Context, name string, c client.Client, cfg DBStartupConfig) error {
+	attempt := 0
+	connect := func() error {
+		attempt++
+		attemptCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+		if err := c.Connect(attemptCtx); err != nil {
+			log.Printf("Warning: connecting to %s failed (attempt %d/%d): %v", name, attempt, cfg.Retries+1, err)
+			return err
+		}
+		return nil
+	}
+
+	retry := backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), uint64(cfg.Retries)), ctx)
+	if err := backoff.Retry(connect, retry); err != nil {
+		return fmt.Errorf("failed to connect to %s database: %w", name, err)
+	}
+	return nil
+}
+
+// monitorWithTimeout starts a monitor and waits for its initial dump
+func monitorWithTimeout(ctx context.Context, name string, c client.Client, cfg DBStartupConfig, opts ...client.MonitorOption) error {
+	monitorCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	if _, err := c.Monitor(monitorCtx, c.NewMonitor(opts...)); err != nil {
+		return fmt.Errorf("failed to monitor %s database: %w", name, err)
+	}
+	return nil
+}
+
+// runParallel runs the startup steps concurrently and returns the first error
+func runParallel(steps ...func() error) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(steps))
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, step func() error) {
+			defer wg.Done()
+			errs[i] = step()
+		}(i, step)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
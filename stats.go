@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// EndpointStats are the traffic counters of an endpoint from the container's
+// point of view. OVS counts on the host side of the veth, so the container's
+// transmitted traffic is the interface's rx and the other way around.
+type EndpointStats struct {
+	Port       string `json:"port"`
+	EndpointID string `json:"endpoint_id"`
+	NetworkID  string `json:"network_id"`
+	Container  string `json:"container,omitempty"`
+	Interface  string `json:"interface"`
+	RxBytes    int    `json:"rx_bytes"`
+	RxPackets  int    `json:"rx_packets"`
+	RxDropped  int    `json:"rx_dropped"`
+	TxBytes    int    `json:"tx_bytes"`
+	TxPackets  int    `json:"tx_packets"`
+	TxDropped  int    `json:"tx_dropped"`
+}
+
+// endpointStats reads the statistics column of the OVS interfaces of the
+// endpoints joined on this host
+func (d *OVNDriver) endpointStats() ([]EndpointStats, error) {
+	lsps, err := d.ovn.ListDockerLogicalSwitchPorts()
+	if err != nil {
+		return nil, err
+	}
+	stats := []EndpointStats{}
+	for _, lsp := range lsps {
+		if lsp.ExternalIDs["docker:sandbox"] == "" {
+			continue
+		}
+		// Ports joined on other hosts have no local interface
+		iface, found, err := d.ovs.GetInterfaceByIfaceID(lsp.Name)
+		if err != nil || !found {
+			continue
+		}
+		stats = append(stats, EndpointStats{
+			Port:       lsp.Name,
+			EndpointID: lsp.ExternalIDs["docker:endpoint"],
+			NetworkID:  lsp.ExternalIDs["docker:network"],
+			Container:  lsp.ExternalIDs["docker:container"],
+			Interface:  iface.Name,
+			RxBytes:    iface.Statistics["tx_bytes"],
+			RxPackets:  iface.Statistics["tx_packets"],
+			RxDropped:  iface.Statistics["tx_dropped"],
+			TxBytes:    iface.Statistics["rx_bytes"],
+			TxPackets:  iface.Statistics["rx_packets"],
+			TxDropped:  iface.Statistics["rx_dropped"],
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Port < stats[j].Port })
+	return stats, nil
+}
+
+// handleEndpointStats lists the traffic counters of local endpoints
+func (s *AdminServer) handleEndpointStats(w http.ResponseWriter, r *http.Request) {
+	if s.driver.ovs == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no local OVS in nested mode"})
+		return
+	}
+	stats, err := s.driver.endpointStats()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// endpointStatsCollector reports endpoint traffic counters at scrape time
+type endpointStatsCollector struct {
+	driver  *OVNDriver
+	bytes   *prometheus.Desc
+	packets *prometheus.Desc
+	dropped *prometheus.Desc
+}
+
+func newEndpointStatsCollector(d *OVNDriver) *endpointStatsCollector {
+	labels := []string{"port", "endpoint", "container", "direction"}
+	return &endpointStatsCollector{
+		driver: d,
+		bytes: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "endpoint", "bytes_total"),
+			"Bytes received (rx) and transmitted (tx) by the container of an endpoint.",
+			labels, nil),
+		packets: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "endpoint", "packets_total"),
+			"Packets received (rx) and transmitted (tx) by the container of an endpoint.",
+			labels, nil),
+		dropped: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "endpoint", "dropped_total"),
+			"Packets to (rx) and from (tx) the container of an endpoint dropped by OVS.",
+			labels, nil),
+	}
+}
+
+func (c *endpointStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytes
+	ch <- c.packets
+	ch <- c.dropped
+}
+
+func (c *endpointStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.driver.endpointStats()
+	if err != nil {
+		return
+	}
+	for _, s := range stats {
+		endpoint := s.EndpointID
+		if len(endpoint) > 12 {
+			endpoint = endpoint[:12]
+		}
+		counter := func(desc *prometheus.Desc, value int, direction string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value), s.Port, endpoint, s.Container, direction)
+		}
+		counter(c.bytes, s.RxBytes, "rx")
+		counter(c.bytes, s.TxBytes, "tx")
+		counter(c.packets, s.RxPackets, "rx")
+		counter(c.packets, s.TxPackets, "tx")
+		counter(c.dropped, s.RxDropped, "rx")
+		counter(c.dropped, s.TxDropped, "tx")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// nodeOtherConfigKey marks a node as using a switch
+func nodeOtherConfigKey(node string) string {
+	return "docker:node:" + node
+}
+
+// nodeName identifies this host among the nodes of a switch: its chassis
+// system-id, or its hostname without a local OVS
+func (d *OVNDriver) nodeName() (string, error) {
+	systemID, err := d.systemID()
+	if err != nil || systemID != "" {
+		return systemID, err
+	}
+	return os.Hostname()
+}
+
+// switchNodes returns the nodes using a switch for a network
+func switchNodes(ls *LogicalSwitch, networkID string) []string {
+	nodes := []string{}
+	for key, value := range ls.OtherConfig {
+		if node, ok := strings.CutPrefix(key, "docker:node:"); ok && value == networkID {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// attachNode adds this node to the switch another node created for the same
+// swarm scoped network
+func (d *OVNDriver) attachNode(ls *LogicalSwitch, networkID string, subnet string, gateway string) error {
+	if existingSubnet := ls.OtherConfig["docker:subnet"]; existingSubnet != subnet {
+		return codedErrorf(ErrSubnetConflict, "network %s uses subnet %s on logical switch %s, not %s", networkID[:12], existingSubnet, ls.Name, subnet)
+	}
+	if existingGateway := ls.OtherConfig["docker:gateway"]; existingGateway != gateway {
+		return codedErrorf(ErrSubnetConflict, "network %s uses gateway %s on logical switch %s, not %s", networkID[:12], existingGateway, ls.Name, gateway)
+	}
+	if ls.OtherConfig[subnetOtherConfigKey] == "" {
+		return codedErrorf(ErrInvalidOption, "network %s is used by several nodes, whose IPAM would hand out the same addresses: create it with --ipam-driver=null -o %s=%s", networkID[:12], subnetOption, subnet)
+	}
+	node, err := d.nodeName()
+	if err != nil {
+		return err
+	}
+
+	ops, err := d.ovn.MutateLogicalSwitchOtherConfigOp(ls, ovsdb.MutateOperationInsert, map[string]string{
+		nodeOtherConfigKey(node): networkID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create mutate operation to attach node: %w", err)
+	}
+	results, err := d.ovn.Transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to attach node %s to logical switch %s: %w", node, ls.Name, err)
+	}
+
+	d.logf("Attached node %s to logical switch %s of network %s", node, ls.Name, networkID[:12])
+	return nil
+}
+
+// detachNode removes this node from a switch still used by other nodes
+func (d *OVNDriver) detachNode(ls *LogicalSwitch, networkID string, node string) error {
+	ops, err := d.ovn.DeleteLogicalSwitchOtherConfigKeysOp(ls, []string{nodeOtherConfigKey(node)})
+	if err != nil {
+		return fmt.Errorf("failed to create mutate operation to detach node: %w", err)
+	}
+	results, err := d.ovn.Transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to detach node %s from logical switch %s: %w", node, ls.Name, err)
+	}
+
+	d.logf("Detached node %s from logical switch %s of network %s", node, ls.Name, networkID[:12])
+	return nil
+}
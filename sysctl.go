@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// sysctlOptionPrefix namespaces interface sysctls, set for every endpoint of
+// a network with -o or for one endpoint with --driver-opt
+const sysctlOptionPrefix = "ovn.sysctl."
+
+// sysctlExternalIDPrefix records the sysctls of an endpoint on its port
+const sysctlExternalIDPrefix = "docker:sysctl:"
+
+// sysctlPinTimeout bounds the wait for Docker to move a joined interface into
+// its sandbox
+const sysctlPinTimeout = 30 * time.Second
+
+// interfaceSysctl is a per-interface sysctl under net., %s being the
+// interface name inside the container
+type interfaceSysctl struct {
+	key string
+	max int
+}
+
+var interfaceSysctls = map[string]interfaceSysctl{
+	"accept_ra":    {key: "net.ipv6.conf.%s.accept_ra", max: 2},
+	"rp_filter":    {key: "net.ipv4.conf.%s.rp_filter", max: 2},
+	"arp_notify":   {key: "net.ipv4.conf.%s.arp_notify", max: 1},
+	"disable_ipv6": {key: "net.ipv6.conf.%s.disable_ipv6", max: 1},
+}
+
+// validateSysctl returns the option validator of a supported sysctl
+func validateSysctl(name string) func(value string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > interfaceSysctls[name].max {
+			return fmt.Errorf("expected 0 to %d", interfaceSysctls[name].max)
+		}
+		return nil
+	}
+}
+
+// endpointSysctls merges the sysctls of a network with those recorded on the
+// port of an endpoint; the endpoint's win
+func endpointSysctls(network map[string]string, externalIDs map[string]string) map[string]string {
+	sysctls := map[string]string{}
+	for name, value := range network {
+		sysctls[name] = value
+	}
+	for name := range interfaceSysctls {
+		if value, ok := externalIDs[sysctlExternalIDPrefix+name]; ok {
+			sysctls[name] = value
+		}
+	}
+	return sysctls
+}
+
+// presetSysctls sets sysctls as the sandbox defaults, which the interface
+// inherits when Docker moves it in, then pins them on it
+func (d *OVNDriver) presetSysctls(sandboxKey string, macAddr string, sysctls map[string]string) error {
+	previous := map[string]string{}
+	for name := range sysctls {
+		key := fmt.Sprintf(interfaceSysctls[name].key, "default")
+		out, err := runCommand("nsenter", "--net="+sandboxKey, "sysctl", "-n", key)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		previous[name] = strings.TrimSpace(out)
+	}
+	if err := setSandboxSysctls(sandboxKey, "default", sysctls); err != nil {
+		if err := setSandboxSysctls(sandboxKey, "default", previous); err != nil {
+			d.logf("Warning: failed to restore default sysctls of %s: %v", sandboxKey, err)
+		}
+		return err
+	}
+	go d.background().pinSysctls(sandboxKey, macAddr, sysctls, previous)
+	return nil
+}
+
+// pinSysctls waits for the interface with macAddr to enter the sandbox, sets
+// sysctls on it and restores the previous sandbox defaults
+func (d *OVNDriver) pinSysctls(sandboxKey string, macAddr string, sysctls map[string]string, previous map[string]string) {
+	retry := backoff.NewExponentialBackOff()
+	retry.InitialInterval = 50 * time.Millisecond
+	retry.MaxElapsedTime = sysctlPinTimeout
+
+	var iface string
+	err := backoff.Retry(func() error {
+		var err error
+		iface, err = sandboxInterface(sandboxKey, macAddr)
+		return err
+	}, retry)
+	if err == nil {
+		err = setSandboxSysctls(sandboxKey, iface, sysctls)
+	}
+	if err != nil {
+		d.logf("Warning: failed to set sysctls on the interface with MAC %s: %v", macAddr, err)
+	} else {
+		d.logf("Set sysctls %v on %s", sysctls, iface)
+	}
+	if err := setSandboxSysctls(sandboxKey, "default", previous); err != nil {
+		d.logf("Warning: failed to restore default sysctls of %s: %v", sandboxKey, err)
+	}
+}
+
+// setSandboxSysctls sets sysctls of an interface, or "default", inside a
+// sandbox
+func setSandboxSysctls(sandboxKey string, iface string, sysctls map[string]string) error {
+	for name, value := range sysctls {
+		setting := fmt.Sprintf(interfaceSysctls[name].key, iface) + "=" + value
+		if _, err := runCommand("nsenter", "--net="+sandboxKey, "sysctl", "-w", setting); err != nil {
+			return fmt.Errorf("failed to set %s: %w", setting, err)
+		}
+	}
+	return nil
+}
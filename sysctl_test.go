@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNetworkSysctlsRoundTrip(t *testing.T) {
+	opts, err := parseNetworkOptions(genericOptions(map[string]interface{}{
+		"ovn.sysctl.rp_filter":  "2",
+		"ovn.sysctl.arp_notify": "1",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := networkOptionsFromSwitch(&LogicalSwitch{OtherConfig: opts.otherConfig()})
+	if want := map[string]string{"rp_filter": "2", "arp_notify": "1"}; !reflect.DeepEqual(restored.Sysctls, want) {
+		t.Errorf("sysctls read back from the switch = %v, want %v", restored.Sysctls, want)
+	}
+
+	for key, value := range map[string]string{
+		"ovn.sysctl.rp_filter":  "3",
+		"ovn.sysctl.accept_ra":  "yes",
+		"ovn.sysctl.forwarding": "1",
+	} {
+		if _, err := parseNetworkOptions(genericOptions(map[string]interface{}{key: value})); err == nil {
+			t.Errorf("parseNetworkOptions accepted %s=%s", key, value)
+		}
+	}
+}
+
+// genericOptions wraps -o options the way Docker passes them to CreateNetwork
+func genericOptions(options map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"com.docker.network.generic": options}
+}
+
+func TestEndpointSysctls(t *testing.T) {
+	network := map[string]string{"rp_filter": "2", "arp_notify": "1"}
+
+	sysctls := endpointSysctls(network, map[string]string{
+		"docker:endpoint":             "0123456789ab",
+		"docker:sysctl:rp_filter":     "0",
+		"docker:sysctl:forwarding":    "1",
+		"ovn.sysctl.disable_ipv6":     "1",
+		"docker:sysctl:disable_ipv6x": "1",
+	})
+	if want := map[string]string{"rp_filter": "0", "arp_notify": "1"}; !reflect.DeepEqual(sysctls, want) {
+		t.Errorf("endpointSysctls() = %v, want the endpoint to override the network: %v", sysctls, want)
+	}
+	if network["rp_filter"] != "2" {
+		t.Error("endpointSysctls() modified the network sysctls")
+	}
+}
+
+func TestEndpointSysctlOptions(t *testing.T) {
+	if err := validateEndpointOptions(map[string]interface{}{"ovn.sysctl.accept_ra": "0"}); err != nil {
+		t.Errorf("validateEndpointOptions() = %v", err)
+	}
+	for key, value := range map[string]string{
+		"ovn.sysctl.disable_ipv6": "2",
+		"ovn.sysctl.forwarding":   "1",
+	} {
+		var driverErr *DriverError
+		err := validateEndpointOptions(map[string]interface{}{key: value})
+		if !errors.As(err, &driverErr) || driverErr.Code != ErrInvalidOption {
+			t.Errorf("validateEndpointOptions(%s=%s) = %v, want %s", key, value, err, ErrInvalidOption)
+		}
+	}
+}
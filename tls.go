@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ovn-org/libovsdb/client"
+)
+
+// TLSFiles holds the PEM file paths used to authenticate an OVSDB ssl: connection
+type TLSFiles struct {
+	CACert string
+	Cert   string
+	Key    string
+}
+
+// Enabled reports whether any TLS material was configured
+func (f TLSFiles) Enabled() bool {
+	return f.CACert != "" || f.Cert != "" || f.Key != ""
+}
+
+func (f TLSFiles) paths() []string {
+	return []string{f.CACert, f.Cert, f.Key}
+}
+
+// isSSLEndpoint reports whether an OVSDB connection string uses the ssl: scheme
+func isSSLEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "ssl:")
+}
+
+// CertReloader keeps the TLS material for one OVSDB client and reloads it when
+// the files on disk change
+type CertReloader struct {
+	files TLSFiles
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewCertReloader loads the initial TLS material
+func NewCertReloader(files TLSFiles) (*CertReloader, error) {
+	if files.CACert == "" || files.Cert == "" || files.Key == "" {
+		return nil, fmt.Errorf("ssl connections require CA certificate, certificate and private key paths")
+	}
+
+	r := &CertReloader{files: files}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) reload() error {
+	modTimes, err := r.statFiles()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.files.Cert, r.files.Key)
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(r.files.CACert)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in CA file %s", r.files.CACert)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.roots = roots
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *CertReloader) statFiles() (map[string]time.Time, error) {
+	modTimes := map[string]time.Time{}
+	for _, path := range r.files.paths() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		modTimes[path] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (r *CertReloader) changed() bool {
+	modTimes, err := r.statFiles()
+	if err != nil {
+		// Rotation tools often replace files non-atomically; try again next tick
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for path, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSConfig returns a tls.Config that always presents the current material
+// and, like ovsdb-server, verifies the peer against the CA only
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.cert, nil
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			r.mu.RLock()
+			roots := r.roots
+			r.mu.RUnlock()
+			return verifyPeerChain(rawCerts, roots)
+		},
+	}
+}
+
+// Watch polls the TLS files and calls onReload after new material was loaded.
+// Established sessions keep the old certificate, so callers are expected to
+// drop the connection and let the client reconnect.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration, onReload func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Printf("Warning: failed to reload TLS material from %s: %v", r.files.Cert, err)
+				continue
+			}
+			log.Printf("Reloaded TLS material from %s", r.files.Cert)
+			onReload()
+		}
+	}
+}
+
+// verifyPeerChain checks the presented certificate chain against the CA pool
+func verifyPeerChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("peer presented no certificates")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse peer certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("failed to verify peer certificate: %w", err)
+	}
+	return nil
+}
+
+// tlsClientOptions returns the libovsdb options for an ssl: endpoint together
+// with its certificate reloader. Both are nil for plain endpoints.
+func tlsClientOptions(endpoint string, files TLSFiles) ([]client.Option, *CertReloader, error) {
+	if !isSSLEndpoint(endpoint) {
+		if files.Enabled() {
+			log.Printf("Warning: TLS files configured but endpoint %s is not ssl:, ignoring them", endpoint)
+		}
+		return nil, nil, nil
+	}
+
+	reloader, err := NewCertReloader(files)
+	if err != nil {
+		return nil, nil, fmt.Errorf("endpoint %s: %w", endpoint, err)
+	}
+	// Reconnecting is how rotated certificates get picked up
+	return []client.Option{
+		client.WithTLSConfig(reloader.TLSConfig()),
+		client.WithReconnect(10*time.Second, newReconnectBackoff()),
+	}, reloader, nil
+}
+
+// newReconnectBackoff returns the backoff of automatic reconnects. libovsdb
+// panics once the backoff gives up, so it never stops retrying.
+func newReconnectBackoff() backoff.BackOff {
+	reconnectBackoff := backoff.NewExponentialBackOff()
+	reconnectBackoff.MaxElapsedTime = 0
+	return reconnectBackoff
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// traceTimeout bounds one ovn-trace run
+const traceTimeout = 30 * time.Second
+
+// Tracer runs ovn-trace against the OVN southbound database to show how a
+// packet from an endpoint is handled by the logical pipeline
+type Tracer struct {
+	// db is the SB remote, empty for ovn-trace's default
+	db  string
+	tls TLSFiles
+}
+
+func NewTracer(db string, tls TLSFiles) *Tracer {
+	return &Tracer{db: db, tls: tls}
+}
+
+// TraceRequest describes the packet to trace. Endpoint is an endpoint ID or
+// its 12 character prefix, a logical switch port or a container name.
+type TraceRequest struct {
+	Endpoint    string `json:"endpoint"`
+	Destination string `json:"destination"`
+	// Protocol is tcp, udp or icmp; tcp when Port is set, icmp otherwise
+	Protocol string `json:"protocol,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	// DestinationMAC is needed for destinations off the network, usually
+	// the MAC of the gateway
+	DestinationMAC string `json:"destination_mac,omitempty"`
+	// Format is detailed, summary or minimal
+	Format string `json:"format,omitempty"`
+}
+
+// TraceResult is the microflow traced and what ovn-trace reported
+type TraceResult struct {
+	Port      string `json:"logical_switch_port"`
+	Datapath  string `json:"datapath"`
+	Microflow string `json:"microflow"`
+	Output    string `json:"output"`
+}
+
+// traceMicroflow builds the microflow of a request from the endpoint's port
+func (d *OVNDriver) traceMicroflow(req TraceRequest) (string, string, string, error) {
+	dst := net.ParseIP(req.Destination).To4()
+	if dst == nil {
+		return "", "", "", fmt.Errorf("destination %q is not an IPv4 address", req.Destination)
+	}
+	protocol := req.Protocol
+	if protocol == "" {
+		protocol = "icmp"
+		if req.Port != 0 {
+			protocol = "tcp"
+		}
+	}
+	if req.Port < 0 || req.Port > 65535 || (protocol == "icmp" && req.Port != 0) {
+		return "", "", "", fmt.Errorf("invalid port %d for %s", req.Port, protocol)
+	}
+
+	lsps, err := d.ovn.ListDockerLogicalSwitchPorts()
+	if err != nil {
+		return "", "", "", err
+	}
+	var src *LogicalSwitchPort
+	for i, lsp := range lsps {
+		endpointID := lsp.ExternalIDs["docker:endpoint"]
+		if lsp.Name == req.Endpoint || endpointID == req.Endpoint ||
+			(len(req.Endpoint) >= 12 && strings.HasPrefix(endpointID, req.Endpoint)) ||
+			lsp.ExternalIDs["docker:container"] == req.Endpoint {
+			src = &lsps[i]
+			break
+		}
+	}
+	if src == nil {
+		return "", "", "", fmt.Errorf("no endpoint %q", req.Endpoint)
+	}
+	srcMAC, srcIP := src.ExternalIDs["docker:mac"], src.ExternalIDs["docker:ip"]
+	if srcMAC == "" || srcIP == "" {
+		return "", "", "", fmt.Errorf("endpoint port %s has no address yet", src.Name)
+	}
+	networkID := src.ExternalIDs["docker:network"]
+	ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(networkID)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !found {
+		return "", "", "", codedErrorf(ErrNetworkNotFound, "logical switch for network %s not found", networkID[:12])
+	}
+
+	dstMAC := req.DestinationMAC
+	if dstMAC == "" {
+		for _, lsp := range lsps {
+			if lsp.ExternalIDs["docker:ip"] == dst.String() && lsp.ExternalIDs["docker:network"] == networkID {
+				dstMAC = lsp.ExternalIDs["docker:mac"]
+			}
+		}
+	}
+	if dstMAC == "" {
+		return "", "", "", fmt.Errorf("%s is not on network %s: set destination_mac, e.g. to the gateway's MAC", dst, networkID[:12])
+	}
+	if _, err := net.ParseMAC(dstMAC); err != nil {
+		return "", "", "", fmt.Errorf("invalid destination_mac: %w", err)
+	}
+
+	flow := fmt.Sprintf("inport == %q && eth.src == %s && eth.dst == %s && ip4.src == %s && ip4.dst == %s && ip.ttl == 64",
+		src.Name, srcMAC, dstMAC, srcIP, dst)
+	switch protocol {
+	case "tcp", "udp":
+		flow += fmt.Sprintf(" && %s && %s.src == 49152", protocol, protocol)
+		if req.Port != 0 {
+			flow += fmt.Sprintf(" && %s.dst == %d", protocol, req.Port)
+		}
+	case "icmp":
+		flow += " && icmp4 && icmp4.type == 8 && icmp4.code == 0"
+	default:
+		return "", "", "", fmt.Errorf("invalid protocol %q: expected tcp, udp or icmp", protocol)
+	}
+	return src.Name, ls.Name, flow, nil
+}
+
+// Trace runs ovn-trace for a request
+func (t *Tracer) Trace(ctx context.Context, d *OVNDriver, req TraceRequest) (TraceResult, error) {
+	format := req.Format
+	if format == "" {
+		format = "detailed"
+	}
+	if format != "detailed" && format != "summary" && format != "minimal" {
+		return TraceResult{}, fmt.Errorf("invalid format %q: expected detailed, summary or minimal", format)
+	}
+	port, datapath, flow, err := d.traceMicroflow(req)
+	if err != nil {
+		return TraceResult{}, err
+	}
+
+	args := []string{"--" + format}
+	if t.db != "" {
+		args = append(args, "--db", t.db)
+	}
+	if t.tls.Key != "" {
+		args = append(args, "--private-key", t.tls.Key, "--certificate", t.tls.Cert, "--ca-cert", t.tls.CACert)
+	}
+	args = append(args, datapath, flow)
+
+	ctx, cancel := context.WithTimeout(ctx, traceTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ovn-trace", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return TraceResult{}, fmt.Errorf("ovn-trace: %w: %s", err, msg)
+		}
+		return TraceResult{}, fmt.Errorf("ovn-trace: %w", err)
+	}
+	return TraceResult{Port: port, Datapath: datapath, Microflow: flow, Output: stdout.String()}, nil
+}
+
+// handleTrace traces the packet described by the POSTed TraceRequest
+func (s *AdminServer) handleTrace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	var req TraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	result, err := s.tracer.Trace(r.Context(), s.driver, req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// tunnelKeyOption requests the tunnel key (the Geneve VNI of the datapath)
+// of a network's switch, so it stays the same when the switch is recreated
+const tunnelKeyOption = "ovn.tunnel_key"
+
+// maxTunnelKey is the largest datapath key with Geneve; with VXLAN
+// ovn-northd only honors keys up to 4095
+const maxTunnelKey = 1<<24 - 1
+
+// requestedTunnelKeyOtherConfigKey is read by ovn-northd
+const requestedTunnelKeyOtherConfigKey = "requested-tnl-key"
+
+func validateTunnelKey(value string) error {
+	key, err := strconv.Atoi(value)
+	if err != nil || key < 1 || key > maxTunnelKey {
+		return fmt.Errorf("expected an integer from 1 to %d", maxTunnelKey)
+	}
+	return nil
+}
+
+// LogicalSwitchesByTunnelKey returns the names of the switches requesting a
+// tunnel key. It queries the database rather than the cache, which only holds
+// the driver's switches, since any switch may conflict.
+func (o *OVNAPI) LogicalSwitchesByTunnelKey(key string) ([]string, error) {
+	otherConfig, err := ovsdb.NewOvsMap(map[string]string{requestedTunnelKeyOtherConfigKey: key})
+	if err != nil {
+		return nil, err
+	}
+	results, err := o.Transact(ovsdb.Operation{
+		Op:      ovsdb.OperationSelect,
+		Table:   "Logical_Switch",
+		Where:   []ovsdb.Condition{ovsdb.NewCondition("other_config", ovsdb.ConditionIncludes, otherConfig)},
+		Columns: []string{"name"},
+	})
+	if err := transactError(err, results); err != nil {
+		return nil, fmt.Errorf("failed to look up switches with tunnel key %s: %w", key, err)
+	}
+	names := []string{}
+	for _, row := range results[0].Rows {
+		if name, ok := row["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// checkTunnelKeyFree rejects a tunnel key another switch already requested;
+// ovn-northd would silently assign a different one to one of them
+func (d *OVNDriver) checkTunnelKeyFree(key string) error {
+	names, err := d.ovn.LogicalSwitchesByTunnelKey(key)
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return codedErrorf(ErrTunnelKeyConflict, "tunnel key %s already requested by logical switch %s", key, names[0])
+	}
+	return nil
+}
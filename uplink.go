@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ovn-org/libovsdb/model"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// Bond settings OVS accepts on a port with several interfaces
+var (
+	bondModes = []string{"balance-tcp", "balance-slb", "active-backup"}
+	lacpModes = []string{"active", "passive", "off"}
+)
+
+// ProviderUplink is the NIC, or bond of NICs, connecting a provider bridge
+// to the physical network behind localnet networks
+type ProviderUplink struct {
+	Bridge   string
+	NICs     []string
+	BondMode string
+	LACP     string
+	// Trunks are the VLANs the uplink carries, all of them when empty
+	Trunks []int
+}
+
+// parseProviderUplink parses "<bridge>:<nic>[,<nic>...]" and the bond and
+// trunk settings; nil when value is empty
+func parseProviderUplink(value, bondMode, lacp, trunks string) (*ProviderUplink, error) {
+	if value == "" {
+		return nil, nil
+	}
+	bridge, nics, ok := strings.Cut(value, ":")
+	if !ok || validateName(bridge) != nil {
+		return nil, fmt.Errorf("expected <bridge>:<nic>[,<nic>...], got %q", value)
+	}
+	u := &ProviderUplink{Bridge: bridge}
+	for _, nic := range strings.Split(nics, ",") {
+		nic = strings.TrimSpace(nic)
+		if validateName(nic) != nil || slices.Contains(u.NICs, nic) {
+			return nil, fmt.Errorf("invalid or repeated interface %q", nic)
+		}
+		u.NICs = append(u.NICs, nic)
+	}
+	if len(u.NICs) > 1 {
+		if !slices.Contains(bondModes, bondMode) {
+			return nil, fmt.Errorf("invalid bond mode %q: expected %s", bondMode, strings.Join(bondModes, ", "))
+		}
+		if !slices.Contains(lacpModes, lacp) {
+			return nil, fmt.Errorf("invalid LACP mode %q: expected %s", lacp, strings.Join(lacpModes, ", "))
+		}
+		if bondMode == "balance-tcp" && lacp == "off" {
+			return nil, fmt.Errorf("bond mode balance-tcp needs LACP")
+		}
+		u.BondMode = bondMode
+		u.LACP = lacp
+	}
+	for _, item := range splitOptionList(trunks) {
+		first, last, isRange := strings.Cut(item, "-")
+		if !isRange {
+			last = first
+		}
+		from, err1 := strconv.Atoi(first)
+		to, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil || from < 0 || to > 4095 || from > to {
+			return nil, fmt.Errorf("invalid VLAN %q: expected IDs or ranges from 0 to 4095", item)
+		}
+		for vlan := from; vlan <= to; vlan++ {
+			if !slices.Contains(u.Trunks, vlan) {
+				u.Trunks = append(u.Trunks, vlan)
+			}
+		}
+	}
+	sort.Ints(u.Trunks)
+	return u, nil
+}
+
+// portName is the OVS port of the uplink: the NIC itself, or a bond named
+// after the bridge
+func (u *ProviderUplink) portName() string {
+	if len(u.NICs) == 1 {
+		return u.NICs[0]
+	}
+	return u.Bridge + "-bond"
+}
+
+// EnsureUplink creates the provider bridge and its uplink port when missing,
+// and brings the bond and trunk settings of an existing port in line. A port
+// with other interfaces is an error rather than rebuilt under running traffic.
+func (o *OVSAPI) EnsureUplink(u *ProviderUplink) error {
+	for _, nic := range u.NICs {
+		if _, err := net.InterfaceByName(nic); err != nil {
+			return fmt.Errorf("uplink interface %s does not exist on this host", nic)
+		}
+	}
+
+	bridge, bridgeFound, err := o.findBridge(u.Bridge)
+	if err != nil {
+		return err
+	}
+	portList := []Port{}
+	if err := o.client.Where(&Port{Name: u.portName()}).List(o.ctx, &portList); err != nil {
+		return fmt.Errorf("failed to list ports: %w", err)
+	}
+	if len(portList) > 0 {
+		if !bridgeFound || !slices.Contains(bridge.Ports, portList[0].UUID) {
+			return fmt.Errorf("uplink port %s exists on another bridge than %s", u.portName(), u.Bridge)
+		}
+		return o.updateUplinkPort(u, &portList[0])
+	}
+	for _, nic := range u.NICs {
+		ifaceList := []Interface{}
+		if err := o.client.Where(&Interface{Name: nic}).List(o.ctx, &ifaceList); err != nil {
+			return fmt.Errorf("failed to list interfaces: %w", err)
+		}
+		if len(ifaceList) > 0 {
+			return fmt.Errorf("uplink interface %s is already attached to another OVS port", nic)
+		}
+	}
+
+	ops := []ovsdb.Operation{}
+	port := &Port{UUID: newNamedUUID("port"), Name: u.portName(), Trunks: u.Trunks}
+	if u.BondMode != "" {
+		port.BondMode = &u.BondMode
+		port.LACP = &u.LACP
+	}
+	for _, nic := range u.NICs {
+		iface := &Interface{
+			UUID: newNamedUUID("iface"),
+			Name: nic,
+			// Lets ovn-controller shape localnet ports with qos_max_rate here
+			ExternalIDs: map[string]string{"ovn-egress-iface": "true"},
+		}
+		ifaceOps, err := o.client.Create(iface)
+		if err != nil {
+			return fmt.Errorf("failed to create interface operation: %w", err)
+		}
+		ops = append(ops, ifaceOps...)
+		port.Interfaces = append(port.Interfaces, iface.UUID)
+	}
+	portOps, err := o.client.Create(port)
+	if err != nil {
+		return fmt.Errorf("failed to create port operation: %w", err)
+	}
+	ops = append(ops, portOps...)
+
+	if bridgeFound {
+		bridgeOps, err := o.client.Where(bridge).Mutate(bridge, model.Mutation{
+			Field:   &bridge.Ports,
+			Mutator: ovsdb.MutateOperationInsert,
+			Value:   []string{port.UUID},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create mutate operation for bridge: %w", err)
+		}
+		ops = append(ops, bridgeOps...)
+	} else {
+		bridgeOps, err := o.createBridgeOps(u.Bridge, port.UUID)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, bridgeOps...)
+	}
+
+	results, err := o.transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to add uplink %s to %s: %w", u.portName(), u.Bridge, err)
+	}
+	if !bridgeFound {
+		log.Printf("Created provider bridge %s", u.Bridge)
+	}
+	log.Printf("Added uplink %s (%s) to %s", u.portName(), strings.Join(u.NICs, ", "), u.Bridge)
+	return nil
+}
+
+// createBridgeOps creates a bridge with its internal port, as ovs-vsctl
+// add-br does, plus the given ports
+func (o *OVSAPI) createBridgeOps(name string, portUUIDs ...string) ([]ovsdb.Operation, error) {
+	ovsList := []OpenvSwitch{}
+	if err := o.client.List(o.ctx, &ovsList); err != nil {
+		return nil, fmt.Errorf("failed to list Open_vSwitch table: %w", err)
+	}
+	if len(ovsList) == 0 {
+		return nil, fmt.Errorf("no Open_vSwitch row")
+	}
+
+	iface := &Interface{UUID: newNamedUUID("iface"), Name: name, Type: "internal"}
+	port := &Port{UUID: newNamedUUID("port"), Name: name, Interfaces: []string{iface.UUID}}
+	bridge := &Bridge{UUID: newNamedUUID("bridge"), Name: name, Ports: append([]string{port.UUID}, portUUIDs...)}
+	ops := []ovsdb.Operation{}
+	for _, m := range []model.Model{iface, port, bridge} {
+		createOps, err := o.client.Create(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create bridge operation: %w", err)
+		}
+		ops = append(ops, createOps...)
+	}
+	ovs := &ovsList[0]
+	mutateOps, err := o.client.Where(ovs).Mutate(ovs, model.Mutation{
+		Field:   &ovs.Bridges,
+		Mutator: ovsdb.MutateOperationInsert,
+		Value:   []string{bridge.UUID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mutate operation for Open_vSwitch: %w", err)
+	}
+	return append(ops, mutateOps...), nil
+}
+
+// updateUplinkPort checks the interfaces of an existing uplink port and sets
+// its bond and trunk settings
+func (o *OVSAPI) updateUplinkPort(u *ProviderUplink, port *Port) error {
+	members, err := o.portInterfaces(port)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for _, iface := range members {
+		names = append(names, iface.Name)
+	}
+	sort.Strings(names)
+	wanted := slices.Clone(u.NICs)
+	sort.Strings(wanted)
+	if !slices.Equal(names, wanted) {
+		return fmt.Errorf("uplink port %s has interfaces %s, not %s; fix or remove it", port.Name, strings.Join(names, ", "), strings.Join(wanted, ", "))
+	}
+
+	updated := &Port{UUID: port.UUID, Trunks: u.Trunks}
+	if u.BondMode != "" {
+		updated.BondMode = &u.BondMode
+		updated.LACP = &u.LACP
+	}
+	if optionalString(port.BondMode) == u.BondMode && optionalString(port.LACP) == u.LACP && slices.Equal(port.Trunks, u.Trunks) {
+		return nil
+	}
+	ops, err := o.client.Where(updated).Update(updated, &updated.BondMode, &updated.LACP, &updated.Trunks)
+	if err != nil {
+		return fmt.Errorf("failed to create update operation for port %s: %w", port.Name, err)
+	}
+	results, err := o.transact(ops...)
+	if err := transactError(err, results); err != nil {
+		return fmt.Errorf("failed to configure uplink %s: %w", port.Name, err)
+	}
+	log.Printf("Updated bond and trunk settings of uplink %s", port.Name)
+	return nil
+}
+
+// portInterfaces returns the interfaces of a port from the cache
+func (o *OVSAPI) portInterfaces(port *Port) ([]Interface, error) {
+	ifaces := []Interface{}
+	for _, uuid := range port.Interfaces {
+		iface := Interface{UUID: uuid}
+		if err := o.client.Get(o.ctx, &iface); err != nil {
+			return nil, fmt.Errorf("failed to get interface %s of port %s: %w", uuid, port.Name, err)
+		}
+		ifaces = append(ifaces, iface)
+	}
+	return ifaces, nil
+}
+
+func optionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// UplinkMember is the state of one NIC of the uplink
+type UplinkMember struct {
+	Interface string `json:"interface"`
+	// Link is the kernel operstate: up, down, or missing without the NIC
+	Link string `json:"link"`
+	// LACP is whether the partner answers LACP, for bonds with LACP only
+	LACP *bool `json:"lacp_current,omitempty"`
+}
+
+// UplinkStatus is the state of the provider uplink
+type UplinkStatus struct {
+	Bridge  string         `json:"bridge"`
+	Port    string         `json:"port"`
+	Up      bool           `json:"up"`
+	Members []UplinkMember `json:"members"`
+}
+
+// uplinkStatus reports whether the uplink can carry traffic: at least one
+// NIC with link, which with LACP also negotiated with the switch
+func (o *OVSAPI) uplinkStatus(u *ProviderUplink) UplinkStatus {
+	status := UplinkStatus{Bridge: u.Bridge, Port: u.portName(), Members: []UplinkMember{}}
+	for _, nic := range u.NICs {
+		member := UplinkMember{Interface: nic, Link: "missing"}
+		if state, err := os.ReadFile("/sys/class/net/" + nic + "/operstate"); err == nil {
+			member.Link = strings.TrimSpace(string(state))
+		}
+		ifaceList := []Interface{}
+		if err := o.client.Where(&Interface{Name: nic}).List(o.ctx, &ifaceList); err == nil && len(ifaceList) > 0 && u.LACP != "" && u.LACP != "off" {
+			member.LACP = ifaceList[0].LACPCurrent
+		}
+		if member.Link == "up" && (member.LACP == nil || *member.LACP) {
+			status.Up = true
+		}
+		status.Members = append(status.Members, member)
+	}
+	return status
+}
+
+// checkUplinkUp fails the creation of a localnet network on the provider
+// bridge while no NIC of its uplink is up
+func (d *OVNDriver) checkUplinkUp(bridge string) error {
+	if d.uplink == nil || d.uplink.Bridge != bridge {
+		return nil
+	}
+	status := d.ovs.uplinkStatus(d.uplink)
+	if status.Up {
+		return nil
+	}
+	states := []string{}
+	for _, member := range status.Members {
+		state := member.Interface + " " + member.Link
+		if member.LACP != nil && !*member.LACP {
+			state += " (LACP not negotiated)"
+		}
+		states = append(states, state)
+	}
+	return codedErrorf(ErrUplinkDown, "uplink %s of bridge %s is down: %s", status.Port, bridge, strings.Join(states, ", "))
+}
+
+// configureUplink creates or checks the provider uplink at startup
+func configureUplink(ovs *OVSAPI, u *ProviderUplink) error {
+	if ovs == nil {
+		return fmt.Errorf("the provider uplink needs a local OVS, it is not available in nested mode")
+	}
+	if err := ovs.EnsureUplink(u); err != nil {
+		return err
+	}
+	mappings, err := ovs.GetBridgeMappings()
+	if err != nil {
+		return err
+	}
+	mapped := false
+	for _, bridge := range mappings {
+		mapped = mapped || bridge == u.Bridge
+	}
+	if !mapped {
+		log.Printf("Warning: bridge %s is not in external_ids:ovn-bridge-mappings, localnet networks cannot use it", u.Bridge)
+	}
+	return nil
+}
+
+// handleUplink reports the state of the provider uplink
+func (s *AdminServer) handleUplink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	if s.driver.uplink == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no provider uplink is configured"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.driver.ovs.uplinkStatus(s.driver.uplink))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+)
+
+// Veth pairs of the pool are named vethPoolPrefix and 10 hex characters, so
+// the container end with containerVethSuffix still fits IFNAMSIZ
+const (
+	vethPoolPrefix = "ovp"
+	// vethPoolExternalIDKey marks pooled interfaces in OVS; they have no
+	// iface-id until a Join claims them
+	vethPoolExternalIDKey = "docker:pool"
+	// vethExternalIDKey records on a logical switch port the host veth of a
+	// Join that took a pooled pair instead of the name from the template
+	vethExternalIDKey = "docker:veth"
+)
+
+// VethPool keeps veth pairs created ahead of Join, plugged into the
+// integration bridge but down and without an iface-id
+type VethPool struct {
+	ovs    *OVSAPI
+	bridge string
+	size   int
+	refill chan struct{}
+	mu     sync.Mutex
+	ready  []string
+}
+
+// NewVethPool adopts the pooled pairs a previous run left behind, removing
+// those beyond size, and starts filling the pool. With size 0 it only removes
+// leftovers and returns nil.
+func NewVethPool(ovs *OVSAPI, bridge string, size int) *VethPool {
+	p := &VethPool{ovs: ovs, bridge: bridge, size: size, refill: make(chan struct{}, 1)}
+	ifaces, err := ovs.ListOwnedInterfaces()
+	if err != nil {
+		log.Printf("Warning: failed to list pooled veths: %v", err)
+	}
+	for _, iface := range ifaces {
+		if iface.ExternalIDs[vethPoolExternalIDKey] != "true" || iface.ExternalIDs["iface-id"] != "" {
+			continue
+		}
+		if _, err := net.InterfaceByName(iface.Name); err == nil && len(p.ready) < size {
+			p.ready = append(p.ready, iface.Name)
+			continue
+		}
+		p.remove(iface.Name)
+	}
+	if size <= 0 {
+		return nil
+	}
+	log.Printf("Adopted %d pooled veths, filling the pool to %d", len(p.ready), size)
+	go p.filler()
+	p.refill <- struct{}{}
+	return p
+}
+
+// Take returns a pooled veth plugged into bridge, if any is ready
+func (p *VethPool) Take(bridge string) (string, bool) {
+	if p == nil || bridge != p.bridge {
+		return "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+	if len(p.ready) == 0 {
+		return "", false
+	}
+	name := p.ready[len(p.ready)-1]
+	p.ready = p.ready[:len(p.ready)-1]
+	return name, true
+}
+
+func (p *VethPool) filler() {
+	for range p.refill {
+		for {
+			p.mu.Lock()
+			missing := p.size - len(p.ready)
+			p.mu.Unlock()
+			if missing <= 0 {
+				break
+			}
+			name, err := p.create()
+			if err != nil {
+				log.Printf("Warning: failed to fill veth pool: %v", err)
+				break
+			}
+			p.mu.Lock()
+			p.ready = append(p.ready, name)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// create adds a veth pair to the bridge, both ends down
+func (p *VethPool) create() (string, error) {
+	suffix := make([]byte, 5)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	name := vethPoolPrefix + hex.EncodeToString(suffix)
+	if _, err := runCommand("ip", "link", "add", name,
+		"type", "veth", "peer", "name", name+containerVethSuffix); err != nil {
+		return "", fmt.Errorf("failed to create veth pair: %w", err)
+	}
+	err := p.ovs.addPort(p.bridge, name, &Interface{
+		Name:        name,
+		ExternalIDs: withOwnerTag(map[string]string{vethPoolExternalIDKey: "true"}),
+	})
+	if err != nil {
+		cleanupCommand("ip", "link", "del", name)
+		return "", fmt.Errorf("failed to add pooled veth to OVS: %w", err)
+	}
+	cleanupCommand("ethtool", "-K", name, "tx", "off")
+	cleanupCommand("ethtool", "-K", name+containerVethSuffix, "tx", "off")
+	return name, nil
+}
+
+// remove deletes a pooled veth and its OVS port
+func (p *VethPool) remove(name string) {
+	if err := p.ovs.RemovePort(p.bridge, name); err != nil {
+		log.Printf("Warning: failed to remove pooled veth %s from OVS: %v", name, err)
+	}
+	cleanupCommand("ip", "link", "del", name)
+}
+
+// claimPooledVeth binds a pooled veth to the logical switch port of an
+// endpoint. A pair failing to be claimed is deleted by the caller rather than
+// returned to the pool.
+func (d *OVNDriver) claimPooledVeth(name string, macAddr string, binding map[string]string) error {
+	if _, err := runCommand("ip", "link", "set", name+containerVethSuffix, "address", macAddr); err != nil {
+		return fmt.Errorf("failed to set MAC address: %w", err)
+	}
+	iface, found, err := d.ovs.GetInterface(name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("pooled veth %s is not in OVS", name)
+	}
+	if err := d.ovs.SetInterfaceBinding(iface, binding); err != nil {
+		return err
+	}
+	if _, err := runCommand("ip", "link", "set", name, "up"); err != nil {
+		return fmt.Errorf("failed to bring up host veth: %w", err)
+	}
+	d.logf("Claimed pooled veth %s for %s", name, binding["iface-id"])
+	return nil
+}
+
+// endpointVeth returns the host veth of a joined endpoint: a claimed pooled
+// pair or the name from the template
+func (d *OVNDriver) endpointVeth(lsp *LogicalSwitchPort) string {
+	if name := lsp.ExternalIDs[vethExternalIDKey]; name != "" {
+		return name
+	}
+	return d.vethName(lsp.ExternalIDs["docker:endpoint"], lsp.ExternalIDs["docker:network"])
+}
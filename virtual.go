@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// virtualIPsOption makes an endpoint one of the parents of a virtual IP: OVN
+// binds the virtual port of the IP to whichever parent last announced it
+// (keepalived style failover)
+const virtualIPsOption = "ovn.virtual_ips"
+
+// parseVirtualIPs parses comma separated IPv4 addresses
+func parseVirtualIPs(value string) ([]string, error) {
+	vips := []string{}
+	for _, vip := range splitOptionList(value) {
+		if net.ParseIP(vip).To4() == nil {
+			return nil, fmt.Errorf("invalid IPv4 address %q", vip)
+		}
+		vips = append(vips, vip)
+	}
+	return vips, nil
+}
+
+// virtualPortName returns the name of the virtual port of a VIP on a switch
+func virtualPortName(switchName string, vip string) string {
+	return fmt.Sprintf("vip-%s-%s", vip, switchName)
+}
+
+// virtualPortMAC derives the MAC of a virtual port from its IP
+func virtualPortMAC(vip string) string {
+	ip := net.ParseIP(vip).To4()
+	return fmt.Sprintf("0a:58:%02x:%02x:%02x:%02x", ip[0], ip[1], ip[2], ip[3])
+}
+
+// virtualParents returns the parent ports recorded on a virtual port
+func virtualParents(lsp *LogicalSwitchPort) []string {
+	if parents := lsp.ExternalIDs["docker:virtual_parents"]; parents != "" {
+		return strings.Split(parents, ",")
+	}
+	return nil
+}
+
+// setVirtualParentsOps rewrites the parents of an existing virtual port. The
+// options column is not monitored, so it is written whole from external_ids.
+func (d *OVNDriver) setVirtualParentsOps(lsp *LogicalSwitchPort, vip string, parents []string) ([]ovsdb.Operation, error) {
+	if err := checkPortOwned(lsp); err != nil {
+		return nil, err
+	}
+	updated := *lsp
+	updated.Options = map[string]string{
+		"virtual-ip":      vip,
+		"virtual-parents": strings.Join(parents, ","),
+	}
+	updated.ExternalIDs = withOwnerTag(lsp.ExternalIDs)
+	updated.ExternalIDs["docker:virtual_parents"] = strings.Join(parents, ",")
+	return d.ovn.client.Where(&updated).Update(&updated, &updated.Options, &updated.ExternalIDs)
+}
+
+// addVirtualParentOps adds a port as parent of the virtual ports of vips,
+// creating the virtual ports that do not exist yet
+func (d *OVNDriver) addVirtualParentOps(ls *LogicalSwitch, networkID string, portName string, vips []string) ([]ovsdb.Operation, error) {
+	ops := []ovsdb.Operation{}
+	for _, vip := range vips {
+		name := virtualPortName(ls.Name, vip)
+		existing, found, err := d.ovn.GetLogicalSwitchPort(name)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			parents := virtualParents(existing)
+			for _, parent := range parents {
+				if parent == portName {
+					return nil, fmt.Errorf("port %s is already a parent of virtual IP %s", portName, vip)
+				}
+			}
+			updateOps, err := d.setVirtualParentsOps(existing, vip, append(parents, portName))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create update operation for virtual port %s: %w", name, err)
+			}
+			ops = append(ops, updateOps...)
+			continue
+		}
+
+		vport := &LogicalSwitchPort{
+			UUID:      newNamedUUID("vip"),
+			Name:      name,
+			Type:      "virtual",
+			Addresses: []string{virtualPortMAC(vip) + " " + vip},
+			Options: map[string]string{
+				"virtual-ip":      vip,
+				"virtual-parents": portName,
+			},
+			ExternalIDs: map[string]string{
+				"docker:network":         networkID,
+				"docker:switch":          ls.Name,
+				"docker:virtual_ip":      vip,
+				"docker:virtual_parents": portName,
+			},
+		}
+		createOps, err := d.ovn.CreateLogicalSwitchPortOp(vport)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create virtual port operation: %w", err)
+		}
+		attachOps, err := d.ovn.MutateLogicalSwitchPortsOp(ls, ovsdb.MutateOperationInsert, []string{vport.UUID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mutate operation for virtual port: %w", err)
+		}
+		ops = append(ops, createOps...)
+		ops = append(ops, attachOps...)
+	}
+	return ops, nil
+}
+
+// removeVirtualParentOps removes a port from the parents of the virtual ports
+// of its switch, deleting virtual ports left without parents
+func (d *OVNDriver) removeVirtualParentOps(ls *LogicalSwitch, portName string) ([]ovsdb.Operation, error) {
+	ports, err := d.ovn.ListLogicalSwitchPorts(ls)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := []ovsdb.Operation{}
+	for i := range ports {
+		vport := &ports[i]
+		vip := vport.ExternalIDs["docker:virtual_ip"]
+		if vip == "" {
+			continue
+		}
+		parents := []string{}
+		for _, parent := range virtualParents(vport) {
+			if parent != portName {
+				parents = append(parents, parent)
+			}
+		}
+		if len(parents) == len(virtualParents(vport)) {
+			continue
+		}
+
+		if len(parents) > 0 {
+			updateOps, err := d.setVirtualParentsOps(vport, vip, parents)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create update operation for virtual port %s: %w", vport.Name, err)
+			}
+			ops = append(ops, updateOps...)
+			continue
+		}
+		deleteOps, err := d.deleteLogicalSwitchPortOps(ls, vport.Name)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, deleteOps...)
+	}
+	return ops, nil
+}
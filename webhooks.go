@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Lifecycle events sent to webhooks
+const (
+	eventNetworkCreate  = "network.create"
+	eventNetworkDelete  = "network.delete"
+	eventEndpointCreate = "endpoint.create"
+	eventEndpointDelete = "endpoint.delete"
+)
+
+var lifecycleEvents = []string{eventNetworkCreate, eventNetworkDelete, eventEndpointCreate, eventEndpointDelete}
+
+// webhookSignatureHeader carries the HMAC-SHA256 of the payload when a
+// secret is configured
+const webhookSignatureHeader = "X-Docker-Network-OVN-Signature"
+
+// LifecycleEvent describes a network or endpoint created or deleted through
+// this host and the OVN objects involved. For deletions they are described
+// as they were right before.
+type LifecycleEvent struct {
+	Event      string             `json:"event"`
+	Time       time.Time          `json:"time"`
+	Host       string             `json:"host"`
+	RequestID  string             `json:"request_id,omitempty"`
+	NetworkID  string             `json:"network_id"`
+	EndpointID string             `json:"endpoint_id,omitempty"`
+	Switch     *LifecycleSwitch   `json:"logical_switch,omitempty"`
+	Port       *InventoryEndpoint `json:"logical_switch_port,omitempty"`
+}
+
+// LifecycleSwitch is the logical switch of a network
+type LifecycleSwitch struct {
+	Name        string            `json:"name"`
+	UUID        string            `json:"uuid"`
+	Subnet      string            `json:"subnet,omitempty"`
+	Gateway     string            `json:"gateway,omitempty"`
+	Localnet    string            `json:"localnet,omitempty"`
+	Networks    []string          `json:"networks"`
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+}
+
+// Webhooks posts lifecycle events to external automation such as firewall
+// managers or ticketing. Delivery happens in the background after the Docker
+// request succeeded and is retried for a while; events may arrive out of order.
+type Webhooks struct {
+	urls   []string
+	events map[string]bool
+	secret []byte
+	host   string
+	ctx    context.Context
+	http   *http.Client
+}
+
+// NewWebhooks returns nil when no URL is configured. events is a comma
+// separated list of lifecycle events, empty for all of them.
+func NewWebhooks(ctx context.Context, urls string, events string, secret string, timeout time.Duration) (*Webhooks, error) {
+	w := &Webhooks{
+		events: map[string]bool{},
+		secret: []byte(secret),
+		ctx:    ctx,
+		http:   &http.Client{Timeout: timeout},
+	}
+	for _, url := range strings.Split(urls, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			w.urls = append(w.urls, url)
+		}
+	}
+	if len(w.urls) == 0 {
+		return nil, nil
+	}
+	for _, event := range strings.Split(events, ",") {
+		if event = strings.TrimSpace(event); event == "" {
+			continue
+		}
+		known := false
+		for _, lifecycleEvent := range lifecycleEvents {
+			known = known || event == lifecycleEvent
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown webhook event %q: expected one of %s", event, strings.Join(lifecycleEvents, ", "))
+		}
+		w.events[event] = true
+	}
+	if len(w.events) == 0 {
+		for _, event := range lifecycleEvents {
+			w.events[event] = true
+		}
+	}
+	w.host, _ = os.Hostname()
+	return w, nil
+}
+
+// Notify delivers an event to every webhook in the background
+func (w *Webhooks) Notify(event LifecycleEvent) {
+	if !w.events[event.Event] {
+		return
+	}
+	event.Host = w.host
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Warning: failed to encode %s webhook: %v", event.Event, err)
+		return
+	}
+	for _, url := range w.urls {
+		go func(url string) {
+			retry := backoff.NewExponentialBackOff()
+			retry.MaxElapsedTime = 5 * time.Minute
+			err := backoff.Retry(func() error {
+				return w.post(url, payload)
+			}, backoff.WithContext(retry, w.ctx))
+			if err != nil {
+				log.Printf("Warning: failed to deliver %s of %s to webhook %s: %v", event.Event, event.NetworkID[:12], url, err)
+			}
+		}(url)
+	}
+}
+
+func (w *Webhooks) post(url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(payload)
+		req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// lifecycleEvent describes the OVN objects of a network and, with an
+// endpoint ID, of one of its endpoints
+func (d *OVNDriver) lifecycleEvent(event string, networkID string, endpointID string) LifecycleEvent {
+	e := LifecycleEvent{
+		Event:      event,
+		Time:       time.Now().UTC(),
+		RequestID:  requestIDFrom(d.context()),
+		NetworkID:  networkID,
+		EndpointID: endpointID,
+	}
+	if ls, found, err := d.ovn.GetLogicalSwitchByNetworkID(networkID); err == nil && found {
+		e.Switch = &LifecycleSwitch{
+			Name:        ls.Name,
+			UUID:        ls.UUID,
+			Subnet:      ls.OtherConfig["docker:subnet"],
+			Gateway:     ls.OtherConfig["docker:gateway"],
+			Localnet:    ls.OtherConfig["docker:localnet"],
+			Networks:    switchNetworkIDs(ls),
+			ExternalIDs: ls.ExternalIDs,
+		}
+	}
+	if endpointID != "" {
+		if lsp, found, err := d.ovn.GetLogicalSwitchPort(d.portName(endpointID, networkID)); err == nil && found {
+			port := d.inventoryEndpoint(lsp)
+			e.Port = &port
+		}
+	}
+	return e
+}
+
+// withLifecycleEvent fires event for a driver call once it succeeded.
+// Deletions are described before the call, while their objects exist.
+func withLifecycleEvent[Req any, Res any](event string, call func(*OVNDriver, *Req) (Res, error)) func(*OVNDriver, *Req) (Res, error) {
+	deletion := event == eventNetworkDelete || event == eventEndpointDelete
+	return func(d *OVNDriver, req *Req) (Res, error) {
+		if d.webhooks == nil || !d.webhooks.events[event] {
+			return call(d, req)
+		}
+		networkID, endpointID := driverRequestIDs(req)
+		var described LifecycleEvent
+		if deletion {
+			described = d.lifecycleEvent(event, networkID, endpointID)
+		}
+		res, err := call(d, req)
+		if err != nil {
+			return res, err
+		}
+		if !deletion {
+			described = d.lifecycleEvent(event, networkID, endpointID)
+		}
+		d.webhooks.Notify(described)
+		return res, nil
+	}
+}